@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// paletteRows is how many entries the command palette shows.
+	paletteRows = 12
+	// paletteRecent is how many recently run commands the palette offers.
+	paletteRecent = 20
+)
+
+// action is an entry of the action registry. Normal-mode keys and the
+// command palette both run actions from the registry, so every action is
+// reachable either way.
+type action struct {
+	name    string
+	title   string
+	hint    string       // shown right of the title, e.g. "recent"
+	binding *key.Binding // nil for actions only reachable from the palette
+	run     func(m *model) tea.Cmd
+}
+
+// palette is the state of the command palette.
+type palette struct {
+	active  bool
+	input   textinput.Model
+	actions []action
+	matches []int // indices into actions, best first
+	cursor  int
+}
+
+// keyHandlers implements the actions that have a key binding, by the name
+// KeyMap.actions gives them. Bindings without a handler here (input mode,
+// pane keys) are handled where they apply.
+func keyHandlers() map[string]func(m *model) tea.Cmd {
+	return map[string]func(m *model) tea.Cmd{
+		"quit": func(m *model) tea.Cmd {
+			return tea.Quit
+		},
+		"input": func(m *model) tea.Cmd {
+			if m.inputMode {
+				m.closeInput()
+				return nil
+			}
+			m.inputMode = true
+			m.showInput = true
+			return m.textInput.Focus()
+		},
+		"down": func(m *model) tea.Cmd {
+			if m.selectedIdx < len(m.blocks)-1 {
+				m.selectBlock(m.selectedIdx + 1)
+			}
+			return nil
+		},
+		"up": func(m *model) tea.Cmd {
+			if m.selectedIdx > 0 {
+				m.selectBlock(m.selectedIdx - 1)
+			}
+			return nil
+		},
+		"expand": (*model).toggleSelected,
+		"toggle": (*model).toggleSelected,
+		"copy":   (*model).copySelected,
+		"refresh": func(m *model) tea.Cmd {
+			// Refresh/reload block
+			if m.selectedIdx < len(m.blocks) && m.blocks[m.selectedIdx].Type == BlockTypeProgress {
+				m.blocks[m.selectedIdx].Progress = 0
+				m.blocks[m.selectedIdx].IsLoading = true
+				return animateProgress(m.blocks[m.selectedIdx])
+			}
+			return nil
+		},
+		"delete": func(m *model) tea.Cmd {
+			if len(m.blocks) > 1 {
+				m.blocks = append(m.blocks[:m.selectedIdx], m.blocks[m.selectedIdx+1:]...)
+				if m.selectedIdx >= len(m.blocks) {
+					m.selectedIdx = len(m.blocks) - 1
+				}
+				m.blocks[m.selectedIdx].Selected = true
+			}
+			return nil
+		},
+		"execute": (*model).stepSelected,
+		"pipe":    (*model).openPipe,
+		"run_all": func(m *model) tea.Cmd {
+			return m.runSteps(0)
+		},
+		"save":       (*model).saveDocument,
+		"attempts":   (*model).toggleAttempts,
+		"next_alert": (*model).jumpToAlert,
+		"help": func(m *model) tea.Cmd {
+			m.helpMode = !m.helpMode
+			return nil
+		},
+		"table": func(m *model) tea.Cmd {
+			m.showTable = !m.showTable
+			return nil
+		},
+		"split": func(m *model) tea.Cmd {
+			// Cycle split layout: none, side by side, stacked
+			m.cycleSplit()
+			return nil
+		},
+		"theme": func(m *model) tea.Cmd {
+			// Cycle through the built-in and user themes
+			m.applyTheme(nextTheme(m.themes, m.theme.Name))
+			return nil
+		},
+		"page_up": func(m *model) tea.Cmd {
+			m.pageSelected(-1)
+			return nil
+		},
+		"page_down": func(m *model) tea.Cmd {
+			m.pageSelected(1)
+			return nil
+		},
+		"palette": (*model).openPalette,
+		"jobs":    (*model).openJobsPanel,
+		"clear": func(m *model) tea.Cmd {
+			m.blocks = []Block{}
+			m.selectedIdx = 0
+			return nil
+		},
+	}
+}
+
+// registry lists every action: the bound ones in help order, then the ones
+// only the palette offers.
+func (m *model) registry() []action {
+	handlers := keyHandlers()
+
+	var list []action
+	for _, ka := range m.keys.actions() {
+		if run, ok := handlers[ka.name]; ok {
+			list = append(list, action{name: ka.name, title: ka.desc, binding: ka.binding, run: run})
+		}
+	}
+
+	list = append(list,
+		action{name: "export_markdown", title: "Export session as Markdown", run: (*model).exportSession},
+		action{name: "run_from_here", title: "Run steps from the selected block", run: func(m *model) tea.Cmd {
+			return m.runSteps(m.selectedIdx)
+		}},
+		action{name: "run_all_continue", title: "Run all steps, going on after failures", run: func(m *model) tea.Cmd {
+			return m.runStepsWith(0, failureContinue)
+		}},
+		action{name: "rerun_failed", title: "Rerun the failed commands", run: (*model).rerunFailed},
+		action{name: "pipe_source", title: "Select the block this output was piped from", run: (*model).selectPipeSource},
+		action{name: "table_output", title: "Show output of selected block as a table or text", run: (*model).tableSelected},
+		action{name: "clear_outputs", title: "Clear outputs of all steps", run: (*model).clearOutputs},
+		action{name: "save_notebook", title: "Save session as notebook (.gbx)", run: (*model).saveNotebook},
+		action{name: "expect_output", title: "Expect the selected block's current output", run: (*model).expectSelected},
+		action{name: "add_expectation", title: "Add an expectation to the selected block", run: (*model).openExpect},
+		action{name: "clear_expectations", title: "Clear the selected block's expectations", run: (*model).clearExpectations},
+		action{name: "expectation_summary", title: "Summarize the expectations of all blocks", run: (*model).showExpectationSummary},
+		action{name: "editor", title: "Open script editor", run: func(m *model) tea.Cmd {
+			return m.openEditor("")
+		}},
+		action{name: "kill_job", title: "Stop the command of the selected block", run: (*model).killSelected},
+		action{name: "detach_job", title: "Detach the command of the selected block", run: (*model).detachSelected},
+		action{name: "reload_workflows", title: "Reload workflows", run: (*model).reloadWorkflows},
+		action{name: "search_history", title: "Search input history", run: func(m *model) tea.Cmd {
+			m.inputMode = true
+			m.showInput = true
+			return m.openHistorySearch()
+		}},
+	)
+
+	for _, l := range []struct {
+		mode  splitMode
+		title string
+	}{
+		{splitNone, "Layout: single pane"},
+		{splitVertical, "Layout: side by side"},
+		{splitHorizontal, "Layout: stacked"},
+	} {
+		mode := l.mode
+		list = append(list, action{name: "layout", title: l.title, run: func(m *model) tea.Cmd {
+			for m.split != mode {
+				m.cycleSplit()
+			}
+			return nil
+		}})
+	}
+
+	for _, t := range m.themes {
+		t := t
+		list = append(list, action{name: "theme", title: "Theme: " + t.Name, run: func(m *model) tea.Cmd {
+			m.applyTheme(t)
+			return nil
+		}})
+	}
+
+	return list
+}
+
+// dispatchKey runs the bound action matching msg, if any.
+func (m *model) dispatchKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	for _, a := range m.registry() {
+		if a.binding != nil && key.Matches(msg, *a.binding) {
+			return a.run(m), true
+		}
+	}
+	return nil, false
+}
+
+func (m *model) toggleSelected() tea.Cmd {
+	if m.selectedIdx < len(m.blocks) {
+		m.blocks[m.selectedIdx].Expanded = !m.blocks[m.selectedIdx].Expanded
+	}
+	return nil
+}
+
+// copySelected copies the output of the selected block, or its content or
+// command when it has no output.
+func (m *model) copySelected() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	block := m.blocks[m.selectedIdx]
+	contentToCopy := block.Output
+	if contentToCopy == "" {
+		contentToCopy = block.Content
+	}
+	if contentToCopy == "" && block.Command != "" {
+		contentToCopy = block.Command
+	}
+	if contentToCopy != "" {
+		clipboard.WriteAll(contentToCopy)
+		if m.blocks[m.selectedIdx].Metadata == nil {
+			m.blocks[m.selectedIdx].Metadata = make(map[string]string)
+		}
+		m.blocks[m.selectedIdx].Metadata["copied"] = "true"
+		// Show feedback message
+		m.addInfoBlock("Content copied to clipboard!")
+	}
+	return nil
+}
+
+// pageSelected scrolls long output inside the selected block by a page.
+func (m *model) pageSelected(dir int) {
+	if m.selectedIdx < len(m.blocks) {
+		m.scrollBlock(m.selectedIdx, dir*m.blocks[m.selectedIdx].Viewport.Height)
+	}
+}
+
+// exportSession writes every block to a Markdown file in the working
+// directory.
+func (m *model) exportSession() tea.Cmd {
+	path := filepath.Join(m.cwd, "gbloxs-"+time.Now().Format("20060102-150405")+".md")
+	if err := os.WriteFile(path, []byte(renderMarkdown(m.blocks)), 0o644); err != nil {
+		m.addInfoBlock("Export failed: " + err.Error())
+		return nil
+	}
+	m.addInfoBlock("Session exported to " + path)
+	return nil
+}
+
+// reloadWorkflows rereads the workflow files, e.g. after pulling a shared
+// workflows repository.
+func (m *model) reloadWorkflows() tea.Cmd {
+	workflows, warnings := loadWorkflows(m.config.Workflows)
+	m.workflows = workflows
+	message := fmt.Sprintf("Loaded %d workflows", len(workflows))
+	if len(warnings) > 0 {
+		message += "\n" + strings.Join(warnings, "\n")
+	}
+	m.addInfoBlock(message)
+	return nil
+}
+
+// paletteActions is the registry followed by the workflows and recently
+// run commands, newest first.
+func (m *model) paletteActions() []action {
+	list := m.registry()
+
+	for _, wf := range m.workflows {
+		wf := wf
+		list = append(list, action{
+			name:  "workflow",
+			title: "Workflow: " + wf.Name,
+			hint:  wf.Description,
+			run: func(m *model) tea.Cmd {
+				return m.startWorkflow(wf)
+			},
+		})
+	}
+
+	seen := make(map[string]bool)
+	for i := len(m.history.entries) - 1; i >= 0 && len(seen) < paletteRecent; i-- {
+		input := m.history.entries[i].Command
+		if seen[input] {
+			continue
+		}
+		seen[input] = true
+		list = append(list, action{
+			name:  "recent",
+			title: strings.ReplaceAll(input, "\n", " ⏎ "),
+			hint:  "recent",
+			run: func(m *model) tea.Cmd {
+				m.submitInput(input)
+				return nil
+			},
+		})
+	}
+
+	return list
+}
+
+func newPaletteInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "> "
+	ti.Placeholder = "type an action or command..."
+	ti.CharLimit = 200
+	return ti
+}
+
+func (m *model) openPalette() tea.Cmd {
+	m.palette.active = true
+	m.palette.actions = m.paletteActions()
+	m.palette.input.SetValue("")
+	m.filterPalette()
+	return m.palette.input.Focus()
+}
+
+func (m *model) closePalette() {
+	m.palette.active = false
+	m.palette.actions = nil
+	m.palette.input.Blur()
+}
+
+// filterPalette ranks the actions by how well their title matches the
+// query, keeping registry order among equal scores.
+func (m *model) filterPalette() {
+	type match struct{ idx, score int }
+	var matches []match
+	for i, a := range m.palette.actions {
+		if score, ok := fuzzyScore(m.palette.input.Value(), a.title); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].score > matches[b].score
+	})
+
+	m.palette.matches = m.palette.matches[:0]
+	for _, mt := range matches {
+		m.palette.matches = append(m.palette.matches, mt.idx)
+	}
+	m.palette.cursor = 0
+}
+
+// updatePalette handles keys while the palette is open.
+func (m *model) updatePalette(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Cancel):
+		m.closePalette()
+
+	case key.Matches(msg, m.keys.Submit):
+		var chosen *action
+		if m.palette.cursor < len(m.palette.matches) {
+			a := m.palette.actions[m.palette.matches[m.palette.cursor]]
+			chosen = &a
+		}
+		m.closePalette()
+		if chosen != nil {
+			return chosen.run(m)
+		}
+
+	case key.Matches(msg, m.keys.HistoryPrev):
+		if m.palette.cursor > 0 {
+			m.palette.cursor--
+		}
+
+	case key.Matches(msg, m.keys.HistoryNext):
+		if m.palette.cursor < len(m.palette.matches)-1 {
+			m.palette.cursor++
+		}
+
+	default:
+		var cmd tea.Cmd
+		m.palette.input, cmd = m.palette.input.Update(msg)
+		m.filterPalette()
+		return cmd
+	}
+
+	return nil
+}
+
+// renderPalette draws the palette overlay shown under the header.
+func (m model) renderPalette() string {
+	var b strings.Builder
+	b.WriteString(m.palette.input.View())
+
+	if len(m.palette.matches) == 0 {
+		b.WriteString("\n" + m.styles.Muted.Render("  no matching actions"))
+	}
+
+	first := 0
+	if m.palette.cursor >= paletteRows {
+		first = m.palette.cursor - paletteRows + 1
+	}
+
+	width := m.width - 30
+	for i := first; i < len(m.palette.matches) && i < first+paletteRows; i++ {
+		a := m.palette.actions[m.palette.matches[i]]
+
+		title := a.title
+		if width > 10 && len([]rune(title)) > width {
+			title = string([]rune(title)[:width-1]) + "…"
+		}
+
+		hint := a.hint
+		if a.binding != nil && a.binding.Enabled() {
+			hint = a.binding.Help().Key
+		}
+
+		line := "  " + title
+		if i == m.palette.cursor {
+			line = m.styles.TableSelectedRow.Render("▶ " + title)
+		}
+		if hint != "" {
+			line += m.styles.Muted.Render("  " + hint)
+		}
+		b.WriteString("\n" + line)
+	}
+
+	if hidden := len(m.palette.matches) - first - paletteRows; hidden > 0 {
+		b.WriteString("\n" + m.styles.Muted.Render(fmt.Sprintf("  … %d more", hidden)))
+	}
+
+	return m.styles.HelpOverlay.Copy().
+		Padding(0, 1).
+		Width(m.width - 4).
+		Render(b.String())
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Alert severities, in rising order.
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+var severityRank = map[string]int{severityInfo: 1, severityWarning: 2, severityError: 3}
+
+const (
+	// alertFlashFor is how long the border of a block flashes after a line
+	// matched, alertFlashPeriod how long each flash lasts.
+	alertFlashFor    = 3 * time.Second
+	alertFlashPeriod = 300 * time.Millisecond
+	// alertNotifyInterval keeps a rule that matches often from notifying
+	// more than once in this time.
+	alertNotifyInterval = 10 * time.Second
+	// maxAlerts is how many matching lines the alerts block keeps; older
+	// ones drop out.
+	maxAlerts = 500
+)
+
+// summaryAlerts is the summary metadata of the block that collects the
+// lines that matched.
+const summaryAlerts = "alerts"
+
+// AlertRule marks lines of output that match a pattern while a command
+// runs or a stream is read.
+type AlertRule struct {
+	// Pattern is a regular expression matched against every line.
+	Pattern string `yaml:"pattern"`
+	// Severity is info, warning or error; empty means warning.
+	Severity string `yaml:"severity"`
+	// Notify sends a notification the way notify.via says.
+	Notify bool `yaml:"notify"`
+}
+
+// alertRule is a rule ready to match.
+type alertRule struct {
+	AlertRule
+	re       *regexp.Regexp
+	notified time.Time
+}
+
+// alertHit is a line that matched a rule.
+type alertHit struct {
+	blockID  string
+	title    string
+	line     int // from 1
+	text     string
+	severity string
+	time     time.Time
+}
+
+// alertScan is how far the output of a block was scanned.
+type alertScan struct {
+	offset int // bytes, up to the end of the last complete line
+	line   int // lines scanned
+}
+
+// alerts is the state of the alert rules: which outputs are being
+// scanned and what matched.
+type alerts struct {
+	rules []*alertRule
+	// scans are the blocks whose output is being scanned, by ID. A block is
+	// scanned while its command runs or its stream is read; output that
+	// was there before, as in an opened notebook, is left alone.
+	scans map[string]alertScan
+	hits  []alertHit
+	// flashes are the blocks whose border flashes, since the last match
+	flashes map[string]alertHit
+	// jumped is the hit the last jump went to, -1 before the first
+	jumped int
+}
+
+// compile checks a rule and readies it to match.
+func (r AlertRule) compile() (*alertRule, error) {
+	if r.Severity == "" {
+		r.Severity = severityWarning
+	}
+	if severityRank[r.Severity] == 0 {
+		return nil, fmt.Errorf("alert %q: severity %q is not info, warning or error", r.Pattern, r.Severity)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("alert %q: %w", r.Pattern, err)
+	}
+	return &alertRule{AlertRule: r, re: re}, nil
+}
+
+// parseAlertFlag reads an --alert option: [SEVERITY[,notify]:]REGEX. A
+// prefix that is not a severity is part of the pattern.
+func parseAlertFlag(s string) (AlertRule, error) {
+	rule := AlertRule{Pattern: s}
+	if prefix, pattern, ok := strings.Cut(s, ":"); ok {
+		severity, notify, _ := strings.Cut(prefix, ",")
+		if severityRank[severity] > 0 && (notify == "" || notify == "notify") {
+			rule = AlertRule{Pattern: pattern, Severity: severity, Notify: notify != ""}
+		}
+	}
+	_, err := rule.compile()
+	return rule, err
+}
+
+// newAlerts readies the configured rules, reporting the ones that cannot
+// be used.
+func newAlerts(rules []AlertRule) (alerts, []string) {
+	a := alerts{scans: make(map[string]alertScan), flashes: make(map[string]alertHit), jumped: -1}
+	var warnings []string
+	for _, r := range rules {
+		compiled, err := r.compile()
+		if err != nil {
+			warnings = append(warnings, "alerts: "+err.Error())
+			continue
+		}
+		a.rules = append(a.rules, compiled)
+	}
+	return a, warnings
+}
+
+// addAlertRules adds rules given on the command line to the configured
+// ones.
+func (m *model) addAlertRules(rules []AlertRule) {
+	for _, r := range rules {
+		if compiled, err := r.compile(); err == nil {
+			m.alerts.rules = append(m.alerts.rules, compiled)
+		}
+	}
+}
+
+// restart scans the output of a block from its start again, as its
+// command runs again. What the last run printed was scanned while it ran.
+func (a *alerts) restart(blockID string) {
+	if len(a.rules) > 0 {
+		a.scans[blockID] = alertScan{}
+	}
+}
+
+// checkAlerts matches the lines that arrived in running commands and
+// streams since the last check against the alert rules. Lines are matched
+// once complete; the last one also when the output ended.
+func (m *model) checkAlerts() tea.Cmd {
+	if len(m.alerts.rules) == 0 {
+		return nil
+	}
+	var cmds []tea.Cmd
+	var found []alertHit
+	for i := range m.blocks {
+		b := &m.blocks[i]
+		if b.Metadata["summary"] == summaryAlerts {
+			continue
+		}
+		live := b.IsLoading || b.Metadata["executing"] != ""
+		scan, scanning := m.alerts.scans[b.ID]
+		switch {
+		case !live && !scanning:
+			continue
+		case !live:
+			// The output is complete; this is its last scan
+			delete(m.alerts.scans, b.ID)
+		}
+		if scan.offset > len(b.Output) {
+			// The output was replaced
+			scan = alertScan{}
+		}
+
+		text := b.Output[scan.offset:]
+		end := strings.LastIndexByte(text, '\n') + 1
+		if !live {
+			end = len(text)
+		}
+		for _, line := range strings.SplitAfter(text[:end], "\n") {
+			if line == "" {
+				continue
+			}
+			scan.line++
+			line = strings.TrimRight(line, "\r\n")
+			for _, rule := range m.alerts.rules {
+				if !rule.re.MatchString(line) {
+					continue
+				}
+				hit := alertHit{blockID: b.ID, title: b.Title, line: scan.line, text: line, severity: rule.Severity, time: time.Now()}
+				found = append(found, hit)
+				b.Alerts++
+				if prev, ok := m.alerts.flashes[b.ID]; !ok || severityRank[hit.severity] >= severityRank[prev.severity] || time.Since(prev.time) > alertFlashFor {
+					m.alerts.flashes[b.ID] = hit
+				}
+				if rule.Notify && time.Since(rule.notified) >= alertNotifyInterval {
+					rule.notified = time.Now()
+					cmds = append(cmds, m.notifyAlert(hit))
+				}
+				// The first rule that matches decides the severity
+				break
+			}
+		}
+		scan.offset += end
+		if live {
+			m.alerts.scans[b.ID] = scan
+		}
+	}
+
+	if len(found) > 0 {
+		m.alerts.hits = append(m.alerts.hits, found...)
+		if len(m.alerts.hits) > maxAlerts {
+			m.alerts.hits = m.alerts.hits[len(m.alerts.hits)-maxAlerts:]
+		}
+		m.alerts.jumped = -1
+		m.updateAlertsBlock()
+	}
+	return tea.Batch(cmds...)
+}
+
+// notifyAlert notifies about a line that matched a rule that asks for it.
+func (m model) notifyAlert(hit alertHit) tea.Cmd {
+	title := strings.Join(strings.Fields(hit.title), " ")
+	body := fmt.Sprintf("%s: %s", hit.severity, oscText(hit.text))
+	return m.deliver(title, body, []string{
+		"GBLOXS_TITLE=" + title,
+		"GBLOXS_STATUS=alert",
+		"GBLOXS_SEVERITY=" + hit.severity,
+		"GBLOXS_ALERT=" + hit.text,
+		"GBLOXS_BLOCK=" + hit.blockID,
+		"GBLOXS_LINE=" + strconv.Itoa(hit.line),
+	})
+}
+
+// updateAlertsBlock shows the lines that matched in the alerts block,
+// adding it the first time. The block does not take the selection.
+func (m *model) updateAlertsBlock() {
+	idx := -1
+	for i := range m.blocks {
+		if m.blocks[i].Metadata["summary"] == summaryAlerts {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		m.blocks = append(m.blocks, Block{
+			ID:        m.newBlockID(),
+			Type:      BlockTypeInfo,
+			Expanded:  true,
+			Timestamp: time.Now(),
+			Metadata:  map[string]string{"summary": summaryAlerts},
+			Notice:    true,
+			Viewport:  viewport.New(m.width-10, 10),
+		})
+		idx = len(m.blocks) - 1
+	}
+
+	b := &m.blocks[idx]
+	b.Title = fmt.Sprintf("Alerts (%d)", len(m.alerts.hits))
+	lines := make([]string, len(m.alerts.hits))
+	for i, hit := range m.alerts.hits {
+		mark := " "
+		if i == m.alerts.jumped {
+			mark = "▶"
+		}
+		lines[i] = fmt.Sprintf("%s %s %-7s #%s:%d  %s", mark, hit.time.Format("15:04:05"), hit.severity, hit.blockID, hit.line, hit.text)
+	}
+	b.Content = strings.Join(lines, "\n")
+	b.Viewport.SetContent(b.Content)
+	b.Viewport.GotoBottom()
+}
+
+// jumpToAlert selects the block of the latest line that matched and
+// scrolls to that line; pressing again goes to the one before, wrapping
+// around to the latest.
+func (m *model) jumpToAlert() tea.Cmd {
+	if len(m.alerts.hits) == 0 {
+		if len(m.alerts.rules) == 0 {
+			m.addInfoBlock("No alert rules are set; add them under alerts in config.yaml or with --alert")
+		} else {
+			m.addInfoBlock("No lines matched the alert rules")
+		}
+		return nil
+	}
+	next := m.alerts.jumped - 1
+	if next < 0 {
+		next = len(m.alerts.hits) - 1
+	}
+	m.alerts.jumped = next
+	m.updateAlertsBlock()
+
+	hit := m.alerts.hits[next]
+	idx := m.blockIndex(hit.blockID)
+	if idx < 0 {
+		m.addInfoBlock(fmt.Sprintf("Block #%s of the alert was deleted", hit.blockID))
+		return nil
+	}
+	m.selectBlock(idx)
+	b := &m.blocks[idx]
+	b.Expanded = true
+	// Center the line when the block scrolls
+	b.Viewport.SetContent(scrollText(*b))
+	b.Viewport.SetYOffset(hit.line - 1 - b.Viewport.Height/2)
+	return nil
+}
+
+// alertBorder is the color the border of a block flashes in after one of
+// its lines matched.
+func (m model) alertBorder(b Block) (lipgloss.Color, bool) {
+	hit, ok := m.alerts.flashes[b.ID]
+	if !ok {
+		return "", false
+	}
+	since := time.Since(hit.time)
+	if since > alertFlashFor || (since/alertFlashPeriod)%2 == 1 {
+		return "", false
+	}
+	return m.severityColor(hit.severity), true
+}
+
+// severityColor is the theme color alerts of a severity are shown in.
+func (m model) severityColor(severity string) lipgloss.Color {
+	switch severity {
+	case severityError:
+		return lipgloss.Color(m.theme.Error)
+	case severityWarning:
+		return lipgloss.Color(m.theme.Command)
+	}
+	return lipgloss.Color(m.theme.Accent)
+}
+
+// alertBadge counts the alerts of a block since it was last selected, in
+// the color of the latest.
+func (m model) alertBadge(b Block) string {
+	if b.Alerts == 0 {
+		return ""
+	}
+	severity := severityWarning
+	if hit, ok := m.alerts.flashes[b.ID]; ok {
+		severity = hit.severity
+	}
+	return lipgloss.NewStyle().Foreground(m.severityColor(severity)).Render(fmt.Sprintf(" ⚠ %d", b.Alerts))
+}
+
+// unreadAlerts counts the alerts of all blocks since they were last
+// selected.
+func (m model) unreadAlerts() int {
+	n := 0
+	for _, b := range m.blocks {
+		n += b.Alerts
+	}
+	return n
+}
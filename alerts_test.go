@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAlertFlag(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    AlertRule
+		wantErr string
+	}{
+		{flag: "ERROR", want: AlertRule{Pattern: "ERROR"}},
+		{flag: "error:panic", want: AlertRule{Pattern: "panic", Severity: "error"}},
+		{flag: "info,notify:deployed", want: AlertRule{Pattern: "deployed", Severity: "info", Notify: true}},
+		// Prefixes that are no severity belong to the pattern
+		{flag: "level:warn", want: AlertRule{Pattern: "level:warn"}},
+		{flag: "warning,loud:x", want: AlertRule{Pattern: "warning,loud:x"}},
+		{flag: `error:^\d+:\d+ fatal`, want: AlertRule{Pattern: `^\d+:\d+ fatal`, Severity: "error"}},
+
+		{flag: "error:(", wantErr: "missing closing )"},
+		{flag: "(", wantErr: "missing closing )"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAlertFlag(tt.flag)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAlertFlag(%q) error = %v, want %q", tt.flag, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAlertFlag(%q) = %+v, %v, want %+v", tt.flag, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewAlerts(t *testing.T) {
+	a, warnings := newAlerts([]AlertRule{
+		{Pattern: "ok"},
+		{Pattern: "(", Severity: "error"},
+		{Pattern: "x", Severity: "fatal"},
+	})
+	if len(a.rules) != 1 || a.rules[0].Severity != severityWarning {
+		t.Errorf("rules = %+v, want the first one as a warning", a.rules)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings = %q, want two", warnings)
+	}
+}
+
+// alertModel is a model with alert rules and one running command block.
+func alertModel(t *testing.T, rules ...AlertRule) model {
+	t.Helper()
+	a, warnings := newAlerts(rules)
+	if len(warnings) > 0 {
+		t.Fatal(warnings)
+	}
+	return model{
+		alerts: a,
+		blocks: []Block{{ID: "1", Title: "build", Command: "make", IsLoading: true, Metadata: map[string]string{"executing": "true"}}},
+	}
+}
+
+// alertLines are the lines that matched, as "block:line text".
+func alertLines(m model) []string {
+	var lines []string
+	for _, hit := range m.alerts.hits {
+		lines = append(lines, fmt.Sprintf("%s:%d %s", hit.blockID, hit.line, hit.text))
+	}
+	return lines
+}
+
+func TestCheckAlerts(t *testing.T) {
+	m := alertModel(t, AlertRule{Pattern: "ERROR", Severity: severityError}, AlertRule{Pattern: "WARN|ERROR"})
+
+	// Lines are matched once they are complete
+	setOutput(&m.blocks[0], "start\nERROR one\nWARN tw")
+	m.checkAlerts()
+	setOutput(&m.blocks[0], m.blocks[0].Output+"o\nlast ERROR")
+	m.checkAlerts()
+	if got := strings.Join(alertLines(m), "|"); got != "1:2 ERROR one|1:3 WARN two" {
+		t.Errorf("while running: %q", got)
+	}
+	if m.alerts.hits[0].severity != severityError || m.alerts.hits[1].severity != severityWarning {
+		t.Errorf("the first rule that matches decides the severity: %+v", m.alerts.hits)
+	}
+
+	// The last line counts once the output ended, and only once
+	m.blocks[0].IsLoading = false
+	delete(m.blocks[0].Metadata, "executing")
+	m.checkAlerts()
+	m.checkAlerts()
+	if got := len(m.alerts.hits); got != 3 || m.blocks[0].Alerts != 3 {
+		t.Fatalf("after the end: %d hits, badge %d, want 3", got, m.blocks[0].Alerts)
+	}
+
+	// Running the command again scans only what the new run prints
+	b := &m.blocks[0]
+	if cmd, _ := m.prepareCommand("make", b); cmd == nil {
+		t.Fatal("command not prepared")
+	}
+	m.alerts.restart(b.ID)
+	b.IsLoading = true
+	m.checkAlerts()
+	if got := len(m.alerts.hits); got != 3 {
+		t.Errorf("the last run's output was scanned again: %q", alertLines(m)[3:])
+	}
+	setOutput(b, "ok\nERROR again, in a longer line than before\n")
+	m.checkAlerts()
+	if got := strings.Join(alertLines(m)[3:], "|"); got != "1:2 ERROR again, in a longer line than before" {
+		t.Errorf("after running again: %q", got)
+	}
+
+	// A retry while the block is live starts over too
+	m.alerts.restart(b.ID)
+	setOutput(b, "ERROR on retry\n")
+	m.checkAlerts()
+	if got := strings.Join(alertLines(m)[4:], "|"); got != "1:1 ERROR on retry" {
+		t.Errorf("after a retry: %q", got)
+	}
+
+	if last := m.blocks[len(m.blocks)-1]; last.Metadata["summary"] != summaryAlerts || last.Title != "Alerts (5)" {
+		t.Errorf("alerts block = %q %v", last.Title, last.Metadata)
+	}
+}
+
+func TestCheckAlertsLeavesFinishedOutput(t *testing.T) {
+	m := alertModel(t, AlertRule{Pattern: "ERROR"})
+	m.blocks[0].IsLoading = false
+	delete(m.blocks[0].Metadata, "executing")
+	m.blocks[0].Output = "ERROR from an opened notebook\n"
+
+	m.checkAlerts()
+	if len(m.alerts.hits) != 0 {
+		t.Errorf("output that was there before was scanned: %q", alertLines(m))
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Expectations a command block is checked against once its command
+// finished, written one per line:
+//
+//	exit 0
+//	contains ready
+//	matches ^version \d+\.\d+
+//	json .status = "up"
+//
+// A block with expectations passes when all of them hold, and also needs
+// to exit with 0 unless one of them names the exit code.
+const (
+	expectExit     = "exit"
+	expectContains = "contains"
+	expectMatches  = "matches"
+	expectJSON     = "json"
+)
+
+// summaryExpectations is the summary metadata of the block that sums up
+// the expectations.
+const summaryExpectations = "expectations"
+
+// Assertion is one expectation of a command block.
+type Assertion struct {
+	Kind string
+	// Path is the JSON path a json expectation looks up
+	Path string
+	// Value is the exit code, text, pattern or JSON value expected
+	Value string
+}
+
+// Check is how an expectation fared on the last run of the command.
+type Check struct {
+	Expect string `json:"expect"`
+	Passed bool   `json:"passed"`
+	// Got tells what was found instead when it failed
+	Got string `json:"got,omitempty"`
+}
+
+// parseAssertion reads one expectation line. Text in double quotes is
+// unquoted, for text with leading spaces or escapes.
+func parseAssertion(line string) (Assertion, error) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	rest = strings.TrimSpace(rest)
+	a := Assertion{Kind: kind, Value: rest}
+
+	switch kind {
+	case expectExit:
+		if _, err := strconv.Atoi(rest); err != nil {
+			return a, fmt.Errorf("exit %s: not an exit code", rest)
+		}
+	case expectContains, expectMatches:
+		if rest == "" {
+			return a, fmt.Errorf("%s needs text to look for", kind)
+		}
+		if text, err := strconv.Unquote(rest); err == nil {
+			a.Value = text
+		}
+		if kind == expectMatches {
+			if _, err := regexp.Compile(a.Value); err != nil {
+				return a, fmt.Errorf("matches %s: %w", rest, err)
+			}
+		}
+	case expectJSON:
+		path, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return a, fmt.Errorf("json %s: expected PATH = VALUE", rest)
+		}
+		a.Path = strings.TrimSpace(path)
+		a.Value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+		if _, err := parseJSONPath(a.Path); err != nil {
+			return a, err
+		}
+	default:
+		return a, fmt.Errorf("unknown expectation %q; use exit, contains, matches or json", kind)
+	}
+	return a, nil
+}
+
+// parseAssertions reads expectations one per line, skipping blank lines.
+// Errors carry the number of the line, counting from first.
+func parseAssertions(text string, first int) ([]Assertion, error) {
+	var list []Assertion
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		a, err := parseAssertion(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", first+i, err)
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// String writes the expectation as parseAssertion reads it.
+func (a Assertion) String() string {
+	switch a.Kind {
+	case expectJSON:
+		return fmt.Sprintf("json %s = %s", a.Path, a.Value)
+	case expectContains, expectMatches:
+		value := a.Value
+		if value != strings.TrimSpace(value) || strconv.Quote(value) != `"`+value+`"` {
+			value = strconv.Quote(value)
+		}
+		return a.Kind + " " + value
+	}
+	return a.Kind + " " + a.Value
+}
+
+// label is the expectation as its badge shows it.
+func (a Assertion) label() string {
+	switch a.Kind {
+	case expectContains:
+		return fmt.Sprintf("contains %q", a.Value)
+	case expectMatches:
+		return "matches /" + a.Value + "/"
+	case expectJSON:
+		return a.Path + " = " + a.Value
+	}
+	return a.String()
+}
+
+// assertionsText writes expectations one per line.
+func assertionsText(list []Assertion) string {
+	lines := make([]string, len(list))
+	for i, a := range list {
+		lines[i] = a.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// check tells whether the expectation holds for a command that printed
+// output and exited with exitCode.
+func (a Assertion) check(output string, exitCode int) Check {
+	c := Check{Expect: a.label(), Passed: true}
+	fail := func(format string, args ...any) Check {
+		c.Passed = false
+		c.Got = fmt.Sprintf(format, args...)
+		return c
+	}
+
+	switch a.Kind {
+	case expectExit:
+		if want, _ := strconv.Atoi(a.Value); exitCode != want {
+			return fail("exit %d", exitCode)
+		}
+	case expectContains:
+		if !strings.Contains(output, a.Value) {
+			return fail("not in the output")
+		}
+	case expectMatches:
+		// ^ and $ match at every line, as in grep
+		re, err := regexp.Compile("(?m)" + a.Value)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if !re.MatchString(output) {
+			return fail("no match in the output")
+		}
+	case expectJSON:
+		var doc any
+		if err := json.Unmarshal([]byte(output), &doc); err != nil {
+			return fail("the output is not JSON")
+		}
+		got, err := lookupJSON(doc, a.Path)
+		if err != nil {
+			return fail("%v", err)
+		}
+		// Values that are not JSON are compared as strings, so that
+		// .status = up works as well as .status = "up"
+		var want any = a.Value
+		json.Unmarshal([]byte(a.Value), &want)
+		if !reflect.DeepEqual(got, want) {
+			text, _ := json.Marshal(got)
+			return fail("%s", text)
+		}
+	}
+	return c
+}
+
+// checkAssertions checks a command that finished against its
+// expectations, which then decide whether the block succeeded.
+func checkAssertions(b *Block) {
+	b.Checks = nil
+	if len(b.Assertions) == 0 {
+		return
+	}
+	failed, namesExit := 0, false
+	for _, a := range b.Assertions {
+		c := a.check(b.Output, b.ExitCode)
+		b.Checks = append(b.Checks, c)
+		if !c.Passed {
+			failed++
+		}
+		namesExit = namesExit || a.Kind == expectExit
+	}
+
+	switch {
+	case failed > 0:
+		b.Type = BlockTypeError
+		b.Error = fmt.Sprintf("%d of %d expectations failed", failed, len(b.Checks))
+	case !namesExit && b.ExitCode != 0:
+		// The exit code was not expected; the error says which it was
+		b.Type = BlockTypeError
+	default:
+		b.Type = BlockTypeSuccess
+		b.Error = ""
+	}
+}
+
+// failed reports whether the block's command failed: by its expectations
+// when it has any, by its exit code otherwise.
+func (b Block) failed() bool {
+	if len(b.Checks) > 0 {
+		return b.Type == BlockTypeError
+	}
+	return b.ExitCode != 0
+}
+
+// failure tells why the block's command failed.
+func (b Block) failure() string {
+	failed := 0
+	for _, c := range b.Checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Sprintf("%d of %d expectations failed", failed, len(b.Checks))
+	}
+	return fmt.Sprintf("exit code %d", b.ExitCode)
+}
+
+// parseJSONPath splits a path such as .items[0].name, optionally starting
+// with $, into object keys and array indexes. "." alone is the whole
+// document.
+func parseJSONPath(path string) ([]any, error) {
+	var steps []any
+	rest := strings.TrimPrefix(path, "$")
+	if path == "" || (rest != "" && rest[0] != '.' && rest[0] != '[') {
+		return nil, fmt.Errorf("json path %q does not start with . or [", path)
+	}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end > 0 {
+				steps = append(steps, rest[:end])
+			} else if rest != "" && rest[0] == '.' {
+				return nil, fmt.Errorf("json path %q has an empty key", path)
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q misses a ]", path)
+			}
+			n, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("json path %q: %s is not an array index", path, rest[1:end])
+			}
+			steps = append(steps, n)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("json path %q: expected . or [ before %q", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSON finds the value at path in doc. Negative indexes count from
+// the end of an array.
+func lookupJSON(doc any, path string) (any, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	at := ""
+	where := func() string {
+		if at == "" {
+			return "the document"
+		}
+		return at
+	}
+	for _, step := range steps {
+		switch step := step.(type) {
+		case string:
+			obj, ok := doc.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", where())
+			}
+			if doc, ok = obj[step]; !ok {
+				return nil, fmt.Errorf("%s has no %q", where(), step)
+			}
+			at += "." + step
+		case int:
+			list, ok := doc.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an array", where())
+			}
+			i := step
+			if i < 0 {
+				i += len(list)
+			}
+			if i < 0 || i >= len(list) {
+				return nil, fmt.Errorf("%s has %d items, not %d", where(), len(list), step)
+			}
+			doc = list[i]
+			at += fmt.Sprintf("[%d]", step)
+		}
+	}
+	return doc, nil
+}
+
+// checksView shows a block's expectations: waiting ones until the command
+// ran, then a badge per expectation, with what was found instead for the
+// ones that failed.
+func (m model) checksView(b Block) string {
+	if len(b.Assertions) == 0 {
+		return ""
+	}
+	if len(b.Checks) == 0 {
+		labels := make([]string, len(b.Assertions))
+		for i, a := range b.Assertions {
+			labels[i] = a.label()
+		}
+		return m.styles.Muted.Render("  ◇ expects " + strings.Join(labels, ", "))
+	}
+
+	var passed, failed []string
+	for _, c := range b.Checks {
+		if c.Passed {
+			passed = append(passed, m.styles.SuccessText.Render("✓ "+c.Expect))
+		} else {
+			failed = append(failed, m.styles.ErrorText.Render("  ✗ "+c.Expect)+m.styles.Muted.Render(": "+c.Got))
+		}
+	}
+	var lines []string
+	if len(passed) > 0 {
+		lines = append(lines, "  "+strings.Join(passed, "  "))
+	}
+	return strings.Join(append(lines, failed...), "\n")
+}
+
+// expectationSummary sums up the expectations of the blocks that have
+// any, or reports false when none have run.
+func expectationSummary(blocks []Block) (title, content string, ok bool) {
+	var lines []string
+	blocksPassed, blocksChecked, checks, passed := 0, 0, 0, 0
+	for _, b := range blocks {
+		if len(b.Checks) == 0 {
+			continue
+		}
+		blocksChecked++
+		var failures []string
+		for _, c := range b.Checks {
+			checks++
+			if c.Passed {
+				passed++
+			} else {
+				failures = append(failures, fmt.Sprintf("    ✗ %s: %s", c.Expect, c.Got))
+			}
+		}
+		name := fmt.Sprintf("#%s %s", b.ID, b.Title)
+		switch {
+		case len(failures) > 0:
+			lines = append(lines, fmt.Sprintf("✗ %s: %d of %d failed", name, len(failures), len(b.Checks)))
+			lines = append(lines, failures...)
+		case b.Type == BlockTypeError:
+			lines = append(lines, fmt.Sprintf("✗ %s: %s", name, b.failure()))
+		default:
+			blocksPassed++
+			lines = append(lines, fmt.Sprintf("✓ %s: %d passed", name, len(b.Checks)))
+		}
+	}
+	if blocksChecked == 0 {
+		return "", "", false
+	}
+	title = fmt.Sprintf("Expectations: %d of %d blocks passed", blocksPassed, blocksChecked)
+	lines = append([]string{fmt.Sprintf("%d of %d expectations held", passed, checks)}, lines...)
+	return title, strings.Join(lines, "\n"), true
+}
+
+// summarizeExpectations shows the summary of all expectations in a block
+// of its own, replacing the one shown before. It reports false when no
+// block has expectations that ran.
+func (m *model) summarizeExpectations() bool {
+	title, content, ok := expectationSummary(m.blocks)
+	if !ok {
+		return false
+	}
+	for i := range m.blocks {
+		if m.blocks[i].Metadata["summary"] == summaryExpectations {
+			m.blocks = append(m.blocks[:i], m.blocks[i+1:]...)
+			if m.selectedIdx > i || m.selectedIdx >= len(m.blocks) {
+				m.selectedIdx = max(m.selectedIdx-1, 0)
+			}
+			break
+		}
+	}
+	m.addInfoBlock(content)
+	b := &m.blocks[len(m.blocks)-1]
+	b.Title = title
+	b.Metadata["summary"] = summaryExpectations
+	return true
+}
+
+// showExpectationSummary is the palette action for the summary.
+func (m *model) showExpectationSummary() tea.Cmd {
+	if !m.summarizeExpectations() {
+		m.addInfoBlock("No block with expectations has run")
+	}
+	return nil
+}
+
+// openExpect asks for an expectation to add to the selected command.
+func (m *model) openExpect() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) || m.blocks[m.selectedIdx].Command == "" {
+		m.addInfoBlock("Select a command block to add an expectation to")
+		return nil
+	}
+	m.closeInput()
+	m.expectFor = m.blocks[m.selectedIdx].ID
+	m.inputMode = true
+	m.showInput = true
+	m.textInput.SetValue("")
+	return m.textInput.Focus()
+}
+
+// submitExpectation adds the expectation typed after openExpect. A command
+// that already ran is checked against it at once.
+func (m *model) submitExpectation(input string) {
+	id := m.expectFor
+	idx := m.blockIndex(id)
+	if strings.TrimSpace(input) == "" || idx < 0 {
+		m.closeInput()
+		return
+	}
+	a, err := parseAssertion(input)
+	if err != nil {
+		// Input stays open to fix the expectation
+		m.addInfoBlock("Expectation not added: " + err.Error())
+		m.selectBlock(idx)
+		return
+	}
+	m.textInput.SetValue("")
+	m.closeInput()
+
+	m.blocks[idx].Assertions = append(m.blocks[idx].Assertions, a)
+	m.recheck(idx)
+}
+
+// clearExpectations drops the expectations of the selected block.
+func (m *model) clearExpectations() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) || len(m.blocks[m.selectedIdx].Assertions) == 0 {
+		m.addInfoBlock("The selected block has no expectations")
+		return nil
+	}
+	m.blocks[m.selectedIdx].Assertions = nil
+	m.recheck(m.selectedIdx)
+	return nil
+}
+
+// recheck decides again whether the command of the block at index i
+// succeeded, after its expectations changed. Commands that did not finish
+// are checked once they do.
+func (m *model) recheck(i int) {
+	b := &m.blocks[i]
+	if b.Type != BlockTypeSuccess && b.Type != BlockTypeError || m.running(i) {
+		return
+	}
+	if b.ExitCode == 0 {
+		b.Type, b.Error = BlockTypeSuccess, ""
+	} else if b.Type = BlockTypeError; len(b.Checks) > 0 {
+		// The error may have been that of the expectations
+		b.Error = fmt.Sprintf("exit status %d", b.ExitCode)
+	}
+	checkAssertions(b)
+}
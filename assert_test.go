@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Assertion
+		wantErr string
+	}{
+		{line: "exit 0", want: Assertion{Kind: "exit", Value: "0"}},
+		{line: "  exit   3  ", want: Assertion{Kind: "exit", Value: "3"}},
+		{line: "contains ready to serve", want: Assertion{Kind: "contains", Value: "ready to serve"}},
+		{line: `contains "  padded\t"`, want: Assertion{Kind: "contains", Value: "  padded\t"}},
+		{line: `matches ^v\d+$`, want: Assertion{Kind: "matches", Value: `^v\d+$`}},
+		{line: `json .items[0].name = "web"`, want: Assertion{Kind: "json", Path: ".items[0].name", Value: `"web"`}},
+		{line: "json $.ok == true", want: Assertion{Kind: "json", Path: "$.ok", Value: "true"}},
+
+		{line: "exit zero", wantErr: "not an exit code"},
+		{line: "contains", wantErr: "needs text"},
+		{line: "matches (", wantErr: "missing closing )"},
+		{line: "json .status", wantErr: "PATH = VALUE"},
+		{line: "json status = up", wantErr: "does not start with"},
+		{line: "output ok", wantErr: "unknown expectation"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAssertion(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAssertion(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAssertion(%q) = %+v, %v, want %+v", tt.line, got, err, tt.want)
+			continue
+		}
+		// Written out, it reads back the same
+		if again, err := parseAssertion(got.String()); err != nil || again != got {
+			t.Errorf("%q written as %q reads back as %+v, %v", tt.line, got.String(), again, err)
+		}
+	}
+}
+
+func TestParseAssertionsLines(t *testing.T) {
+	list, err := parseAssertions("exit 0\n\ncontains ok\n", 10)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("got %v, %v", list, err)
+	}
+	if _, err := parseAssertions("exit 0\n\nsometimes\n", 10); err == nil || !strings.HasPrefix(err.Error(), "line 12:") {
+		t.Errorf("err = %v, want it on line 12", err)
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []any
+		wantErr string
+	}{
+		{path: ".", want: nil},
+		{path: "$", want: nil},
+		{path: ".a", want: []any{"a"}},
+		{path: "$.a.b", want: []any{"a", "b"}},
+		{path: ".items[2].name", want: []any{"items", 2, "name"}},
+		{path: "[0][-1]", want: []any{0, -1}},
+		{path: ".a[1]", want: []any{"a", 1}},
+
+		{path: "", wantErr: "does not start with"},
+		{path: "a.b", wantErr: "does not start with"},
+		{path: ".a..b", wantErr: "empty key"},
+		{path: ".a[1", wantErr: "misses a ]"},
+		{path: ".a[x]", wantErr: "not an array index"},
+		{path: ".a[1]b", wantErr: "expected . or ["},
+	}
+
+	for _, tt := range tests {
+		got, err := parseJSONPath(tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseJSONPath(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJSONPath(%q) = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupJSON(t *testing.T) {
+	doc := map[string]any{
+		"status": "up",
+		"items":  []any{map[string]any{"name": "web"}, map[string]any{"name": "db"}},
+		"count":  float64(2),
+	}
+
+	tests := []struct {
+		path    string
+		want    any
+		wantErr string
+	}{
+		{path: ".status", want: "up"},
+		{path: ".count", want: float64(2)},
+		{path: ".items[1].name", want: "db"},
+		{path: ".items[-1].name", want: "db"},
+		{path: ".", want: doc},
+
+		{path: ".missing", wantErr: `the document has no "missing"`},
+		{path: ".items[2]", wantErr: ".items has 2 items, not 2"},
+		{path: ".items[-3]", wantErr: "not -3"},
+		{path: ".status.x", wantErr: ".status is not an object"},
+		{path: ".items.name", wantErr: ".items is not an object"},
+		{path: "[0]", wantErr: "the document is not an array"},
+	}
+
+	for _, tt := range tests {
+		got, err := lookupJSON(doc, tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("lookupJSON(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupJSON(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	output := "starting\nversion 1.2\n{\"not\": \"json\"}"
+	jsonOutput := `{"status": "up", "ready": true, "pods": [1, 2]}`
+
+	tests := []struct {
+		line   string
+		output string
+		exit   int
+		passed bool
+		got    string
+	}{
+		{line: "exit 0", output: output, passed: true},
+		{line: "exit 0", output: output, exit: 2, got: "exit 2"},
+		{line: "contains version 1.2", output: output, passed: true},
+		{line: "contains 2.0", output: output, got: "not in the output"},
+		{line: `matches ^version \d+\.\d+$`, output: output, passed: true},
+		{line: "matches ^1.2", output: output, got: "no match in the output"},
+		{line: `json .status = "up"`, output: jsonOutput, passed: true},
+		{line: "json .status = up", output: jsonOutput, passed: true},
+		{line: "json .ready = true", output: jsonOutput, passed: true},
+		{line: "json .pods = [1,2]", output: jsonOutput, passed: true},
+		{line: "json .pods[0] = 2", output: jsonOutput, got: "1"},
+		{line: "json .status = up", output: output, got: "the output is not JSON"},
+		{line: "json .gone = 1", output: jsonOutput, got: `the document has no "gone"`},
+	}
+
+	for _, tt := range tests {
+		a, err := parseAssertion(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := a.check(tt.output, tt.exit)
+		if c.Passed != tt.passed || c.Got != tt.got {
+			t.Errorf("%q: passed %v got %q, want %v %q", tt.line, c.Passed, c.Got, tt.passed, tt.got)
+		}
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect string
+		exit   int
+		failed bool
+		err    string
+	}{
+		{name: "none", exit: 1, failed: true, err: "exit status 1"},
+		{name: "all hold", expect: "contains ok", failed: false},
+		{name: "one fails", expect: "contains ok\ncontains nope", failed: true, err: "1 of 2 expectations failed"},
+		{name: "exit code not named", expect: "contains ok", exit: 1, failed: true, err: "exit status 1"},
+		{name: "exit code named", expect: "exit 1\ncontains ok", exit: 1, failed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := parseAssertions(tt.expect, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := Block{Output: "ok\n", ExitCode: tt.exit, Type: BlockTypeSuccess, Assertions: list}
+			if tt.exit != 0 {
+				b.Type = BlockTypeError
+				b.Error = "exit status 1"
+			}
+			checkAssertions(&b)
+			if b.failed() != tt.failed || b.Error != tt.err {
+				t.Errorf("failed %v error %q, want %v %q", b.failed(), b.Error, tt.failed, tt.err)
+			}
+		})
+	}
+}
+
+func TestFinishAttemptTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect string
+		retry  bool
+		err    string
+	}{
+		{name: "timeout expected", expect: "exit 124", retry: false, err: ""},
+		{name: "success expected", expect: "exit 0", retry: true, err: "1 of 1 expectations failed"},
+		{name: "no expectations", retry: true, err: "timed out after 1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := parseAssertions(tt.expect, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := Block{
+				Command:    "sleep 10",
+				Metadata:   map[string]string{"executing": "1"},
+				Assertions: list,
+				Policy:     &RunPolicy{Timeout: time.Second, Retries: 1, Backoff: -1},
+			}
+			// Killed by the timeout, the command itself says SIGTERM
+			_, retry := model{}.finishAttempt(&b, "", errors.New("signal: terminated"), time.Now(), 1, true, false)
+			if b.ExitCode != exitTimedOut {
+				t.Errorf("exit code %d, want %d", b.ExitCode, exitTimedOut)
+			}
+			if retry != tt.retry || b.Error != tt.err {
+				t.Errorf("retry %v error %q, want %v %q", retry, b.Error, tt.retry, tt.err)
+			}
+			if len(b.Attempts) != 1 || !b.Attempts[0].TimedOut || b.Attempts[0].ExitCode != exitTimedOut {
+				t.Errorf("attempts = %+v", b.Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// command is a gbloxs subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{"run", "[-f FILE]... COMMAND [ARG]...", "open with COMMAND running in a block", runRun},
+		{"exec", "[--script FILE] [--color WHEN] [--width N] [--keep-going] [--] [COMMAND [ARG]...]", "run commands without the UI and print their blocks", runExec},
+		{"open", "[-f FILE]... FILE", "open a runbook (.md) or notebook (.gbx)", runOpen},
+		{"shell", "[SHELL]", "host your shell and split it into blocks", runShell},
+		{"shell-integration", "bash|zsh|fish", "print the prompt markers script for a shell", runShellIntegration},
+		{"ls", "[--json]", "list saved sessions, newest first", runLs},
+		{"export", "[--format md|gbx|json] [-o FILE] SESSION", "write a saved session as Markdown, a notebook or JSON", runExport},
+		{"replay", "[--no-run] SESSION", "open a saved session and run its commands again", runReplay},
+		{"send", "[--socket PATH] OP [ARGS]", "post blocks to a running gbloxs", runSend},
+		{"help", "[COMMAND]", "show help for gbloxs or a command", runHelp},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands() {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// usage prints the commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gbloxs [-f FILE]... [--follow]")
+	fmt.Fprintln(w, "       command | gbloxs")
+	fmt.Fprintln(w, "       gbloxs COMMAND [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Options:")
+	fmt.Fprintln(w, "  -f, --file FILE  read FILE into a block; may be repeated")
+	fmt.Fprintln(w, "  -F, --follow     keep reading the files as they grow, like tail -f")
+	fmt.Fprintln(w, "  --script FILE    run the commands in FILE without the UI; see gbloxs help exec")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "SESSION is a file, the name of a saved session, or last.")
+	fmt.Fprintln(w, "Run gbloxs help COMMAND for a command's options.")
+}
+
+// commandUsage prints a subcommand's usage and options, for its -h.
+func commandUsage(flags *flag.FlagSet) func() {
+	return func() {
+		c, _ := findCommand(flags.Name())
+		fmt.Fprintf(os.Stderr, "usage: gbloxs %s %s\n\n%s\n", c.name, c.args, c.summary)
+		defined := false
+		flags.VisitAll(func(*flag.Flag) { defined = true })
+		if defined {
+			fmt.Fprintln(os.Stderr, "\nOptions:")
+			flags.PrintDefaults()
+		}
+	}
+}
+
+// flagStatus is the exit status after a flag parsing error: success when
+// the user asked for help.
+func flagStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// runCLI runs gbloxs with the command line arguments and returns the exit
+// status.
+func runCLI(args []string) int {
+	flags := flag.NewFlagSet("gbloxs", flag.ContinueOnError)
+	flags.Usage = func() { usage(os.Stderr) }
+	var streams streamFlags
+	streams.register(flags)
+	script := flags.String("script", "", "")
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	args = flags.Args()
+
+	if *script != "" {
+		// gbloxs --script FILE is short for gbloxs exec --script FILE
+		return runExec(append([]string{"--script", *script}, args...))
+	}
+	if len(args) == 0 {
+		sources, err := streams.sources()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs:", err)
+			return 2
+		}
+		m := initialModel()
+		if len(sources) > 0 {
+			m = newModel(nil)
+		}
+		m.addAlertRules(streams.alerts)
+		return runTUI(m, sources)
+	}
+
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gbloxs: unknown command %q\n\n", args[0])
+		usage(os.Stderr)
+		return 2
+	}
+	if len(streams.files) > 0 || len(streams.alertFlags) > 0 {
+		// Options given before the command apply to it
+		var opts []string
+		for _, f := range streams.files {
+			opts = append(opts, "-f", f)
+		}
+		for _, a := range streams.alertFlags {
+			opts = append(opts, "--alert", a)
+		}
+		if streams.follow {
+			opts = append(opts, "--follow")
+		}
+		args = append(args[:1:1], append(opts, args[1:]...)...)
+	}
+	return c.run(args[1:])
+}
+
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return 0
+	}
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gbloxs: unknown command %q\n", args[0])
+		return 2
+	}
+	if c.name == "help" {
+		return runHelp(nil)
+	}
+	c.run([]string{"-h"})
+	return 0
+}
+
+// startupMsg is what the UI does once it is up: run a command, or run the
+// steps of a replayed session.
+type startupMsg struct {
+	input    string
+	runSteps bool
+}
+
+// runTUI runs the UI until the user quits and saves the session.
+func runTUI(m model, sources []streamSource) int {
+	started := time.Now()
+	piped := false
+	ids := make([]string, len(sources))
+	for i, src := range sources {
+		ids[i] = m.addStreamBlock(src)
+		piped = piped || src.path == ""
+	}
+
+	control, err := listenControl(m.config.Control)
+	if err != nil {
+		m.addInfoBlock("Control socket disabled: " + err.Error())
+	}
+
+	opts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}
+	if piped {
+		// stdin is data, so keys come from the terminal
+		opts = append(opts, tea.WithInputTTY())
+	}
+	p := tea.NewProgram(m, opts...)
+	for i, src := range sources {
+		go readStream(p, ids[i], src)
+	}
+	if control != nil {
+		go serveControl(p, control)
+	}
+	if m.shell != nil {
+		go readShell(p, m.shell)
+	}
+
+	final, err := p.Run()
+	if final, ok := final.(model); ok {
+		final.stopJobs()
+	}
+	if m.shell != nil {
+		m.shell.close()
+	}
+	if control != nil {
+		// Closing also removes the socket file
+		control.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if final, ok := final.(model); ok {
+		if _, err := saveSession(final, started); err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs: saving the session:", err)
+		}
+	}
+	return 0
+}
+
+// isDocument reports whether path names a runbook or notebook.
+func isDocument(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", notebookExt:
+		return true
+	}
+	return false
+}
+
+// openDocument loads a runbook or notebook into a new model.
+func openDocument(path string) (model, error) {
+	if strings.EqualFold(filepath.Ext(path), notebookExt) {
+		nb, blocks, err := loadNotebook(path)
+		if err != nil {
+			return model{}, err
+		}
+		m := newModel(blocks)
+		m.notebook = nb
+		return m, nil
+	}
+	rb, blocks, err := loadRunbook(path)
+	if err != nil {
+		return model{}, err
+	}
+	m := newModel(blocks)
+	m.runbook = rb
+	return m, nil
+}
+
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	var streams streamFlags
+	streams.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	sources, err := streams.sources()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs run:", err)
+		return 2
+	}
+
+	// gbloxs run used to open documents and still does for a single file.
+	// A notebook need not exist yet; it is created on the first save.
+	if len(args) == 1 && isDocument(args[0]) {
+		_, err := os.Stat(args[0])
+		if err == nil || strings.EqualFold(filepath.Ext(args[0]), notebookExt) {
+			m, err := openDocument(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "gbloxs run:", err)
+				return 1
+			}
+			m.addAlertRules(streams.alerts)
+			return runTUI(m, sources)
+		}
+	}
+
+	input := args[0]
+	if len(args) > 1 {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		input = strings.Join(quoted, " ")
+	}
+	m := newModel(nil)
+	m.startup = &startupMsg{input: "!" + input}
+	m.addAlertRules(streams.alerts)
+	return runTUI(m, sources)
+}
+
+func runOpen(args []string) int {
+	flags := flag.NewFlagSet("open", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	var streams streamFlags
+	streams.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	sources, err := streams.sources()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs open:", err)
+		return 2
+	}
+	m, err := openDocument(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs open:", err)
+		return 1
+	}
+	m.addAlertRules(streams.alerts)
+	return runTUI(m, sources)
+}
+
+func runShell(args []string) int {
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	m := newModel(nil)
+	shell, err := startShell(flags.Arg(0), m.cwd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs shell:", err)
+		return 1
+	}
+	m.shell = shell
+	m.inputMode = true
+	m.showInput = true
+	return runTUI(m, nil)
+}
+
+func runShellIntegration(args []string) int {
+	if len(args) != 1 || args[0] == "-h" || args[0] == "--help" {
+		c, _ := findCommand("shell-integration")
+		fmt.Fprintf(os.Stderr, "usage: gbloxs %s %s\n\n%s\n", c.name, c.args, c.summary)
+		return 2
+	}
+	return printShellIntegration(args[0])
+}
+
+func runLs(args []string) int {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	asJSON := flags.Bool("json", false, "print the sessions as JSON")
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	sessions, err := listSessions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs ls:", err)
+		return 1
+	}
+	if *asJSON {
+		if sessions == nil {
+			sessions = []sessionInfo{}
+		}
+		printJSON(sessions)
+		return 0
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintln(os.Stderr, "No saved sessions in", sessionsDir())
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tBLOCKS\tCOMMANDS\tFAILED\tFIRST COMMAND")
+	for _, s := range sessions {
+		first, _, _ := strings.Cut(s.First, "\n")
+		if len([]rune(first)) > 50 {
+			first = string([]rune(first)[:49]) + "…"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", s.Name, s.Blocks, s.Commands, s.Failed, first)
+	}
+	tw.Flush()
+	return 0
+}
+
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	format := flags.String("format", "md", "md, gbx or json")
+	out := flags.String("o", "", "write to FILE instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path, err := findSession(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs export:", err)
+		return 1
+	}
+	blocks, err := openSession(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs export:", err)
+		return 1
+	}
+
+	var text string
+	switch *format {
+	case "md", "markdown":
+		text = renderMarkdown(blocks)
+	case "gbx", "notebook":
+		text = renderNotebook(blocks)
+	case "json":
+		list := make([]controlBlock, len(blocks))
+		for i, b := range blocks {
+			list[i] = toControlBlock(b)
+		}
+		data, _ := json.MarshalIndent(list, "", "  ")
+		text = string(data) + "\n"
+	default:
+		fmt.Fprintf(os.Stderr, "gbloxs export: unknown format %q; use md, gbx or json\n", *format)
+		return 2
+	}
+
+	if *out == "" {
+		fmt.Print(text)
+		return 0
+	}
+	if err := os.WriteFile(*out, []byte(text), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs export:", err)
+		return 1
+	}
+	return 0
+}
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	noRun := flags.Bool("no-run", false, "open the session without running it")
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path, err := findSession(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs replay:", err)
+		return 1
+	}
+	blocks, err := openSession(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs replay:", err)
+		return 1
+	}
+
+	// Loading makes the commands steps; the saved output stays until a step
+	// replaces it
+	m := newModel(blocks)
+	if !*noRun {
+		m.startup = &startupMsg{runSteps: true}
+	}
+	return runTUI(m, nil)
+}
+
+// openSession reads a saved session, which is a notebook, or a runbook
+// given by path.
+func openSession(path string) ([]Block, error) {
+	var blocks []Block
+	var err error
+	if strings.EqualFold(filepath.Ext(path), notebookExt) {
+		_, blocks, err = loadNotebook(path)
+	} else {
+		_, blocks, err = loadRunbook(path)
+	}
+	return blocks, err
+}
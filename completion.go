@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// completionRows is how many candidates the completion popup shows.
+const completionRows = 10
+
+// candidateKind says where a completion candidate came from.
+type candidateKind string
+
+const (
+	candidateCommand candidateKind = "cmd"
+	candidateDir     candidateKind = "dir"
+	candidateFile    candidateKind = "file"
+	candidateBranch  candidateKind = "branch"
+	candidateHistory candidateKind = "history"
+)
+
+type candidate struct {
+	text string
+	kind candidateKind
+}
+
+// completion is the state of the Tab completion popup. start and end are
+// the rune range of the input that the selected candidate replaces.
+type completion struct {
+	active     bool
+	candidates []candidate
+	cursor     int
+	start, end int
+}
+
+// shellBuiltins are offered alongside $PATH executables as first words.
+var shellBuiltins = []string{"cd", "export", "source", "unset", "alias", "type"}
+
+// gitBranchCommands take a branch name as argument.
+var gitBranchCommands = map[string]bool{
+	"checkout": true,
+	"switch":   true,
+	"merge":    true,
+	"rebase":   true,
+}
+
+// complete handles Tab in input mode. The first press inserts the longest
+// prefix all candidates share and opens the popup when there is more than
+// one; later presses cycle through the candidates.
+func (m *model) complete(step int) {
+	if m.completion.active {
+		n := len(m.completion.candidates)
+		m.completion.cursor = ((m.completion.cursor+step)%n + n) % n
+		m.insertCandidate(m.completion.candidates[m.completion.cursor].text)
+		return
+	}
+
+	value := []rune(m.textInput.Value())
+	pos := m.textInput.Position()
+	if pos > len(value) {
+		pos = len(value)
+	}
+
+	// The command starts after the /cmd or !cmd prefix
+	lineStart := 0
+	if len(value) > 0 && (value[0] == '/' || value[0] == '!') {
+		lineStart = 1
+	}
+
+	start := pos
+	for start > lineStart && value[start-1] != ' ' && value[start-1] != '\t' {
+		start--
+	}
+	words := strings.Fields(string(value[lineStart:start]))
+	token := string(value[start:pos])
+
+	candidates := m.completionCandidates(words, token)
+	if len(candidates) == 0 {
+		return
+	}
+
+	m.completion = completion{candidates: candidates, cursor: -1, start: start, end: pos}
+	if len(candidates) == 1 {
+		m.insertCandidate(candidates[0].text)
+		m.completion.active = false
+		return
+	}
+
+	texts := make([]string, len(candidates))
+	for i, c := range candidates {
+		texts[i] = c.text
+	}
+	if prefix := commonPrefix(texts); len(prefix) > len(token) {
+		m.insertCandidate(prefix)
+	}
+	m.completion.active = true
+}
+
+// insertCandidate replaces the completed token with text.
+func (m *model) insertCandidate(text string) {
+	value := []rune(m.textInput.Value())
+	c := &m.completion
+
+	updated := string(value[:c.start]) + text + string(value[c.end:])
+	c.end = c.start + len([]rune(text))
+	m.textInput.SetValue(updated)
+	m.textInput.SetCursor(c.end)
+}
+
+func (m *model) closeCompletion() {
+	m.completion = completion{}
+}
+
+// updateCompletion handles keys while the popup is open and reports whether
+// the key was consumed. Any other key closes the popup and is handled as
+// usual.
+func (m *model) updateCompletion(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, m.keys.Complete):
+		m.complete(1)
+	case key.Matches(msg, m.keys.CompletePrev, m.keys.HistoryPrev):
+		m.complete(-1)
+	case key.Matches(msg, m.keys.HistoryNext):
+		m.complete(1)
+	case key.Matches(msg, m.keys.Cancel), key.Matches(msg, m.keys.Submit):
+		// Keep whatever was inserted; Enter does not submit yet
+		m.closeCompletion()
+	default:
+		m.closeCompletion()
+		return false
+	}
+	return true
+}
+
+// completionCandidates picks the candidate sources for the token being
+// typed based on the words before it.
+func (m *model) completionCandidates(words []string, token string) []candidate {
+	var candidates []candidate
+
+	if len(words) == 0 && !strings.ContainsRune(token, '/') {
+		for _, name := range m.commandNames() {
+			if strings.HasPrefix(name, token) {
+				candidates = append(candidates, candidate{name, candidateCommand})
+			}
+		}
+		return candidates
+	}
+
+	if len(words) >= 2 && words[0] == "git" && gitBranchCommands[words[1]] {
+		for _, branch := range gitBranches(m.cwd) {
+			if strings.HasPrefix(branch, token) {
+				candidates = append(candidates, candidate{branch, candidateBranch})
+			}
+		}
+	}
+
+	onlyDirs := len(words) == 1 && words[0] == "cd"
+	candidates = append(candidates, pathCandidates(m.cwd, token, onlyDirs)...)
+
+	if len(words) > 0 {
+		candidates = append(candidates, m.historyArguments(words[0], token)...)
+	}
+
+	return dedupCandidates(candidates)
+}
+
+// commandNames lists shell builtins and every executable on $PATH. The
+// scan runs once per session.
+func (m *model) commandNames() []string {
+	if m.pathCommands != nil {
+		return m.pathCommands
+	}
+
+	seen := make(map[string]bool)
+	names := append([]string(nil), shellBuiltins...)
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if seen[e.Name()] || e.IsDir() {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || info.Mode()&0o111 == 0 {
+				continue
+			}
+			seen[e.Name()] = true
+			names = append(names, e.Name())
+		}
+	}
+
+	sort.Strings(names)
+	m.pathCommands = names
+	return names
+}
+
+// pathCandidates lists files and directories matching a partial path,
+// relative to cwd unless absolute or starting with ~.
+func pathCandidates(cwd, token string, onlyDirs bool) []candidate {
+	dirPart, base := "", token
+	if i := strings.LastIndex(token, "/"); i >= 0 {
+		dirPart, base = token[:i+1], token[i+1:]
+	}
+
+	dir := expandHome(dirPart)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []candidate
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if onlyDirs && !isDir {
+			continue
+		}
+
+		text := dirPart + strings.ReplaceAll(name, " ", `\ `)
+		if isDir {
+			candidates = append(candidates, candidate{text + "/", candidateDir})
+		} else {
+			candidates = append(candidates, candidate{text, candidateFile})
+		}
+	}
+	return candidates
+}
+
+// gitBranches lists local and remote branches of the repository at cwd.
+func gitBranches(cwd string) []string {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes")
+	cmd.Dir = cwd
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	var branches []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" && !strings.HasSuffix(line, "/HEAD") {
+			branches = append(branches, line)
+		}
+	}
+	return branches
+}
+
+// historyArguments offers arguments previously passed to the same command,
+// newest first.
+func (m *model) historyArguments(command, token string) []candidate {
+	var candidates []candidate
+
+	for i := len(m.history.entries) - 1; i >= 0; i-- {
+		fields := strings.Fields(strings.TrimLeft(m.history.entries[i].Command, "/!"))
+		if len(fields) < 2 || fields[0] != command {
+			continue
+		}
+		for _, arg := range fields[1:] {
+			if arg != token && strings.HasPrefix(arg, token) {
+				candidates = append(candidates, candidate{arg, candidateHistory})
+			}
+		}
+	}
+	return candidates
+}
+
+func dedupCandidates(candidates []candidate) []candidate {
+	seen := make(map[string]bool)
+	unique := candidates[:0]
+	for _, c := range candidates {
+		if !seen[c.text] {
+			seen[c.text] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+func commonPrefix(texts []string) string {
+	if len(texts) == 0 {
+		return ""
+	}
+	prefix := []rune(texts[0])
+	for _, t := range texts[1:] {
+		for !strings.HasPrefix(t, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return string(prefix)
+}
+
+// renderCompletion draws the candidate popup shown above the input box.
+func (m model) renderCompletion() string {
+	c := m.completion
+	var b strings.Builder
+
+	first := 0
+	if c.cursor >= completionRows {
+		first = c.cursor - completionRows + 1
+	}
+
+	for i := first; i < len(c.candidates) && i < first+completionRows; i++ {
+		if i > first {
+			b.WriteString("\n")
+		}
+		cand := c.candidates[i]
+		if i == c.cursor {
+			b.WriteString(m.styles.TableSelectedRow.Render("▶ " + cand.text))
+		} else {
+			b.WriteString("  " + cand.text)
+		}
+		b.WriteString(m.styles.Muted.Render("  " + string(cand.kind)))
+	}
+
+	if hidden := len(c.candidates) - completionRows; hidden > 0 {
+		b.WriteString("\n" + m.styles.Muted.Render(fmt.Sprintf("  … %d more", hidden)))
+	}
+
+	return m.styles.HelpOverlay.Copy().
+		Padding(0, 1).
+		Render(b.String())
+}
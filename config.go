@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the user configuration read from config.yaml in the config
+// directory. Every section is optional; anything left out keeps its default.
+type Config struct {
+	// Keys maps an action name to the keys that trigger it, replacing the
+	// default keys for that action. An empty list unbinds the action.
+	Keys map[string][]string `yaml:"keys"`
+
+	// Theme names a preset or a file in the themes directory. Empty or
+	// "auto" picks dark or light from the terminal background.
+	Theme string `yaml:"theme"`
+
+	History HistoryConfig `yaml:"history"`
+
+	Workflows WorkflowsConfig `yaml:"workflows"`
+
+	Control ControlConfig `yaml:"control"`
+
+	Sessions SessionsConfig `yaml:"sessions"`
+
+	Notify NotifyConfig `yaml:"notify"`
+
+	StatusBar StatusBarConfig `yaml:"status_bar"`
+
+	Jobs JobsConfig `yaml:"jobs"`
+
+	// Alerts mark lines of running commands and streams that match.
+	Alerts []AlertRule `yaml:"alerts"`
+}
+
+// HistoryConfig controls the input history.
+type HistoryConfig struct {
+	// File overrides the history location in the state directory.
+	File string `yaml:"file"`
+	// MaxEntries caps how many entries are kept; 0 means the default.
+	MaxEntries int `yaml:"max_entries"`
+	// ImportShell seeds the history with ~/.bash_history and ~/.zsh_history.
+	ImportShell bool `yaml:"import_shell_history"`
+}
+
+// WorkflowsConfig controls where workflow files are read from.
+type WorkflowsConfig struct {
+	// Dirs are read in addition to the workflows directory of the config
+	// dir, e.g. a checkout of a team's shared workflows.
+	Dirs []string `yaml:"dirs"`
+}
+
+// ControlConfig controls the socket other processes post blocks through.
+type ControlConfig struct {
+	// Socket overrides the socket path; "off" disables the socket.
+	Socket string `yaml:"socket"`
+}
+
+// SessionsConfig controls the sessions saved for gbloxs ls, export and
+// replay.
+type SessionsConfig struct {
+	// Disabled stops saving sessions.
+	Disabled bool `yaml:"disabled"`
+	// Keep is how many sessions are kept; 0 means the default.
+	Keep int `yaml:"keep"`
+}
+
+// NotifyConfig controls the notifications for long commands.
+type NotifyConfig struct {
+	// After is how long a command runs before its end is notified, such as
+	// "30s"; empty means the default and "off" turns notifications off.
+	After string `yaml:"after"`
+	// Via lists how to notify: bell, osc9, osc777 and command. Left out it
+	// is the bell; an empty list notifies nowhere.
+	Via []string `yaml:"via"`
+	// Command is run by sh when Via has command, with the notification in
+	// GBLOXS_TITLE, GBLOXS_STATUS, GBLOXS_EXIT and GBLOXS_DURATION.
+	Command string `yaml:"command"`
+}
+
+// StatusBarConfig lays out the status bar above the key hints.
+type StatusBarConfig struct {
+	// Left and Right are formats naming segments in braces, such as
+	// "{cwd} {git}". Leaving both out uses the default layout.
+	Left  string `yaml:"left"`
+	Right string `yaml:"right"`
+	// Clock is the Go time layout of the clock segment.
+	Clock string `yaml:"clock"`
+	// Colors overrides the theme color of segments, by name.
+	Colors map[string]string `yaml:"colors"`
+	// Disabled hides the status bar.
+	Disabled bool `yaml:"disabled"`
+}
+
+// JobsConfig controls how many commands run at once and what run all does
+// when a step fails.
+type JobsConfig struct {
+	// MaxParallel caps how many commands run at the same time; the others
+	// wait in a queue. 0 means no limit.
+	MaxParallel int `yaml:"max_parallel"`
+	// OnFailure is what run all does when a step fails: stop starts no more
+	// steps, kill also stops the running ones, continue runs the rest.
+	OnFailure string `yaml:"on_failure"`
+	// Timeout stops commands that run longer, such as "30s"; empty means
+	// no timeout. Notebook cells and runbook steps can set their own.
+	Timeout string `yaml:"timeout"`
+	// Retries is how often a failed command is run again.
+	Retries int `yaml:"retries"`
+	// Backoff is the wait before the first retry, doubling after each;
+	// empty means 1s.
+	Backoff string `yaml:"backoff"`
+}
+
+// configDir is $XDG_CONFIG_HOME/gbloxs, falling back to ~/.config/gbloxs.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gbloxs")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".config", "gbloxs")
+	}
+	return filepath.Join(home, ".config", "gbloxs")
+}
+
+// stateDir is $XDG_STATE_HOME/gbloxs, falling back to ~/.local/state/gbloxs.
+// It holds data gbloxs writes itself, such as the input history.
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "gbloxs")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".local", "state", "gbloxs")
+	}
+	return filepath.Join(home, ".local", "state", "gbloxs")
+}
+
+// runtimeDir is $XDG_RUNTIME_DIR/gbloxs, falling back to a directory per
+// user in the temp dir. It holds the control sockets.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gbloxs")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gbloxs-%d", os.Getuid()))
+}
+
+func configPath() string {
+	return filepath.Join(configDir(), "config.yaml")
+}
+
+// loadConfig reads the config file. A missing file is not an error.
+func loadConfig() (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", configPath(), err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Other processes post blocks to a running gbloxs through a Unix socket.
+// Each line sent is a JSON request and gets a JSON response line back:
+//
+//	{"op": "create", "block": {"type": "success", "title": "CI", "content": "passed"}}
+//	{"op": "progress", "id": "7", "progress": 0.5}
+//	{"op": "append", "id": "7", "output": "more output\n"}
+//	{"op": "metadata", "id": "7", "metadata": {"branch": "main"}}
+//	{"op": "get", "id": "7"}
+//	{"op": "get"}
+//
+//	{"ok": true, "id": "7"}
+//	{"ok": false, "error": "block 9 does not exist"}
+//
+// Requests are handed to the program with p.Send, so they are applied
+// between key presses like any other message. Commands run from gbloxs
+// find the socket in $GBLOXS_SOCKET.
+
+// socketEnv names the environment variable holding the socket path.
+const socketEnv = "GBLOXS_SOCKET"
+
+// controlTimeout bounds how long a request waits for the UI to apply it.
+const controlTimeout = 5 * time.Second
+
+type controlRequest struct {
+	Op       string            `json:"op"`
+	ID       string            `json:"id,omitempty"`
+	Block    *controlBlock     `json:"block,omitempty"`
+	Progress *float64          `json:"progress,omitempty"`
+	Output   string            `json:"output,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type controlResponse struct {
+	OK     bool           `json:"ok"`
+	Error  string         `json:"error,omitempty"`
+	ID     string         `json:"id,omitempty"`
+	Blocks []controlBlock `json:"blocks,omitempty"`
+}
+
+// controlBlock is a block as the control API sends and receives it.
+type controlBlock struct {
+	ID        string            `json:"id,omitempty"`
+	Type      BlockType         `json:"type,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Content   string            `json:"content,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Output    string            `json:"output,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	ExitCode  int               `json:"exit_code"`
+	Progress  float64           `json:"progress"`
+	Loading   bool              `json:"loading"`
+	Table     [][]string        `json:"table,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Attempts  []Attempt         `json:"attempts,omitempty"`
+	Checks    []Check           `json:"checks,omitempty"`
+}
+
+// controlMsg is a request from the socket waiting for the UI to apply it.
+type controlMsg struct {
+	req   controlRequest
+	reply chan controlResponse
+}
+
+var blockTypes = map[BlockType]bool{
+	BlockTypeCommand: true, BlockTypeOutput: true, BlockTypeTable: true, BlockTypeProgress: true,
+	BlockTypeInfo: true, BlockTypeError: true, BlockTypeSuccess: true,
+}
+
+// toControlBlock copies a block for a reply. The reply is encoded on the
+// connection's goroutine while Update goes on changing the block, so
+// nothing in it may share memory with the block.
+func toControlBlock(b Block) controlBlock {
+	var table [][]string
+	for _, row := range b.TableData {
+		table = append(table, slices.Clone(row))
+	}
+	return controlBlock{
+		ID:        b.ID,
+		Type:      b.Type,
+		Title:     b.Title,
+		Content:   b.Content,
+		Command:   b.Command,
+		Output:    b.Output,
+		Error:     b.Error,
+		ExitCode:  b.ExitCode,
+		Progress:  b.Progress,
+		Loading:   b.IsLoading,
+		Table:     table,
+		Metadata:  maps.Clone(b.Metadata),
+		Timestamp: b.Timestamp,
+		Attempts:  slices.Clone(b.Attempts),
+		Checks:    slices.Clone(b.Checks),
+	}
+}
+
+// handleControl applies a request to the session. New blocks do not take
+// the selection, so posting from a script does not disturb the user.
+func (m *model) handleControl(req controlRequest) controlResponse {
+	fail := func(format string, args ...any) controlResponse {
+		return controlResponse{Error: fmt.Sprintf(format, args...)}
+	}
+
+	if req.Op == "create" {
+		if req.Block == nil {
+			return fail("create needs a block")
+		}
+		cb := *req.Block
+		if cb.Type == "" {
+			cb.Type = BlockTypeInfo
+		}
+		if !blockTypes[cb.Type] {
+			return fail("unknown block type %q", cb.Type)
+		}
+		if cb.Title == "" {
+			cb.Title = strings.ToUpper(string(cb.Type[:1])) + string(cb.Type[1:])
+		}
+		b := Block{
+			ID:        m.newBlockID(),
+			Title:     cb.Title,
+			Content:   cb.Content,
+			Type:      cb.Type,
+			Expanded:  true,
+			Progress:  min(max(cb.Progress, 0), 1),
+			IsLoading: cb.Loading,
+			Metadata:  make(map[string]string),
+			Timestamp: time.Now(),
+			Command:   cb.Command,
+			Output:    cb.Output,
+			Error:     cb.Error,
+			ExitCode:  cb.ExitCode,
+			TableData: cb.Table,
+			Viewport:  viewport.New(m.width-10, 10),
+		}
+		for k, v := range cb.Metadata {
+			b.Metadata[k] = v
+		}
+		b.Viewport.SetContent(b.Output)
+		m.blocks = append(m.blocks, b)
+		return controlResponse{OK: true, ID: b.ID}
+	}
+
+	if req.Op == "get" && req.ID == "" {
+		resp := controlResponse{OK: true}
+		for _, b := range m.blocks {
+			resp.Blocks = append(resp.Blocks, toControlBlock(b))
+		}
+		return resp
+	}
+
+	idx := -1
+	for i := range m.blocks {
+		if m.blocks[i].ID == req.ID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return fail("block %q does not exist", req.ID)
+	}
+	b := &m.blocks[idx]
+
+	switch req.Op {
+	case "get":
+		return controlResponse{OK: true, ID: b.ID, Blocks: []controlBlock{toControlBlock(*b)}}
+
+	case "progress":
+		if req.Progress == nil {
+			return fail("progress needs a progress value between 0 and 1")
+		}
+		b.Progress = min(max(*req.Progress, 0), 1)
+		if b.Progress >= 1 {
+			b.IsLoading = false
+		}
+
+	case "append":
+		appendOutput(b, req.Output)
+
+	case "metadata":
+		if b.Metadata == nil {
+			b.Metadata = make(map[string]string)
+		}
+		for k, v := range req.Metadata {
+			if v == "" {
+				delete(b.Metadata, k)
+			} else {
+				b.Metadata[k] = v
+			}
+		}
+
+	default:
+		return fail("unknown op %q", req.Op)
+	}
+	return controlResponse{OK: true, ID: b.ID}
+}
+
+// socketPath is where this process listens, unless config says otherwise.
+func socketPath(cfg ControlConfig) string {
+	if cfg.Socket != "" {
+		return expandHome(cfg.Socket)
+	}
+	return filepath.Join(runtimeDir(), fmt.Sprintf("gbloxs-%d.sock", os.Getpid()))
+}
+
+// listenControl opens the control socket and exports its path to the
+// commands gbloxs runs. It returns nil when the socket is turned off.
+func listenControl(cfg ControlConfig) (net.Listener, error) {
+	if cfg.Socket == "off" {
+		return nil, nil
+	}
+	path := socketPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if cfg.Socket == "" {
+		if err := checkPrivateDir(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use by another gbloxs", path)
+	}
+	// A socket left behind by a gbloxs that crashed; anything else at the
+	// path is not ours to remove
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	os.Setenv(socketEnv, path)
+	return l, nil
+}
+
+// serveControl accepts connections until l is closed.
+func serveControl(p *tea.Program, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go serveControlConn(p, conn)
+	}
+}
+
+func serveControlConn(p *tea.Program, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req controlRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			enc.Encode(controlResponse{Error: "invalid request: " + err.Error()})
+			continue
+		}
+
+		reply := make(chan controlResponse, 1)
+		p.Send(controlMsg{req: req, reply: reply})
+		select {
+		case resp := <-reply:
+			enc.Encode(resp)
+		case <-time.After(controlTimeout):
+			enc.Encode(controlResponse{Error: "gbloxs did not answer in time"})
+		}
+	}
+}
+
+// findSocket is the socket gbloxs send talks to: $GBLOXS_SOCKET inside
+// gbloxs, otherwise the most recently started gbloxs that still listens.
+func findSocket() (string, error) {
+	if path := os.Getenv(socketEnv); path != "" {
+		return path, nil
+	}
+	if cfg, err := loadConfig(); err == nil && cfg.Control.Socket != "" && cfg.Control.Socket != "off" {
+		return expandHome(cfg.Control.Socket), nil
+	}
+
+	dir := runtimeDir()
+	if err := checkPrivateDir(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("not looking for a running gbloxs: %w", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "gbloxs-*.sock"))
+	sort.Slice(matches, func(i, j int) bool {
+		a, _ := os.Stat(matches[i])
+		b, _ := os.Stat(matches[j])
+		return a != nil && b != nil && a.ModTime().After(b.ModTime())
+	})
+	for _, path := range matches {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return path, nil
+		}
+	}
+	return "", errors.New("no running gbloxs found; set " + socketEnv + " or use --socket")
+}
+
+const sendUsage = `usage: gbloxs send [--socket PATH] OP [ARGS]
+
+  create [--type TYPE] [--title TITLE] [--content TEXT] [--output TEXT]
+         [--progress N] [--meta KEY=VALUE]...    print the new block's ID
+  progress ID VALUE                             set progress, 0 to 1
+  append ID [TEXT]                              append TEXT, or stdin, to the output
+  meta ID KEY=VALUE...                          set metadata; KEY= removes it
+  get [ID]                                      print one block or all as JSON
+  json                                          send JSON requests read from stdin`
+
+// runSend is gbloxs send, the command line client of the control socket.
+func runSend(args []string) int {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, sendUsage) }
+	socket := flags.String("socket", "", "path of the control socket")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var reqs []controlRequest
+	op, args := args[0], args[1:]
+	switch op {
+	case "create":
+		req, err := createRequest(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+			return 2
+		}
+		reqs = append(reqs, req)
+
+	case "progress":
+		if len(args) != 2 {
+			flags.Usage()
+			return 2
+		}
+		value, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs send: progress:", err)
+			return 2
+		}
+		reqs = append(reqs, controlRequest{Op: op, ID: args[0], Progress: &value})
+
+	case "append":
+		if len(args) < 1 || len(args) > 2 {
+			flags.Usage()
+			return 2
+		}
+		text := ""
+		if len(args) == 2 && args[1] != "-" {
+			text = args[1] + "\n"
+		} else {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+				return 1
+			}
+			text = string(data)
+		}
+		reqs = append(reqs, controlRequest{Op: op, ID: args[0], Output: text})
+
+	case "meta":
+		if len(args) < 2 {
+			flags.Usage()
+			return 2
+		}
+		meta, err := keyValues(args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+			return 2
+		}
+		reqs = append(reqs, controlRequest{Op: "metadata", ID: args[0], Metadata: meta})
+
+	case "get":
+		if len(args) > 1 {
+			flags.Usage()
+			return 2
+		}
+		req := controlRequest{Op: op}
+		if len(args) == 1 {
+			req.ID = args[0]
+		}
+		reqs = append(reqs, req)
+
+	case "json":
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var req controlRequest
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				fmt.Fprintln(os.Stderr, "gbloxs send: invalid request:", err)
+				return 2
+			}
+			reqs = append(reqs, req)
+		}
+
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	path := *socket
+	if path == "" {
+		var err error
+		if path, err = findSocket(); err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+			return 1
+		}
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+		return 1
+	}
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	status := 0
+	for _, req := range reqs {
+		var resp controlResponse
+		if err := enc.Encode(req); err == nil {
+			err = dec.Decode(&resp)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs send:", err)
+			return 1
+		}
+
+		switch {
+		case op == "json":
+			json.NewEncoder(os.Stdout).Encode(resp)
+		case !resp.OK:
+			fmt.Fprintln(os.Stderr, "gbloxs send:", resp.Error)
+		case op == "create":
+			fmt.Println(resp.ID)
+		case op == "get" && req.ID != "":
+			printJSON(resp.Blocks[0])
+		case op == "get":
+			printJSON(resp.Blocks)
+		}
+		if !resp.OK {
+			status = 1
+		}
+	}
+	return status
+}
+
+func createRequest(args []string) (controlRequest, error) {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var b controlBlock
+	var meta []string
+	flags.Func("type", "block type", func(s string) error {
+		b.Type = BlockType(s)
+		return nil
+	})
+	flags.StringVar(&b.Title, "title", "", "title")
+	flags.StringVar(&b.Content, "content", "", "text")
+	flags.StringVar(&b.Output, "output", "", "output")
+	flags.Float64Var(&b.Progress, "progress", 0, "progress")
+	flags.Func("meta", "KEY=VALUE", func(s string) error {
+		meta = append(meta, s)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return controlRequest{}, err
+	}
+	if flags.NArg() > 0 {
+		return controlRequest{}, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	var err error
+	if b.Metadata, err = keyValues(meta); err != nil {
+		return controlRequest{}, err
+	}
+	return controlRequest{Op: "create", Block: &b}, nil
+}
+
+func keyValues(args []string) (map[string]string, error) {
+	kv := make(map[string]string, len(args))
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%q is not KEY=VALUE", arg)
+		}
+		kv[k] = v
+	}
+	return kv, nil
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
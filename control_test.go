@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToControlBlockCopies(t *testing.T) {
+	b := Block{
+		ID:        "1",
+		Metadata:  map[string]string{"status": "running"},
+		TableData: [][]string{{"a", "b"}},
+		Attempts:  []Attempt{{ExitCode: 1}},
+		Checks:    []Check{{Expect: "exit 0"}},
+	}
+	cb := toControlBlock(b)
+
+	// What Update goes on doing to the block must not show in the reply
+	b.Metadata["status"] = "done"
+	b.TableData[0][0] = "changed"
+	b.Attempts[0].ExitCode = 2
+	b.Checks[0].Passed = true
+
+	if cb.Metadata["status"] != "running" {
+		t.Errorf("metadata shared with the block")
+	}
+	if cb.Table[0][0] != "a" {
+		t.Errorf("table shared with the block")
+	}
+	if cb.Attempts[0].ExitCode != 1 {
+		t.Errorf("attempts shared with the block")
+	}
+	if cb.Checks[0].Passed {
+		t.Errorf("checks shared with the block")
+	}
+}
+
+func TestListenControlKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := listenControl(ControlConfig{Socket: path})
+	if err == nil {
+		l.Close()
+		t.Fatal("listened on a path that holds a regular file")
+	}
+	if !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("err = %v, want it to say the path is not a socket", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep me" {
+		t.Errorf("file was touched: %q, %v", data, err)
+	}
+}
+
+func TestListenControlReplacesStaleSocket(t *testing.T) {
+	t.Setenv(socketEnv, "")
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+
+	l, err := listenControl(ControlConfig{Socket: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenControl(ControlConfig{Socket: path}); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second listener: err = %v, want in use", err)
+	}
+
+	// Closing a unix listener removes its socket; put one back the way
+	// a gbloxs that crashed would leave it
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listenControl(ControlConfig{Socket: path})
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// editorRows is how many lines of the script editor are shown at once.
+	editorRows = 12
+	// editorWrapWidth keeps the textarea from wrapping lines; the editor
+	// draws its own view and scrolls long lines sideways instead.
+	editorWrapWidth = 4096
+)
+
+// editorFinishedMsg reports that $EDITOR exited after editing path.
+type editorFinishedMsg struct {
+	path string
+	err  error
+}
+
+func newEditor() textarea.Model {
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.Prompt = ""
+	ta.CharLimit = 0
+	ta.MaxHeight = 0
+	ta.MaxWidth = 0
+	ta.SetWidth(editorWrapWidth)
+	return ta
+}
+
+// scriptOf strips the /cmd or !cmd prefix from single-line input. The
+// editor holds a plain shell script.
+func scriptOf(input string) string {
+	if strings.HasPrefix(input, "/") || strings.HasPrefix(input, "!") {
+		return input[1:]
+	}
+	return input
+}
+
+// editorCommand turns an editor script into input that addBlockFromInput
+// executes. A leading / in a script is a path, so the script is always
+// marked with !.
+func editorCommand(script string) string {
+	script = strings.TrimRight(script, "\n")
+	if strings.TrimSpace(script) == "" {
+		return ""
+	}
+	return "!" + script
+}
+
+// openEditor switches input mode to the multi-line editor with script in
+// it.
+func (m *model) openEditor(script string) tea.Cmd {
+	m.closeCompletion()
+	m.inputMode = true
+	m.showInput = true
+	m.multiline = true
+	m.textInput.Blur()
+	m.editor.SetValue(script)
+	return m.editor.Focus()
+}
+
+// closeInput leaves input mode, single-line or multi-line.
+func (m *model) closeInput() {
+	m.pipeFrom = ""
+	m.expectFor = ""
+	m.history.Reset()
+	m.closeCompletion()
+	m.inputMode = false
+	m.showInput = false
+	m.multiline = false
+	m.textInput.Blur()
+	m.editor.Blur()
+	m.editor.Reset()
+}
+
+// submitInput runs input as if it had been typed and leaves input mode.
+func (m *model) submitInput(input string) {
+	input, source := m.pipeInput(input)
+	if strings.TrimSpace(input) != "" {
+		m.addBlockFromInput(input)
+		idx := len(m.blocks) - 1
+		if source != "" {
+			m.blocks[idx].Title = "Piped from #" + source
+			m.blocks[idx].Metadata["source"] = "#" + source
+		}
+		// A command still running is recorded with its exit code once it
+		// finishes
+		if !m.recordWhenDone(m.blocks[idx].ID, input) {
+			m.recordHistory(input, m.blocks[idx].ExitCode)
+		}
+	}
+	m.textInput.SetValue("")
+	m.closeInput()
+}
+
+// recallInput puts a history entry into the input, switching to the
+// editor for entries that span several lines.
+func (m *model) recallInput(input string) tea.Cmd {
+	if strings.Contains(input, "\n") {
+		return m.openEditor(scriptOf(input))
+	}
+	m.textInput.SetValue(input)
+	m.textInput.CursorEnd()
+	return nil
+}
+
+// updateEditor handles keys in the multi-line editor. Enter inserts a
+// newline; submitting has its own key.
+func (m *model) updateEditor(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Cancel):
+		m.closeInput()
+	case key.Matches(msg, m.keys.EditorSubmit):
+		m.submitInput(editorCommand(m.editor.Value()))
+	case key.Matches(msg, m.keys.ExternalEditor):
+		return m.openExternalEditor(m.editor.Value())
+	default:
+		var cmd tea.Cmd
+		m.editor, cmd = m.editor.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+// externalEditor is $VISUAL or $EDITOR, falling back to vi.
+func externalEditor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// openExternalEditor suspends the UI and edits script in $EDITOR. Like
+// edit-and-execute-command in bash, whatever is saved runs as the command.
+func (m *model) openExternalEditor(script string) tea.Cmd {
+	f, err := os.CreateTemp("", "gbloxs-*.sh")
+	if err != nil {
+		m.addInfoBlock("Cannot open editor: " + err.Error())
+		return nil
+	}
+	_, err = f.WriteString(script)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		m.addInfoBlock("Cannot open editor: " + err.Error())
+		return nil
+	}
+
+	args := externalEditor()
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Dir = m.cwd
+	path := f.Name()
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return editorFinishedMsg{path: path, err: err}
+	})
+}
+
+// finishExternalEditor runs what was saved in $EDITOR. If the editor
+// failed, input stays open so nothing typed is lost.
+func (m *model) finishExternalEditor(msg editorFinishedMsg) {
+	data, err := os.ReadFile(msg.path)
+	os.Remove(msg.path)
+	if msg.err != nil {
+		err = msg.err
+	}
+	if err != nil {
+		m.addInfoBlock("Editor failed: " + err.Error())
+		return
+	}
+	m.submitInput(editorCommand(string(data)))
+}
+
+// editorCursor is the cursor position as an index into the editor's runes.
+func (m model) editorCursor() int {
+	lines := strings.Split(m.editor.Value(), "\n")
+	pos := 0
+	for i := 0; i < m.editor.Line() && i < len(lines); i++ {
+		pos += len([]rune(lines[i])) + 1
+	}
+	info := m.editor.LineInfo()
+	return pos + info.StartColumn + info.ColumnOffset
+}
+
+// renderEditor draws the script with shell highlighting, the cursor, and
+// the partner of the bracket or quote at the cursor. Brackets and quotes
+// without a partner are marked as errors.
+func (m model) renderEditor() string {
+	src := []rune(m.editor.Value())
+	syn := scanShell(src)
+	cursor := m.editorCursor()
+
+	match := map[int]bool{}
+	for _, at := range []int{cursor, cursor - 1} {
+		if partner, ok := syn.pairs[at]; ok {
+			match[at], match[partner] = true, true
+			break
+		}
+	}
+
+	style := func(i int) lipgloss.Style {
+		switch {
+		case i == cursor:
+			return m.styles.Cursor
+		case match[i]:
+			return m.styles.MatchBracket
+		case syn.unmatched[i]:
+			return m.styles.Unmatched
+		}
+		return m.styles.syntaxStyle(syn.kinds[i])
+	}
+
+	// Line start offsets into src
+	starts := []int{0}
+	for i, r := range src {
+		if r == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	row := m.editor.Line()
+
+	first := 0
+	if row >= editorRows {
+		first = row - editorRows + 1
+	}
+	width := m.width - 12
+	if width < 10 {
+		width = 10
+	}
+
+	var b strings.Builder
+	for r := first; r < len(starts) && r < first+editorRows; r++ {
+		start, end := starts[r], len(src)
+		if r+1 < len(starts) {
+			end = starts[r+1] - 1
+		}
+
+		// Scroll the cursor's line sideways when it is too long
+		from := start
+		if r == row && cursor-start >= width {
+			from = cursor - width + 1
+		}
+		to := end
+		if to-from > width {
+			to = from + width
+		}
+
+		if r > first {
+			b.WriteString("\n")
+		}
+		b.WriteString(m.styles.Muted.Render(fmt.Sprintf("%3d ", r+1)))
+
+		// Render runs of runes sharing a style together
+		for i := from; i < to; {
+			st := style(i)
+			j := i + 1
+			for j < to && j != cursor && i != cursor && !match[j] && !match[i] && !syn.unmatched[j] && !syn.unmatched[i] && syn.kinds[j] == syn.kinds[i] {
+				j++
+			}
+			b.WriteString(st.Render(string(src[i:j])))
+			i = j
+		}
+		if r == row && cursor == end {
+			b.WriteString(m.styles.Cursor.Render(" "))
+		}
+	}
+
+	if len(starts) > editorRows {
+		last := first + editorRows
+		b.WriteString("\n" + m.styles.Muted.Render(fmt.Sprintf("  ↕ lines %d-%d of %d", first+1, last, len(starts))))
+	}
+
+	return b.String()
+}
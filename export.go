@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// renderMarkdown writes blocks as a Markdown document: one section per
+// block, commands and output in fenced code blocks.
+func renderMarkdown(blocks []Block) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Gbloxs session, %s\n", time.Now().Format("2006-01-02 15:04"))
+
+	for _, block := range blocks {
+		fmt.Fprintf(&b, "\n## %s\n\n", block.Title)
+		fmt.Fprintf(&b, "_%s block, %s_\n", block.Type, block.Timestamp.Format("15:04:05"))
+
+		if block.Command != "" {
+			b.WriteString(fence("sh", "$ "+block.Command))
+		}
+		if block.Content != "" && scriptOf(block.Content) != block.Command {
+			b.WriteString("\n" + strings.TrimRight(block.Content, "\n") + "\n")
+		}
+		if len(block.TableData) > 0 {
+			b.WriteString("\n" + markdownTable(block.TableData))
+		}
+		if block.Output != "" {
+			b.WriteString(fence("", block.Output))
+		}
+		if block.Error != "" {
+			fmt.Fprintf(&b, "\n**Error:** %s\n", block.Error)
+		}
+	}
+
+	return b.String()
+}
+
+// fence wraps text in a code fence long enough not to clash with any
+// backticks inside it.
+func fence(lang, text string) string {
+	marker := "```"
+	for strings.Contains(text, marker) {
+		marker += "`"
+	}
+	return "\n" + marker + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + marker + "\n"
+}
+
+func markdownTable(rows [][]string) string {
+	var b strings.Builder
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString(strings.Repeat("|---", len(row)) + "|\n")
+		}
+	}
+	return b.String()
+}
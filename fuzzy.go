@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore matches query against candidate as a case-insensitive
+// subsequence. Matches that are contiguous, start a word or contain the
+// query verbatim score higher. An empty query matches everything with 0.
+func fuzzyScore(query, candidate string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	q := []rune(strings.ToLower(query))
+	c := []rune(strings.ToLower(candidate))
+
+	score, qi, last := 0, 0, -2
+	for ci := 0; ci < len(c) && qi < len(q); ci++ {
+		if c[ci] != q[qi] {
+			continue
+		}
+
+		score++
+		if ci == last+1 {
+			score += 5
+		}
+		if ci == 0 || isWordBoundary(c[ci-1]) {
+			score += 3
+		}
+		last = ci
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+
+	if strings.Contains(string(c), string(q)) {
+		score += 10
+	}
+	// Prefer shorter candidates among equally good matches
+	score -= len(c) / 20
+
+	return score, true
+}
+
+func isWordBoundary(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("/-_.:=|", r)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitInfo is what the status bar shows about the repository of the cwd.
+// It is read from the .git directory directly, without running git.
+type gitInfo struct {
+	// branch is the checked out branch, or the short commit when detached;
+	// empty outside a repository
+	branch string
+	// dirty is set when a tracked file differs from the index
+	dirty bool
+}
+
+// readGitInfo finds the repository dir is in and reads its branch and
+// whether tracked files changed.
+func readGitInfo(dir string) gitInfo {
+	gitDir, workTree, ok := findGitDir(dir)
+	if !ok {
+		return gitInfo{}
+	}
+	info := gitInfo{branch: gitHead(gitDir)}
+	info.dirty = gitDirty(gitDir, workTree)
+	return info
+}
+
+// findGitDir walks up from dir to the repository, following the .git
+// files of worktrees and submodules.
+func findGitDir(dir string) (gitDir, workTree string, ok bool) {
+	for {
+		path := filepath.Join(dir, ".git")
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			return path, dir, true
+		}
+		if err == nil {
+			data, err := os.ReadFile(path)
+			if target, found := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: "); err == nil && found {
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(dir, target)
+				}
+				return target, dir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
+// gitHead is the branch HEAD points to, or its commit shortened.
+func gitHead(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return head
+}
+
+// commonDir is where a worktree's repository keeps what all worktrees
+// share, such as the config.
+func commonDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	dir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+	return dir
+}
+
+// gitDirty reports whether a file in the index was changed, removed or
+// has a conflict in the working tree. Files whose size and modification
+// time match the index are taken as unchanged, as git does; the others are
+// hashed. Untracked files do not count.
+func gitDirty(gitDir, workTree string) bool {
+	data, err := os.ReadFile(filepath.Join(gitDir, "index"))
+	if err != nil {
+		// A new repository has no index yet
+		return false
+	}
+
+	newHash := sha1.New
+	if config, err := os.ReadFile(filepath.Join(commonDir(gitDir), "config")); err == nil &&
+		bytes.Contains(bytes.ReplaceAll(config, []byte(" "), nil), []byte("objectformat=sha256")) {
+		newHash = sha256.New
+	}
+
+	// An index that cannot be read says nothing either way
+	dirty := false
+	readGitIndex(data, newHash().Size(), func(e indexEntry) bool {
+		dirty = e.changed(workTree, newHash)
+		return !dirty
+	})
+	return dirty
+}
+
+// indexEntry is a file recorded in the index.
+type indexEntry struct {
+	path        string
+	mtimeSec    uint32
+	mtimeNsec   uint32
+	mode        uint32
+	size        uint32
+	hash        []byte
+	stage       int
+	intentToAdd bool
+	skip        bool // assume-valid or skip-worktree
+}
+
+const (
+	modeSymlink = 0o120000
+	modeGitlink = 0o160000
+	modeTree    = 0o040000
+)
+
+// readGitIndex calls visit for every entry of an index file, versions 2 to
+// 4, until visit returns false.
+func readGitIndex(data []byte, hashSize int, visit func(indexEntry) bool) error {
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return errors.New("not a git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return fmt.Errorf("git index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	pos := 12
+	prev := ""
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		fixed := 40 + hashSize + 2
+		if pos+fixed > len(data) {
+			return errors.New("truncated git index")
+		}
+		u32 := func(off int) uint32 { return binary.BigEndian.Uint32(data[pos+off:]) }
+		e := indexEntry{
+			mtimeSec:  u32(8),
+			mtimeNsec: u32(12),
+			mode:      u32(24),
+			size:      u32(36),
+			hash:      data[pos+40 : pos+40+hashSize],
+		}
+		flags := binary.BigEndian.Uint16(data[pos+40+hashSize:])
+		e.stage = int(flags>>12) & 3
+		e.skip = flags&0x8000 != 0
+		pos += fixed
+		if flags&0x4000 != 0 && version >= 3 {
+			if pos+2 > len(data) {
+				return errors.New("truncated git index")
+			}
+			extended := binary.BigEndian.Uint16(data[pos:])
+			e.skip = e.skip || extended&0x4000 != 0
+			e.intentToAdd = extended&0x2000 != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			// The path is stored as how much of the previous path to drop and
+			// what to append
+			strip, n := indexVarint(data[pos:])
+			if n == 0 || strip > len(prev) {
+				return errors.New("corrupt git index path")
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return errors.New("truncated git index")
+			}
+			e.path = prev[:len(prev)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return errors.New("truncated git index")
+			}
+			e.path = string(data[pos : pos+end])
+			// Entries are padded with NULs to a multiple of 8 bytes
+			pos = start + (pos-start+end+8)&^7
+		}
+		prev = e.path
+
+		if !visit(e) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// indexVarint decodes the offset encoding of index version 4 paths. It
+// returns the value and the number of bytes read, 0 when data ends early.
+func indexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	val := int(c & 127)
+	n := 1
+	for c&128 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		val = (val+1)<<7 | int(c&127)
+	}
+	return val, n
+}
+
+// changed reports whether the working tree file differs from the entry.
+func (e indexEntry) changed(workTree string, newHash func() hash.Hash) bool {
+	if e.stage != 0 || e.intentToAdd {
+		return true
+	}
+	if e.skip || e.mode == modeGitlink || e.mode&0o170000 == modeTree {
+		return false
+	}
+
+	path := filepath.Join(workTree, filepath.FromSlash(e.path))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return true
+	}
+	symlink := info.Mode()&fs.ModeSymlink != 0
+	if symlink != (e.mode == modeSymlink) {
+		return true
+	}
+	if !symlink && (info.Mode()&0o111 != 0) != (e.mode&0o111 != 0) {
+		return true
+	}
+	if uint32(info.Size()) != e.size {
+		return true
+	}
+	mtime := info.ModTime()
+	if uint32(mtime.Unix()) == e.mtimeSec && uint32(mtime.Nanosecond()) == e.mtimeNsec {
+		return false
+	}
+
+	// Touched, but maybe not changed
+	var content []byte
+	if symlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return true
+		}
+		content = []byte(target)
+	} else if content, err = os.ReadFile(path); err != nil {
+		return true
+	}
+	h := newHash()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return !bytes.Equal(h.Sum(nil), e.hash)
+}
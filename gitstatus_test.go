@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha1"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitRepo makes a repository with a few committed files, or skips the
+// test without git.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md":                      "hello\n",
+		"cmd/tool/main.go":               "package main\n",
+		"cmd/tool/main_test.go":          "package main\n",
+		"docs/a very long file name.txt": "x",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, dir, "init", "-q", "-b", "main")
+	git(t, dir, "add", ".")
+	git(t, dir, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "init")
+	return dir
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestReadGitIndex(t *testing.T) {
+	dir := gitRepo(t)
+	want := strings.Split(strings.TrimSuffix(git(t, dir, "ls-files", "-z"), "\x00"), "\x00")
+
+	for _, version := range []string{"2", "3", "4"} {
+		t.Run("version "+version, func(t *testing.T) {
+			git(t, dir, "update-index", "--index-version", version)
+			data, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paths []string
+			err = readGitIndex(data, sha1.Size, func(e indexEntry) bool {
+				paths = append(paths, e.path)
+				if len(e.hash) != sha1.Size || e.stage != 0 {
+					t.Errorf("%s: hash of %d bytes, stage %d", e.path, len(e.hash), e.stage)
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("paths = %q, want %q", paths, want)
+			}
+
+			// Stopping early
+			n := 0
+			readGitIndex(data, sha1.Size, func(indexEntry) bool { n++; return false })
+			if n != 1 {
+				t.Errorf("visited %d entries after stopping, want 1", n)
+			}
+		})
+	}
+}
+
+func TestReadGitIndexErrors(t *testing.T) {
+	dir := gitRepo(t)
+	data, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badVersion := append([]byte(nil), data...)
+	badVersion[7] = 9
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "empty", data: nil, want: "not a git index"},
+		{name: "wrong magic", data: []byte("PACK\x00\x00\x00\x02\x00\x00\x00\x00"), want: "not a git index"},
+		{name: "unknown version", data: badVersion, want: "git index version 9"},
+		{name: "cut in an entry", data: data[:12+30], want: "truncated"},
+		{name: "cut in a path", data: data[:12+62+3], want: "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := readGitIndex(tt.data, sha1.Size, func(indexEntry) bool { return true })
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexVarint(t *testing.T) {
+	tests := []struct {
+		data []byte
+		val  int
+		n    int
+	}{
+		{data: []byte{0}, val: 0, n: 1},
+		{data: []byte{5, 'x'}, val: 5, n: 1},
+		{data: []byte{127}, val: 127, n: 1},
+		{data: []byte{0x80, 0}, val: 128, n: 2},
+		{data: []byte{0x81, 0x7f}, val: 383, n: 2},
+		{data: []byte{0x80}, val: 0, n: 0},
+		{data: nil, val: 0, n: 0},
+	}
+	for _, tt := range tests {
+		val, n := indexVarint(tt.data)
+		if val != tt.val || n != tt.n {
+			t.Errorf("indexVarint(%v) = %d, %d, want %d, %d", tt.data, val, n, tt.val, tt.n)
+		}
+	}
+}
+
+func TestReadGitInfo(t *testing.T) {
+	dir := gitRepo(t)
+	sub := filepath.Join(dir, "cmd", "tool")
+
+	if got := readGitInfo(sub); got != (gitInfo{branch: "main"}) {
+		t.Errorf("clean: %+v", got)
+	}
+
+	// A new file is not tracked, so it does not count
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGitInfo(sub); got.dirty {
+		t.Errorf("untracked file made the tree dirty")
+	}
+
+	if err := os.WriteFile(filepath.Join(sub, "main.go"), []byte("package other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGitInfo(sub); !got.dirty {
+		t.Errorf("changed file did not make the tree dirty")
+	}
+
+	git(t, dir, "checkout", "-q", "--", ".")
+	git(t, dir, "checkout", "-q", "--detach")
+	head := strings.TrimSpace(git(t, dir, "rev-parse", "--short=7", "HEAD"))
+	if got := readGitInfo(dir); got.branch != head || got.dirty {
+		t.Errorf("detached: %+v, want branch %s", got, head)
+	}
+
+	if got := readGitInfo(t.TempDir()); got != (gitInfo{}) {
+		t.Errorf("outside a repository: %+v", got)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// exitInterrupted is the exit status of gbloxs exec when it is interrupted,
+// the one shells use for SIGINT.
+const exitInterrupted = 130
+
+// defaultHeadlessWidth is the width of printed blocks when neither --width
+// nor $COLUMNS says otherwise.
+const defaultHeadlessWidth = 100
+
+// runExec is gbloxs exec, which runs commands without the UI and prints
+// each block as it finishes, for CI logs and scripts.
+func runExec(args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	flags.Usage = commandUsage(flags)
+	script := flags.String("script", "", "run the commands in `FILE`, one per line; - reads stdin")
+	color := flags.String("color", "auto", "color the blocks: auto, always or never")
+	width := flags.Int("width", 0, "width of the blocks (default $COLUMNS or 100)")
+	keepGoing := flags.Bool("keep-going", false, "run the remaining commands after one fails")
+	timeout := flags.String("timeout", "", "stop commands that run longer than `DURATION`, such as 30s")
+	retries := flags.Int("retries", -1, "run failed commands again up to `N` times (default jobs.retries)")
+	backoff := flags.String("backoff", "", "wait `DURATION` before the first retry, doubling after each")
+	var expect []Assertion
+	flags.Func("expect", "check every command against `EXPECTATION`, such as 'contains ok'; may be repeated", func(s string) error {
+		a, err := parseAssertion(s)
+		if err == nil {
+			expect = append(expect, a)
+		}
+		return err
+	})
+	if err := flags.Parse(args); err != nil {
+		return flagStatus(err)
+	}
+
+	var commands []string
+	switch {
+	case *script != "" && flags.NArg() > 0:
+		fmt.Fprintln(os.Stderr, "gbloxs exec: give a command or --script, not both")
+		return 2
+	case *script != "":
+		var err error
+		if commands, err = readScript(*script); err != nil {
+			fmt.Fprintln(os.Stderr, "gbloxs exec:", err)
+			return 1
+		}
+	case flags.NArg() == 1:
+		// A single argument is a shell command line, as in the UI
+		commands = []string{flags.Arg(0)}
+	case flags.NArg() > 1:
+		quoted := make([]string, flags.NArg())
+		for i, arg := range flags.Args() {
+			quoted[i] = shellQuote(arg)
+		}
+		commands = []string{strings.Join(quoted, " ")}
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err := setColor(*color); err != nil {
+		fmt.Fprintln(os.Stderr, "gbloxs exec:", err)
+		return 2
+	}
+	if *width <= 0 {
+		*width = defaultHeadlessWidth
+		if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+			*width = n
+		}
+	}
+
+	m := newModel(nil)
+	for _, d := range []struct{ flag, value string }{{"timeout", *timeout}, {"backoff", *backoff}} {
+		if v, err := time.ParseDuration(d.value); d.value != "" && (err != nil || v < 0) {
+			fmt.Fprintf(os.Stderr, "gbloxs exec: --%s %q is not a duration such as 30s\n", d.flag, d.value)
+			return 2
+		}
+	}
+	if *timeout != "" {
+		m.config.Jobs.Timeout = *timeout
+	}
+	if *backoff != "" {
+		m.config.Jobs.Backoff = *backoff
+	}
+	if *retries >= 0 {
+		m.config.Jobs.Retries = *retries
+	}
+
+	return execCommands(m, commands, expect, os.Stdout, *width, *keepGoing)
+}
+
+// setColor chooses whether the printed blocks carry ANSI colors.
+func setColor(when string) error {
+	switch when {
+	case "auto":
+		// lipgloss already drops colors when stdout is not a terminal
+		if os.Getenv("NO_COLOR") != "" {
+			lipgloss.SetColorProfile(termenv.Ascii)
+		}
+	case "always":
+		lipgloss.SetColorProfile(termenv.TrueColor)
+	case "never":
+		lipgloss.SetColorProfile(termenv.Ascii)
+	default:
+		return fmt.Errorf("--color is auto, always or never, not %q", when)
+	}
+	return nil
+}
+
+// execCommands runs the commands one after another, printing each block to
+// w once it finishes. Every command is checked against the expectations in
+// expect, which are summed up at the end. It returns the exit status of the
+// first command that failed, or 0.
+func execCommands(m model, commands []string, expect []Assertion, w io.Writer, width int, keepGoing bool) int {
+	status := 0
+	ran, failed := 0, 0
+	start := time.Now()
+
+	for i, command := range commands {
+		b := Block{
+			ID:         m.newBlockID(),
+			Title:      command,
+			Content:    command,
+			Command:    command,
+			Type:       BlockTypeCommand,
+			Expanded:   true,
+			Timestamp:  time.Now(),
+			Metadata:   make(map[string]string),
+			Assertions: expect,
+		}
+		if first, _, multi := strings.Cut(command, "\n"); multi {
+			b.Title = first + " …"
+		}
+		interrupted := false
+		if dir, ok := cdTarget(command); ok {
+			m.changeDir(dir, &b)
+		} else {
+			interrupted = m.executeCommandInBlock(command, &b)
+		}
+		m.blocks = append(m.blocks, b)
+
+		// The whole output belongs in the log, not a scrolled window of it,
+		// and so does that of every attempt
+		b.Viewport.Height = 0
+		b.ShowAttempts = true
+		fmt.Fprintln(w, m.renderBlockWidth(b, false, width))
+		ran++
+
+		if interrupted {
+			fmt.Fprintln(w, m.styles.Muted.Render("Interrupted"))
+			return exitInterrupted
+		}
+		if b.Type != BlockTypeError {
+			continue
+		}
+		failed++
+		if status == 0 {
+			status = min(max(b.ExitCode, 1), 255)
+		}
+		if !keepGoing && i < len(commands)-1 {
+			fmt.Fprintln(w, m.styles.Muted.Render(fmt.Sprintf("Stopped after %q failed; %d commands not run", command, len(commands)-i-1)))
+			break
+		}
+	}
+
+	if title, content, ok := expectationSummary(m.blocks); ok {
+		fmt.Fprintln(w, m.renderBlockWidth(Block{
+			ID:        m.newBlockID(),
+			Title:     title,
+			Content:   content,
+			Type:      BlockTypeInfo,
+			Expanded:  true,
+			Timestamp: time.Now(),
+		}, false, width))
+	}
+	if len(commands) > 1 {
+		summary := fmt.Sprintf("%d commands run, %d failed, %s", ran, failed, time.Since(start).Round(time.Millisecond))
+		fmt.Fprintln(w, m.styles.Muted.Render(summary))
+	}
+	return status
+}
+
+// runTimed runs cmd to the end and returns what it printed. A command
+// that runs past timeout, when there is one, is asked to terminate and
+// killed after timeoutGrace. Interrupting gbloxs stops the command as well,
+// since it runs in a process group of its own.
+func runTimed(cmd *exec.Cmd, timeout time.Duration) (output string, timedOut, interrupted bool, err error) {
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	ownProcessGroup(cmd)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return "", false, false, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	var kill <-chan time.Time
+	for {
+		select {
+		case err := <-exited:
+			return out.String(), timedOut, interrupted, err
+		case <-deadline:
+			timedOut = true
+			signalGroup(cmd, false)
+			kill = time.After(timeoutGrace)
+		case <-signals:
+			interrupted = true
+			signalGroup(cmd, false)
+			kill = time.After(timeoutGrace)
+		case <-kill:
+			signalGroup(cmd, true)
+		}
+	}
+}
+
+// readScript reads the commands of a --script file: one per line, with a
+// trailing backslash continuing a command on the next line. Blank lines
+// and lines starting with # are skipped.
+func readScript(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var commands []string
+	var current []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if len(current) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+		}
+		if cont, ok := strings.CutSuffix(line, `\`); ok {
+			current = append(current, cont)
+			continue
+		}
+		current = append(current, line)
+		commands = append(commands, strings.TrimSpace(strings.Join(current, " ")))
+		current = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(current) > 0 {
+		commands = append(commands, strings.TrimSpace(strings.Join(current, " ")))
+	}
+	if len(commands) == 0 {
+		return nil, errors.New(path + ": no commands")
+	}
+	return commands, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "one per line",
+			text: "make build\nmake test\n",
+			want: []string{"make build", "make test"},
+		},
+		{
+			name: "comments and blank lines",
+			text: "# setup\n\n  # indented comment\nls\n\t\npwd",
+			want: []string{"ls", "pwd"},
+		},
+		{
+			name: "continued lines",
+			text: "docker run \\\n  --rm \\\n  alpine true\necho done\n",
+			want: []string{"docker run    --rm    alpine true", "echo done"},
+		},
+		{
+			name: "continuation keeps a hash",
+			text: "echo \\\n# not a comment\n",
+			want: []string{"echo  # not a comment"},
+		},
+		{
+			name: "backslash on the last line",
+			text: "echo last \\",
+			want: []string{"echo last"},
+		},
+		{
+			name: "crlf and trailing blanks",
+			text: "ls  \r\npwd\t\r\n",
+			want: []string{"ls", "pwd"},
+		},
+		{
+			name:    "nothing to run",
+			text:    "# only comments\n\n",
+			wantErr: "no commands",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "script")
+			if err := os.WriteFile(path, []byte(tt.text), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readScript(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readScript = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	defaultHistorySize = 10000
+	// historySearchRows is how many matches the search popup shows.
+	historySearchRows = 8
+)
+
+// HistoryEntry is one submitted input. The file stores one JSON object per
+// line so that multi-line input survives.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Cwd     string    `json:"cwd,omitempty"`
+	Exit    int       `json:"exit"`
+	Command string    `json:"command"`
+}
+
+// History is the input history, oldest entry first. Entries imported from
+// shell history files are kept in memory only.
+type History struct {
+	path    string
+	max     int
+	entries []HistoryEntry
+
+	// pos is the entry shown while cycling with up/down; len(entries) means
+	// the draft the user was typing before they started cycling.
+	pos   int
+	draft string
+}
+
+// historySearch is the state of the Ctrl+R popup.
+type historySearch struct {
+	active  bool
+	input   textinput.Model
+	matches []int // indices into History.entries, best first
+	cursor  int
+}
+
+func historyPath(cfg HistoryConfig) string {
+	if cfg.File != "" {
+		return cfg.File
+	}
+	return filepath.Join(stateDir(), "history")
+}
+
+// loadHistory reads the history file and, when configured, the shell
+// history files. Problems are returned as warnings; the history still works
+// in memory.
+func loadHistory(cfg HistoryConfig) (History, []string) {
+	h := History{path: historyPath(cfg), max: cfg.MaxEntries}
+	if h.max <= 0 {
+		h.max = defaultHistorySize
+	}
+	var warnings []string
+
+	if cfg.ImportShell {
+		home, _ := os.UserHomeDir()
+		for _, file := range []string{".bash_history", ".zsh_history"} {
+			entries, err := readShellHistory(filepath.Join(home, file))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				warnings = append(warnings, fmt.Sprintf("history: %v", err))
+			}
+			h.entries = append(h.entries, entries...)
+		}
+	}
+
+	own, err := readHistoryFile(h.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		warnings = append(warnings, fmt.Sprintf("history: %v", err))
+	}
+	if len(own) > h.max {
+		own = own[len(own)-h.max:]
+		if err := h.rewrite(own); err != nil {
+			warnings = append(warnings, fmt.Sprintf("history: %v", err))
+		}
+	}
+	h.entries = append(h.entries, own...)
+	h.pos = len(h.entries)
+
+	return h, warnings
+}
+
+func readHistoryFile(path string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		// Skip lines that do not parse rather than losing the whole file
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil && e.Command != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// readShellHistory understands plain bash history, bash history with
+// "#<epoch>" timestamp lines, and zsh extended history
+// (": <epoch>:<duration>;<command>", continued lines ending in "\").
+func readShellHistory(path string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	var stamp time.Time
+	var pending []string
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if len(pending) > 0 {
+			pending = append(pending, line)
+		} else if t, ok := bashTimestamp(line); ok {
+			stamp = t
+			continue
+		} else if strings.HasPrefix(line, ": ") {
+			if meta, cmd, ok := strings.Cut(line[2:], ";"); ok {
+				if sec, err := strconv.ParseInt(strings.SplitN(meta, ":", 2)[0], 10, 64); err == nil {
+					stamp = time.Unix(sec, 0)
+				}
+				pending = []string{cmd}
+			} else {
+				pending = []string{line}
+			}
+		} else {
+			pending = []string{line}
+		}
+
+		// zsh continues multi-line commands with a trailing backslash
+		if strings.HasSuffix(line, "\\") {
+			pending[len(pending)-1] = strings.TrimSuffix(pending[len(pending)-1], "\\")
+			continue
+		}
+
+		if cmd := strings.TrimSpace(strings.Join(pending, "\n")); cmd != "" {
+			entries = append(entries, HistoryEntry{Time: stamp, Command: cmd})
+		}
+		pending = nil
+		stamp = time.Time{}
+	}
+
+	return entries, scanner.Err()
+}
+
+// bashTimestamp parses the "#<epoch>" lines bash writes when
+// HISTTIMEFORMAT is set.
+func bashTimestamp(line string) (time.Time, bool) {
+	if !strings.HasPrefix(line, "#") {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// rewrite replaces the history file with entries.
+func (h *History) rewrite(entries []HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// Add records an entry in memory and appends it to the history file.
+func (h *History) Add(e HistoryEntry) error {
+	h.entries = append(h.entries, e)
+	h.Reset()
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Reset ends cycling so the next Prev starts from the newest entry.
+func (h *History) Reset() {
+	h.pos = len(h.entries)
+	h.draft = ""
+}
+
+// Prev returns the next older entry, skipping repeats of the text shown.
+// current is remembered as the draft when cycling starts.
+func (h *History) Prev(current string) (string, bool) {
+	if h.pos == len(h.entries) {
+		h.draft = current
+	}
+	for i := h.pos - 1; i >= 0; i-- {
+		if h.entries[i].Command != current {
+			h.pos = i
+			return h.entries[i].Command, true
+		}
+	}
+	return "", false
+}
+
+// Next returns the next newer entry, ending with the draft.
+func (h *History) Next(current string) (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	for i := h.pos + 1; i < len(h.entries); i++ {
+		if h.entries[i].Command != current {
+			h.pos = i
+			return h.entries[i].Command, true
+		}
+	}
+	h.pos = len(h.entries)
+	return h.draft, true
+}
+
+// Search returns the indices of entries fuzzily matching query, best match
+// first and newest first among equal scores. Each command appears once.
+func (h *History) Search(query string) []int {
+	type match struct{ idx, score int }
+	var matches []match
+	seen := make(map[string]bool)
+
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		cmd := h.entries[i].Command
+		if seen[cmd] {
+			continue
+		}
+		seen[cmd] = true
+		if score, ok := fuzzyScore(query, cmd); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].score > matches[b].score
+	})
+
+	indices := make([]int, len(matches))
+	for i, mt := range matches {
+		indices[i] = mt.idx
+	}
+	return indices
+}
+
+// recordHistory stores a submitted input along with how it finished.
+func (m *model) recordHistory(input string, exit int) {
+	err := m.history.Add(HistoryEntry{
+		Time:    time.Now(),
+		Cwd:     m.cwd,
+		Exit:    exit,
+		Command: input,
+	})
+	if err != nil {
+		m.addInfoBlock("History not saved: " + err.Error())
+	}
+}
+
+func newHistorySearchInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "(reverse-i-search) "
+	ti.Placeholder = "type to filter history..."
+	ti.CharLimit = 200
+	return ti
+}
+
+func (m *model) openHistorySearch() tea.Cmd {
+	m.search.active = true
+	m.search.input.SetValue("")
+	m.search.matches = m.history.Search("")
+	m.search.cursor = 0
+	return m.search.input.Focus()
+}
+
+func (m *model) closeHistorySearch() {
+	m.search.active = false
+	m.search.input.Blur()
+}
+
+// updateHistorySearch handles keys while the search popup is open.
+func (m *model) updateHistorySearch(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.keys.Cancel):
+		m.closeHistorySearch()
+
+	case key.Matches(msg, m.keys.Submit):
+		// Accept into the input for editing rather than running it
+		m.closeHistorySearch()
+		if m.search.cursor < len(m.search.matches) {
+			return m.recallInput(m.history.entries[m.search.matches[m.search.cursor]].Command)
+		}
+
+	case key.Matches(msg, m.keys.HistorySearch, m.keys.HistoryPrev):
+		if m.search.cursor < len(m.search.matches)-1 {
+			m.search.cursor++
+		}
+
+	case key.Matches(msg, m.keys.HistoryNext):
+		if m.search.cursor > 0 {
+			m.search.cursor--
+		}
+
+	default:
+		var cmd tea.Cmd
+		m.search.input, cmd = m.search.input.Update(msg)
+		m.search.matches = m.history.Search(m.search.input.Value())
+		m.search.cursor = 0
+		return cmd
+	}
+
+	return nil
+}
+
+// renderHistorySearch draws the search popup shown above the input box.
+func (m model) renderHistorySearch() string {
+	var b strings.Builder
+	b.WriteString(m.search.input.View())
+
+	if len(m.search.matches) == 0 {
+		b.WriteString("\n" + m.styles.Muted.Render("  no matches"))
+	}
+
+	// Keep the cursor in view
+	first := 0
+	if m.search.cursor >= historySearchRows {
+		first = m.search.cursor - historySearchRows + 1
+	}
+
+	width := m.width - 12
+	for i := first; i < len(m.search.matches) && i < first+historySearchRows; i++ {
+		e := m.history.entries[m.search.matches[i]]
+
+		cmd := strings.ReplaceAll(e.Command, "\n", " ⏎ ")
+		if width > 10 {
+			cmd = runewidth.Truncate(cmd, width, "…")
+		}
+
+		var details []string
+		if e.Exit != 0 {
+			details = append(details, fmt.Sprintf("exit %d", e.Exit))
+		}
+		if e.Cwd != "" {
+			details = append(details, e.Cwd)
+		}
+
+		line := "  " + cmd
+		if i == m.search.cursor {
+			line = m.styles.TableSelectedRow.Render("▶ " + cmd)
+		}
+		if len(details) > 0 {
+			line += m.styles.Muted.Render("  " + strings.Join(details, " · "))
+		}
+		b.WriteString("\n" + line)
+	}
+
+	return m.styles.HelpOverlay.Copy().
+		Padding(0, 1).
+		Render(b.String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestReadShellHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		want  []string
+		stamp []int64
+	}{
+		{
+			name: "plain bash",
+			text: "ls -la\n\ngit status\n",
+			want: []string{"ls -la", "git status"},
+		},
+		{
+			name:  "bash timestamps",
+			text:  "#1700000000\nmake test\n#1700000060\nmake build\n",
+			want:  []string{"make test", "make build"},
+			stamp: []int64{1700000000, 1700000060},
+		},
+		{
+			name:  "zsh extended",
+			text:  ": 1700000000:0;echo one\n: 1700000005:2;for i in 1 2; do\\\necho $i\\\ndone\n",
+			want:  []string{"echo one", "for i in 1 2; do\necho $i\ndone"},
+			stamp: []int64{1700000000, 1700000005},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history")
+			if err := os.WriteFile(path, []byte(tt.text), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := readShellHistory(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Command)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("commands = %q, want %q", got, tt.want)
+			}
+			for i, sec := range tt.stamp {
+				if !entries[i].Time.Equal(time.Unix(sec, 0)) {
+					t.Errorf("entry %d time = %v, want %v", i, entries[i].Time, time.Unix(sec, 0))
+				}
+			}
+		})
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := History{entries: []HistoryEntry{
+		{Command: "kubectl get pods"},
+		{Command: "git status"},
+		{Command: "kubectl logs web"},
+		{Command: "git status"},
+	}}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{query: "", want: []int{3, 2, 0}},
+		{query: "kub", want: []int{2, 0}},
+		{query: "gst", want: []int{3}},
+		{query: "zzz", want: nil},
+	}
+
+	for _, tt := range tests {
+		got := h.Search(tt.query)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHistorySearchTruncates(t *testing.T) {
+	tests := []string{
+		"echo plain ascii that is much longer than the popup is wide",
+		"echo 日本語のコマンドはとても長い日本語のコマンド",
+		"echo 😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀😀",
+		// Wider than the popup but with fewer runes than it has cells
+		"日本語のコマンド日本語",
+	}
+
+	for _, cmd := range tests {
+		m := model{width: 30}
+		m.history.entries = []HistoryEntry{{Command: cmd}}
+		m.search.input = newHistorySearchInput()
+		m.search.matches = []int{0}
+
+		out := m.renderHistorySearch()
+		// The selected match is drawn as "▶ " and the command cut to fit
+		limit := m.width - 12 + 2
+		found := false
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "▶") {
+				continue
+			}
+			found = true
+			if w := lipgloss.Width(line); w > limit {
+				t.Errorf("%q: match %q is %d cells wide, want at most %d", cmd, line, w, limit)
+			}
+		}
+		if !found {
+			t.Errorf("%q: no match shown in %q", cmd, out)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// job is a command running in the background for a block. Commands run
+// while the UI stays responsive; the block shows their output as it
+// arrives.
+type job struct {
+	blockID string
+	command string
+	cmd     *exec.Cmd
+	// output is the file the command writes its stdout and stderr to,
+	// which outlives gbloxs when the job is detached
+	output  *os.File
+	text    []byte // what was read from output so far
+	started time.Time
+	cleanup func()
+	// history is the input recorded in the history once the exit code is
+	// known, if any
+	history string
+	// attempt counts the runs of the command, from 1
+	attempt int
+	// timeout is how long the command may run; timedOut is set once it
+	// ran that long and was asked to terminate, forced once it was killed
+	timeout  time.Duration
+	timedOut bool
+	forced   bool
+	// stopping is set once the job was asked to terminate
+	stopping bool
+	// usage is the last /proc sample of the job's processes
+	usage jobUsage
+}
+
+// jobDoneMsg reports that the command of a block exited.
+type jobDoneMsg struct {
+	blockID string
+	err     error
+}
+
+// read takes in what the command printed since the last call and reports
+// whether there was anything new.
+func (j *job) read() bool {
+	info, err := j.output.Stat()
+	if err != nil || info.Size() <= int64(len(j.text)) {
+		return false
+	}
+	buf := make([]byte, info.Size()-int64(len(j.text)))
+	n, _ := j.output.ReadAt(buf, int64(len(j.text)))
+	j.text = append(j.text, buf[:n]...)
+	return n > 0
+}
+
+// startCommand starts cmdStr for block in the background, or queues it
+// while jobs.max_parallel commands run. A block whose command is still
+// running or queued is left alone.
+func (m *model) startCommand(cmdStr string, block *Block) {
+	if _, running := m.jobs[block.ID]; running || m.queuedIndex(block.ID) >= 0 {
+		return
+	}
+	if m.slotFree() && m.due() == 0 {
+		m.launch(cmdStr, block, 1)
+		return
+	}
+	m.enqueue(cmdStr, block)
+}
+
+// launch starts cmdStr for block in the background, as the given attempt.
+func (m *model) launch(cmdStr string, block *Block, attempt int) {
+	if attempt == 1 {
+		block.Attempts = nil
+	}
+	cmd, in := m.prepareCommand(cmdStr, block)
+	if cmd == nil {
+		in.cleanup()
+		return
+	}
+	m.alerts.restart(block.ID)
+	// A file rather than a pipe, so a detached command can go on writing
+	// after gbloxs exits
+	out, err := os.CreateTemp("", "gbloxs-job-*.log")
+	if err != nil {
+		in.cleanup()
+		m.finishCommand(block, "", err)
+		return
+	}
+	cmd.Stdout, cmd.Stderr = out, out
+	ownProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		in.cleanup()
+		out.Close()
+		os.Remove(out.Name())
+		m.finishCommand(block, "", err)
+		return
+	}
+
+	m.jobs[block.ID] = &job{
+		blockID: block.ID,
+		command: cmdStr,
+		cmd:     cmd,
+		output:  out,
+		started: time.Now(),
+		cleanup: in.cleanup,
+		attempt: attempt,
+		timeout: m.policyFor(*block).Timeout,
+	}
+	// block points into m.blocks, which Update may shift while the command
+	// runs
+	id, done := block.ID, m.jobDone
+	go func() {
+		err := cmd.Wait()
+		done <- jobDoneMsg{blockID: id, err: err}
+	}()
+}
+
+// waitJob waits for the next command to exit.
+func waitJob(done chan jobDoneMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-done
+	}
+}
+
+// running reports whether the block at index i has a command running or
+// waiting in the queue.
+func (m model) running(i int) bool {
+	_, ok := m.jobs[m.blocks[i].ID]
+	return ok || m.queuedIndex(m.blocks[i].ID) >= 0
+}
+
+// recordWhenDone has input recorded in the history with the exit code of
+// the block's command once it finishes. It reports false when the block
+// has no command running or queued.
+func (m *model) recordWhenDone(blockID, input string) bool {
+	if j, ok := m.jobs[blockID]; ok {
+		j.history = input
+		return true
+	}
+	if i := m.queuedIndex(blockID); i >= 0 {
+		m.queue[i].history = input
+		return true
+	}
+	return false
+}
+
+// pollJobs shows the output the running commands printed so far.
+func (m *model) pollJobs() {
+	for i := range m.blocks {
+		b := &m.blocks[i]
+		if j, ok := m.jobs[b.ID]; ok && j.read() {
+			setOutput(b, string(j.text))
+		}
+	}
+	m.checkTimeouts()
+	if m.jobsPanel.active && time.Since(m.jobsPanel.sampled) >= jobsSampleInterval {
+		m.sampleJobs()
+	}
+	// Retries whose backoff passed
+	if len(m.queue) > 0 {
+		m.startQueued()
+	}
+}
+
+// checkTimeouts asks the commands that ran past their timeout to
+// terminate, and kills those that did not within timeoutGrace.
+func (m *model) checkTimeouts() {
+	for _, j := range m.jobs {
+		if j.timeout <= 0 || j.forced {
+			continue
+		}
+		elapsed := time.Since(j.started)
+		switch {
+		case !j.timedOut && elapsed >= j.timeout:
+			j.timedOut = true
+			signalGroup(j.cmd, false)
+		case j.timedOut && elapsed >= j.timeout+timeoutGrace:
+			j.forced = true
+			signalGroup(j.cmd, true)
+		}
+	}
+}
+
+// finishJob completes the block of a command that exited, counts it as
+// unseen unless it is selected, and notifies about long commands. A
+// failed command is queued again while its retries last.
+func (m *model) finishJob(msg jobDoneMsg) tea.Cmd {
+	j, ok := m.jobs[msg.blockID]
+	if !ok {
+		return nil
+	}
+	delete(m.jobs, msg.blockID)
+	j.cleanup()
+	j.read()
+	j.output.Close()
+	os.Remove(j.output.Name())
+
+	// The next queued command takes the slot
+	defer m.startQueued()
+
+	idx := m.jobBlock(j)
+	if idx < 0 {
+		// The block was deleted while its command ran
+		m.stepDone(msg.blockID, false)
+		return nil
+	}
+
+	b := &m.blocks[idx]
+	delay, retry := m.finishAttempt(b, string(j.text), msg.err, j.started, j.attempt, j.timedOut, j.stopping)
+	if retry {
+		m.enqueueAttempt(queuedCommand{
+			command:   j.command,
+			history:   j.history,
+			attempt:   j.attempt + 1,
+			notBefore: time.Now().Add(delay),
+		}, b)
+		return nil
+	}
+	b.Unseen = idx != m.selectedIdx
+	elapsed := time.Since(b.Attempts[0].Started)
+
+	var cmd tea.Cmd
+	if m.notifyAfter > 0 && elapsed >= m.notifyAfter {
+		cmd = m.notify(*b, elapsed)
+	}
+	if j.history != "" {
+		m.recordHistory(j.history, b.ExitCode)
+	}
+	m.stepFinished(b.ID)
+	return cmd
+}
+
+// stopJobs kills the commands still running when gbloxs exits. Detached
+// commands are no longer among them.
+func (m model) stopJobs() {
+	for _, j := range m.jobs {
+		signalGroup(j.cmd, true)
+		j.cleanup()
+		j.output.Close()
+		os.Remove(j.output.Name())
+	}
+}
+
+// unseen counts the blocks that finished in the background and have not
+// been selected since.
+func (m model) unseen() int {
+	n := 0
+	for _, b := range m.blocks {
+		if b.Unseen {
+			n++
+		}
+	}
+	return n
+}
+
+// jobBlock is the index of the block a job runs for, or -1 when the block
+// was deleted.
+func (m model) jobBlock(j *job) int {
+	for i := range m.blocks {
+		if m.blocks[i].ID == j.blockID {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortedJobs lists the running jobs, oldest first.
+func (m model) sortedJobs() []*job {
+	list := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].started.Before(list[b].started)
+	})
+	return list
+}
+
+// killJob asks a job's processes to terminate; asking again while they
+// are still going kills them.
+func (m *model) killJob(j *job) {
+	if err := signalGroup(j.cmd, j.stopping); err != nil {
+		m.addInfoBlock(fmt.Sprintf("Stopping #%s failed: %v", j.blockID, err))
+		return
+	}
+	j.stopping = true
+}
+
+// detachJob lets a job's command run on without gbloxs. Its block is
+// finished where it stands and tells where the rest of the output goes;
+// the command is no longer killed when gbloxs exits. A step that is
+// detached counts as done for run all.
+func (m *model) detachJob(j *job) {
+	delete(m.jobs, j.blockID)
+	j.read()
+	// The command's file stays, and so do the inputs of its block
+	// references, which it may still read
+	j.output.Close()
+
+	defer m.startQueued()
+
+	idx := m.jobBlock(j)
+	if idx < 0 {
+		m.stepDone(j.blockID, false)
+		return
+	}
+	b := &m.blocks[idx]
+	b.IsLoading = false
+	b.ExitCode = 0
+	delete(b.Metadata, "executing")
+	b.Metadata["detached"] = fmt.Sprintf("pid %d, output in %s", j.cmd.Process.Pid, j.output.Name())
+	setOutput(b, string(j.text))
+	if j.history != "" {
+		m.recordHistory(j.history, 0)
+	}
+	m.stepFinished(j.blockID)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobOfShiftedBlock(t *testing.T) {
+	m := model{
+		blocks: []Block{
+			{ID: "1", Title: "first", Selected: true},
+			{ID: "2", Title: "sleep"},
+			{ID: "3", Title: "last"},
+		},
+		jobs:    make(map[string]*job),
+		jobDone: make(chan jobDoneMsg),
+	}
+	m.startCommand("sleep 0.2", &m.blocks[1])
+	if _, ok := m.jobs["2"]; !ok {
+		t.Fatal("command did not start")
+	}
+
+	// The block of the running command moves up, the one after it into
+	// its place
+	keyHandlers()["delete"](&m)
+
+	select {
+	case msg := <-m.jobDone:
+		if msg.blockID != "2" {
+			t.Fatalf("job of block 2 reported as %q", msg.blockID)
+		}
+		m.finishJob(msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("command did not finish")
+	}
+	if len(m.jobs) != 0 {
+		t.Errorf("jobs left: %v", m.jobs)
+	}
+	if b := m.blocks[0]; b.ID != "2" || b.IsLoading || b.Metadata["executing"] != "" {
+		t.Errorf("block %s still running: loading %v, %v", b.ID, b.IsLoading, b.Metadata)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// jobsSampleInterval is how often the open jobs panel rereads /proc.
+const jobsSampleInterval = time.Second
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat, USER_HZ,
+// which Linux fixes at 100.
+const clockTicks = 100
+
+// jobUsage is what /proc says about the processes of a job.
+type jobUsage struct {
+	procs int
+	ticks uint64 // CPU time used so far, including reaped children
+	rss   int64  // resident memory in bytes
+	// cpu is the share of one CPU used since the previous sample, known
+	// from the second sample on
+	cpu      float64
+	cpuKnown bool
+}
+
+// jobsPanel is the state of the jobs panel, which lists the running
+// commands and lets them be stopped or detached, followed by the queued
+// commands and retries.
+type jobsPanel struct {
+	active  bool
+	cursor  int
+	sampled time.Time
+}
+
+func (m *model) openJobsPanel() tea.Cmd {
+	if m.jobsPanel.active {
+		m.jobsPanel.active = false
+		return nil
+	}
+	m.jobsPanel.active = true
+	m.jobsPanel.cursor = 0
+	// Start at the selected block's job when it has one
+	for i, j := range m.sortedJobs() {
+		if m.selectedIdx < len(m.blocks) && j.blockID == m.blocks[m.selectedIdx].ID {
+			m.jobsPanel.cursor = i
+		}
+	}
+	m.sampleJobs()
+	return nil
+}
+
+// updateJobsPanel handles keys while the jobs panel is open.
+func (m *model) updateJobsPanel(msg tea.KeyMsg) tea.Cmd {
+	jobs := m.sortedJobs()
+	rows := len(jobs) + len(m.queue)
+	// The cursor is on a running job or, past them, a queued command
+	var current *job
+	queued := -1
+	if m.jobsPanel.cursor < len(jobs) {
+		current = jobs[m.jobsPanel.cursor]
+	} else if m.jobsPanel.cursor < rows {
+		queued = m.jobsPanel.cursor - len(jobs)
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Cancel), key.Matches(msg, m.keys.Jobs):
+		m.jobsPanel.active = false
+
+	case key.Matches(msg, m.keys.Up):
+		if m.jobsPanel.cursor > 0 {
+			m.jobsPanel.cursor--
+		}
+
+	case key.Matches(msg, m.keys.Down):
+		if m.jobsPanel.cursor < rows-1 {
+			m.jobsPanel.cursor++
+		}
+
+	case key.Matches(msg, m.keys.Submit):
+		id := ""
+		switch {
+		case current != nil:
+			id = current.blockID
+		case queued >= 0:
+			id = m.queue[queued].blockID
+		default:
+			return nil
+		}
+		if idx := m.blockIndex(id); idx >= 0 {
+			m.selectBlock(idx)
+		}
+		m.jobsPanel.active = false
+
+	case key.Matches(msg, m.keys.JobKill):
+		switch {
+		case current != nil:
+			m.killJob(current)
+		case queued >= 0:
+			// A queued command is dropped before it starts
+			m.dropQueued(queued)
+			if m.jobsPanel.cursor >= len(m.jobs)+len(m.queue) && m.jobsPanel.cursor > 0 {
+				m.jobsPanel.cursor--
+			}
+		}
+
+	case key.Matches(msg, m.keys.JobDetach):
+		if current != nil {
+			m.detachJob(current)
+			if m.jobsPanel.cursor >= len(m.jobs)+len(m.queue) && m.jobsPanel.cursor > 0 {
+				m.jobsPanel.cursor--
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectedJob is the job of the selected block, if it has one running.
+func (m model) selectedJob() *job {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	return m.jobs[m.blocks[m.selectedIdx].ID]
+}
+
+// killSelected stops the command of the selected block.
+func (m *model) killSelected() tea.Cmd {
+	if j := m.selectedJob(); j != nil {
+		m.killJob(j)
+	} else {
+		m.addInfoBlock("The selected block has no command running")
+	}
+	return nil
+}
+
+// detachSelected lets the command of the selected block run on its own.
+func (m *model) detachSelected() tea.Cmd {
+	if j := m.selectedJob(); j != nil {
+		m.detachJob(j)
+	} else {
+		m.addInfoBlock("The selected block has no command running")
+	}
+	return nil
+}
+
+// sampleJobs reads the CPU time and memory of every job from /proc. A
+// job's processes are its process group, so the commands it started
+// count too. Without /proc the usage stays unknown.
+func (m *model) sampleJobs() {
+	now := time.Now()
+	elapsed := now.Sub(m.jobsPanel.sampled).Seconds()
+	m.jobsPanel.sampled = now
+
+	groups := make(map[int]*jobUsage)
+	for _, j := range m.jobs {
+		groups[j.cmd.Process.Pid] = &jobUsage{}
+	}
+	if len(groups) == 0 {
+		return
+	}
+
+	entries, _ := os.ReadDir("/proc")
+	pageSize := int64(os.Getpagesize())
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name before the fields is in parentheses and may
+		// contain anything, spaces included
+		end := bytes.LastIndexByte(data, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[end+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+		pgrp, _ := strconv.Atoi(fields[2])
+		u, ok := groups[pgrp]
+		if !ok {
+			continue
+		}
+		u.procs++
+		// utime, stime, cutime and cstime
+		for _, f := range fields[11:15] {
+			ticks, _ := strconv.ParseUint(f, 10, 64)
+			u.ticks += ticks
+		}
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		u.rss += rss * pageSize
+	}
+
+	for _, j := range m.jobs {
+		u := groups[j.cmd.Process.Pid]
+		if u.procs > 0 && j.usage.procs > 0 && elapsed > 0 && u.ticks >= j.usage.ticks {
+			u.cpu = float64(u.ticks-j.usage.ticks) / clockTicks / elapsed * 100
+			u.cpuKnown = true
+		}
+		j.usage = *u
+	}
+}
+
+// renderJobsPanel draws the jobs panel overlay shown under the header.
+func (m model) renderJobsPanel() string {
+	var b strings.Builder
+	jobs := m.sortedJobs()
+	b.WriteString(m.styles.BlockTitle.Render(fmt.Sprintf("Jobs (%d running)", len(jobs))))
+
+	if len(jobs) == 0 {
+		b.WriteString("\n" + m.styles.Muted.Render("  no commands running"))
+	} else {
+		b.WriteString("\n" + m.styles.TableHeader.Render(fmt.Sprintf(" %-6s %-8s %-8s %6s %9s  %s", "BLOCK", "PID", "TIME", "CPU", "RSS", "COMMAND")))
+	}
+
+	width := m.width - 60
+	for i, j := range jobs {
+		command := strings.Join(j.cmd.Args[2:], " ")
+		if idx := m.jobBlock(j); idx >= 0 && m.blocks[idx].Command != "" {
+			command = m.blocks[idx].Command
+		}
+		command, _, _ = strings.Cut(command, "\n")
+		if width > 10 && len([]rune(command)) > width {
+			command = string([]rune(command)[:width-1]) + "…"
+		}
+
+		cpu, rss := "–", "–"
+		if j.usage.cpuKnown {
+			cpu = fmt.Sprintf("%.1f%%", j.usage.cpu)
+		}
+		if j.usage.procs > 0 {
+			rss = formatBytes(j.usage.rss)
+		}
+		row := fmt.Sprintf("%-6s %-8d %-8s %6s %9s  %s", "#"+j.blockID, j.cmd.Process.Pid,
+			time.Since(j.started).Round(time.Second), cpu, rss, command)
+
+		line := "  " + row
+		if i == m.jobsPanel.cursor {
+			line = m.styles.TableSelectedRow.Render("▶ " + row)
+		}
+		if j.stopping {
+			line += m.styles.ErrorText.Render("  stopping")
+		}
+		b.WriteString("\n" + line)
+	}
+
+	if limit := m.config.Jobs.MaxParallel; limit > 0 || len(m.queue) > 0 {
+		title := fmt.Sprintf("Queued (%d)", len(m.queue))
+		if limit > 0 {
+			title = fmt.Sprintf("Queued (%d, at most %d running)", len(m.queue), limit)
+		}
+		b.WriteString("\n\n" + m.styles.BlockTitle.Render(title))
+		if len(m.queue) == 0 {
+			b.WriteString("\n" + m.styles.Muted.Render("  no commands waiting"))
+		}
+		for i, q := range m.queue {
+			command, _, _ := strings.Cut(q.command, "\n")
+			if width > 10 && len([]rune(command)) > width {
+				command = string([]rune(command)[:width-1]) + "…"
+			}
+			waited := time.Since(q.queued).Round(time.Second).String()
+			if q.attempt > 1 {
+				// A retry shows how long until it runs
+				waited = "in " + shortDuration(max(time.Until(q.notBefore), 0))
+				command = fmt.Sprintf("↻ %d: %s", q.attempt, command)
+			}
+			row := fmt.Sprintf("%-6s %-8s %-8s %6s %9s  %s", "#"+q.blockID, "–", waited, "", "", command)
+			line := "  " + row
+			if len(jobs)+i == m.jobsPanel.cursor {
+				line = m.styles.TableSelectedRow.Render("▶ " + row)
+			}
+			b.WriteString("\n" + line)
+		}
+	}
+
+	var hints []string
+	for _, h := range []struct {
+		binding key.Binding
+		text    string
+	}{
+		{m.keys.Submit, "jump to block"},
+		{m.keys.JobKill, "kill (again to force) or unqueue"},
+		{m.keys.JobDetach, "detach"},
+		{m.keys.Cancel, "close"},
+	} {
+		if h.binding.Enabled() {
+			hints = append(hints, h.binding.Help().Key+": "+h.text)
+		}
+	}
+	b.WriteString("\n\n" + m.styles.Muted.Render(strings.Join(hints, " | ")))
+
+	return m.styles.HelpOverlay.Copy().
+		Padding(0, 1).
+		Width(m.width - 4).
+		Render(b.String())
+}
+
+// formatBytes shows a size in the largest binary unit that keeps it at
+// least 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n) / unit
+	suffix := "KiB"
+	for _, s := range []string{"MiB", "GiB", "TiB"} {
+		if value < unit {
+			break
+		}
+		value /= unit
+		suffix = s
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
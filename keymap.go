@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// KeyMap holds every key binding gbloxs responds to. The defaults can be
+// replaced per action from the keys section of config.yaml.
+type KeyMap struct {
+	// Navigation
+	Up           key.Binding
+	Down         key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	HalfPageUp   key.Binding
+	HalfPageDown key.Binding
+	Top          key.Binding
+	Bottom       key.Binding
+
+	// Block actions
+	Expand   key.Binding
+	Toggle   key.Binding
+	Copy     key.Binding
+	Refresh  key.Binding
+	Delete   key.Binding
+	Execute  key.Binding
+	Pipe     key.Binding
+	RunAll   key.Binding
+	Save     key.Binding
+	Attempts key.Binding
+	Alert    key.Binding
+
+	// Modes
+	Input     key.Binding
+	Help      key.Binding
+	Table     key.Binding
+	Split     key.Binding
+	FocusPane key.Binding
+	SwapPane  key.Binding
+	Theme     key.Binding
+	Palette   key.Binding
+	Jobs      key.Binding
+
+	// Jobs panel
+	JobKill   key.Binding
+	JobDetach key.Binding
+
+	// Input mode
+	Submit        key.Binding
+	Cancel        key.Binding
+	HistoryPrev   key.Binding
+	HistoryNext   key.Binding
+	HistorySearch key.Binding
+	Complete      key.Binding
+	CompletePrev  key.Binding
+	LeaveShell    key.Binding
+
+	// Script editor
+	Multiline      key.Binding
+	EditorSubmit   key.Binding
+	ExternalEditor key.Binding
+
+	// General
+	Clear key.Binding
+	Quit  key.Binding
+}
+
+// keyAction ties a binding to the name used for it in config.yaml and the
+// text shown for it in the help overlay.
+type keyAction struct {
+	section string
+	name    string
+	desc    string
+	binding *key.Binding
+}
+
+const (
+	inputSection = "Input Mode"
+	jobsSection  = "Jobs Panel"
+)
+
+// modalSections have their own key space: their keys only apply while
+// the mode is on.
+var modalSections = map[string]bool{inputSection: true, jobsSection: true}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up:           key.NewBinding(key.WithKeys("k", "up"), key.WithHelp("k/↑", "up")),
+		Down:         key.NewBinding(key.WithKeys("j", "down"), key.WithHelp("j/↓", "down")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "page up")),
+		PageDown:     key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "page down")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("ctrl+u", "half page up")),
+		HalfPageDown: key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "half page down")),
+		Top:          key.NewBinding(key.WithKeys("home"), key.WithHelp("home", "top")),
+		Bottom:       key.NewBinding(key.WithKeys("end"), key.WithHelp("end", "bottom")),
+
+		Expand:   key.NewBinding(key.WithKeys("e", "E"), key.WithHelp("e", "expand")),
+		Toggle:   key.NewBinding(key.WithKeys(" ", "enter"), key.WithHelp("space/enter", "toggle")),
+		Copy:     key.NewBinding(key.WithKeys("c", "C"), key.WithHelp("c", "copy")),
+		Refresh:  key.NewBinding(key.WithKeys("r", "R"), key.WithHelp("r", "refresh")),
+		Delete:   key.NewBinding(key.WithKeys("d", "D"), key.WithHelp("d", "delete")),
+		Execute:  key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "execute")),
+		Pipe:     key.NewBinding(key.WithKeys("|"), key.WithHelp("|", "pipe into")),
+		RunAll:   key.NewBinding(key.WithKeys("X"), key.WithHelp("X", "run all")),
+		Save:     key.NewBinding(key.WithKeys("ctrl+s"), key.WithHelp("ctrl+s", "save")),
+		Attempts: key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "attempts")),
+		Alert:    key.NewBinding(key.WithKeys("!"), key.WithHelp("!", "next alert")),
+
+		Input:     key.NewBinding(key.WithKeys("i", "I"), key.WithHelp("i", "input")),
+		Help:      key.NewBinding(key.WithKeys("h", "H"), key.WithHelp("h", "help")),
+		Table:     key.NewBinding(key.WithKeys("t", "T"), key.WithHelp("t", "table")),
+		Split:     key.NewBinding(key.WithKeys("s", "S"), key.WithHelp("s", "split")),
+		FocusPane: key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "focus pane")),
+		SwapPane:  key.NewBinding(key.WithKeys("o", "O"), key.WithHelp("o", "pane contents")),
+		Theme:     key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "theme")),
+		Palette:   key.NewBinding(key.WithKeys("ctrl+p"), key.WithHelp("ctrl+p", "palette")),
+		Jobs:      key.NewBinding(key.WithKeys("J"), key.WithHelp("J", "jobs")),
+
+		JobKill:   key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "kill")),
+		JobDetach: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "detach")),
+
+		Submit:        key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "submit")),
+		Cancel:        key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel")),
+		HistoryPrev:   key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("↑/ctrl+p", "older")),
+		HistoryNext:   key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("↓/ctrl+n", "newer")),
+		HistorySearch: key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "search history")),
+		Complete:      key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "complete")),
+		CompletePrev:  key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "previous completion")),
+		LeaveShell:    key.NewBinding(key.WithKeys("ctrl+]"), key.WithHelp("ctrl+]", "leave shell")),
+
+		Multiline:      key.NewBinding(key.WithKeys("alt+enter"), key.WithHelp("alt+enter", "multi-line")),
+		EditorSubmit:   key.NewBinding(key.WithKeys("ctrl+s"), key.WithHelp("ctrl+s", "run script")),
+		ExternalEditor: key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("ctrl+o", "edit in $EDITOR")),
+
+		Clear: key.NewBinding(key.WithKeys("ctrl+l"), key.WithHelp("ctrl+l", "clear")),
+		Quit:  key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+	}
+}
+
+// actions lists every binding in help order.
+func (k *KeyMap) actions() []keyAction {
+	return []keyAction{
+		{"Navigation", "down", "Navigate down to next block", &k.Down},
+		{"Navigation", "up", "Navigate up to previous block", &k.Up},
+		{"Navigation", "page_up", "Scroll up a page", &k.PageUp},
+		{"Navigation", "page_down", "Scroll down a page", &k.PageDown},
+		{"Navigation", "half_page_up", "Scroll pane up half a page", &k.HalfPageUp},
+		{"Navigation", "half_page_down", "Scroll pane down half a page", &k.HalfPageDown},
+		{"Navigation", "top", "Scroll pane to the top", &k.Top},
+		{"Navigation", "bottom", "Scroll pane to the bottom", &k.Bottom},
+
+		{"Block Actions", "expand", "Expand/collapse selected block", &k.Expand},
+		{"Block Actions", "toggle", "Toggle block expansion", &k.Toggle},
+		{"Block Actions", "copy", "Copy block content to clipboard", &k.Copy},
+		{"Block Actions", "refresh", "Refresh/reload block content", &k.Refresh},
+		{"Block Actions", "delete", "Delete selected block", &k.Delete},
+		{"Block Actions", "execute", "Run command of selected block, then select the next step", &k.Execute},
+		{"Block Actions", "pipe", "Pipe output of selected block into a new command", &k.Pipe},
+		{"Block Actions", "run_all", "Run all steps, by default stopping at the first failure", &k.RunAll},
+		{"Block Actions", "save", "Save the runbook or notebook with the results", &k.Save},
+		{"Block Actions", "attempts", "Show or hide the attempts of a retried command", &k.Attempts},
+		{"Block Actions", "next_alert", "Jump to the line of the latest alert, then earlier ones", &k.Alert},
+
+		{"Modes", "input", "Toggle input mode", &k.Input},
+		{"Modes", "help", "Toggle help (this screen)", &k.Help},
+		{"Modes", "table", "Toggle table view", &k.Table},
+		{"Modes", "split", "Cycle split layout", &k.Split},
+		{"Modes", "focus_pane", "Move focus to the other pane", &k.FocusPane},
+		{"Modes", "swap_pane", "Switch pane between blocks and output", &k.SwapPane},
+		{"Modes", "theme", "Switch to the next color theme", &k.Theme},
+		{"Modes", "palette", "Open the command palette", &k.Palette},
+		{"Modes", "jobs", "Show the running commands", &k.Jobs},
+
+		{jobsSection, "job_kill", "Stop the command; again to kill it", &k.JobKill},
+		{jobsSection, "job_detach", "Let the command run on without gbloxs", &k.JobDetach},
+
+		{inputSection, "submit", "Submit input", &k.Submit},
+		{inputSection, "cancel", "Cancel input", &k.Cancel},
+		{inputSection, "history_prev", "Recall older input", &k.HistoryPrev},
+		{inputSection, "history_next", "Recall newer input", &k.HistoryNext},
+		{inputSection, "history_search", "Fuzzy search input history", &k.HistorySearch},
+		{inputSection, "complete", "Complete command, path or branch", &k.Complete},
+		{inputSection, "complete_prev", "Previous completion candidate", &k.CompletePrev},
+		{inputSection, "leave_shell", "Stop sending keys to the hosted shell", &k.LeaveShell},
+		{inputSection, "multiline", "Continue on a new line in the script editor", &k.Multiline},
+		{inputSection, "editor_submit", "Run the script in the editor", &k.EditorSubmit},
+		{inputSection, "external_editor", "Edit input in $EDITOR and run it", &k.ExternalEditor},
+
+		{"General", "clear", "Clear all blocks", &k.Clear},
+		{"General", "quit", "Quit application", &k.Quit},
+	}
+}
+
+// Apply replaces the keys of every action named in overrides and returns a
+// warning for each unknown action and each key bound to more than one action.
+func (k *KeyMap) Apply(overrides map[string][]string) []string {
+	var warnings []string
+
+	byName := make(map[string]*key.Binding)
+	for _, a := range k.actions() {
+		byName[a.name] = a.binding
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, ok := byName[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("keys: unknown action %q", name))
+			continue
+		}
+
+		keys := overrides[name]
+		if len(keys) == 0 {
+			b.SetEnabled(false)
+			continue
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(keyLabel(keys), b.Help().Desc)
+		b.SetEnabled(true)
+	}
+
+	return append(warnings, k.conflicts()...)
+}
+
+// conflicts reports keys shared by two actions that are active at the same
+// time. Input mode and the jobs panel have their own key spaces.
+func (k *KeyMap) conflicts() []string {
+	var warnings []string
+	owner := make(map[string]string)
+
+	for _, a := range k.actions() {
+		if !a.binding.Enabled() {
+			continue
+		}
+		for _, kk := range a.binding.Keys() {
+			id := kk
+			if modalSections[a.section] {
+				id = a.section + ":" + kk
+			}
+			if prev, ok := owner[id]; ok {
+				warnings = append(warnings, fmt.Sprintf("keys: %q is bound to both %s and %s", kk, prev, a.name))
+				continue
+			}
+			owner[id] = a.name
+		}
+	}
+
+	return warnings
+}
+
+// keyLabel formats keys the way the help overlay shows them.
+func keyLabel(keys []string) string {
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		switch k {
+		case "up":
+			labels[i] = "↑"
+		case "down":
+			labels[i] = "↓"
+		case " ":
+			labels[i] = "space"
+		default:
+			labels[i] = k
+		}
+	}
+	return strings.Join(labels, "/")
+}
+
+// footer is the one-line shortcut summary shown under the blocks.
+func (k KeyMap) footer() string {
+	var parts []string
+	add := func(bindings ...key.Binding) {
+		for _, b := range bindings {
+			if b.Enabled() {
+				parts = append(parts, fmt.Sprintf("%s: %s", b.Help().Key, b.Help().Desc))
+			}
+		}
+	}
+
+	add(k.Input, k.Palette, k.Help)
+	if k.Down.Enabled() && k.Up.Enabled() {
+		parts = append(parts, fmt.Sprintf("%s/%s: navigate", keyLabel(k.Down.Keys()[:1]), keyLabel(k.Up.Keys()[:1])))
+	}
+	add(k.Expand, k.Copy, k.Refresh, k.Delete, k.Execute, k.Table, k.Split, k.Quit)
+
+	return strings.Join(parts, " | ")
+}
+
+// helpSections renders the help overlay's shortcut listing, grouped the way
+// actions are.
+func (k *KeyMap) helpSections() string {
+	var b strings.Builder
+	section := ""
+
+	for _, a := range k.actions() {
+		if a.section != section {
+			if section != "" {
+				b.WriteString("\n")
+			}
+			section = a.section
+			b.WriteString(section + ":\n")
+		}
+
+		label := a.binding.Help().Key
+		if !a.binding.Enabled() {
+			label = "(unbound)"
+		}
+		b.WriteString(fmt.Sprintf("  %-14s %s\n", label, a.desc))
+	}
+
+	return b.String()
+}
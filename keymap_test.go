@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyMapApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string][]string
+		warnings  []string
+	}{
+		// x, d, tab, enter and ctrl+s each have a meaning in normal mode
+		// and another in input mode or the jobs panel
+		{name: "defaults"},
+		{
+			name:      "clash in input mode",
+			overrides: map[string][]string{"complete": {"ctrl+x"}, "multiline": {"ctrl+x"}},
+			warnings:  []string{`keys: "ctrl+x" is bound to both complete and multiline`},
+		},
+		{
+			name:      "clash in the jobs panel",
+			overrides: map[string][]string{"job_detach": {"x"}},
+			warnings:  []string{`keys: "x" is bound to both job_kill and job_detach`},
+		},
+		{
+			name:      "clash across normal mode sections",
+			overrides: map[string][]string{"copy": {"z"}, "theme": {"Z", "z"}},
+			warnings:  []string{`keys: "z" is bound to both copy and theme`},
+		},
+		{
+			name:      "clash with a default",
+			overrides: map[string][]string{"split": {"q"}},
+			warnings:  []string{`keys: "q" is bound to both split and quit`},
+		},
+		{
+			name:      "same key in each section",
+			overrides: map[string][]string{"copy": {"ctrl+x"}, "complete": {"ctrl+x"}, "job_kill": {"ctrl+x"}},
+		},
+		{
+			name:      "unbound action frees its key",
+			overrides: map[string][]string{"split": {"q"}, "quit": {}},
+		},
+		{
+			name:      "unknown action",
+			overrides: map[string][]string{"explode": {"b"}},
+			warnings:  []string{`keys: unknown action "explode"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := DefaultKeyMap()
+			warnings := k.Apply(tt.overrides)
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestKeyMapApplyRebinds(t *testing.T) {
+	k := DefaultKeyMap()
+	k.Apply(map[string][]string{"copy": {"y", "up"}, "quit": {}})
+
+	if got := k.Copy.Keys(); !reflect.DeepEqual(got, []string{"y", "up"}) {
+		t.Errorf("copy keys = %q", got)
+	}
+	if got := k.Copy.Help().Key; got != "y/↑" {
+		t.Errorf("copy label = %q", got)
+	}
+	if k.Quit.Enabled() {
+		t.Error("quit is still bound")
+	}
+	help := k.helpSections()
+	if !strings.Contains(help, "(unbound)") || !strings.Contains(help, "y/↑") {
+		t.Errorf("help does not show the new bindings:\n%s", help)
+	}
+	if strings.Contains(k.footer(), "Quit") {
+		t.Errorf("footer shows an unbound action: %s", k.footer())
+	}
+}
+
+func TestKeysFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "gbloxs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := "keys:\n  copy: [y]\n  delete: []\n  down: [n, down]\n  expand: y\n"
+	if err := os.WriteFile(configPath(), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConfig()
+	if err == nil || !strings.Contains(err.Error(), "config.yaml") {
+		t.Fatalf("a key that is not a list: err = %v", err)
+	}
+
+	config = "keys:\n  copy: [y]\n  delete: []\n  down: [n, down]\n  expand: [y]\n"
+	if err := os.WriteFile(configPath(), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := DefaultKeyMap()
+	warnings := k.Apply(cfg.Keys)
+	if want := []string{`keys: "y" is bound to both expand and copy`}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+	if k.Delete.Enabled() || !reflect.DeepEqual(k.Down.Keys(), []string{"n", "down"}) {
+		t.Errorf("delete enabled %v, down keys %q", k.Delete.Enabled(), k.Down.Keys())
+	}
+}
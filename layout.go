@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// splitMode describes how the area between the header and the footer is
+// divided into panes.
+type splitMode int
+
+const (
+	splitNone       splitMode = iota // single block list, no panes
+	splitVertical                    // two panes side by side
+	splitHorizontal                  // two panes stacked
+)
+
+// paneKind selects what a pane shows.
+type paneKind int
+
+const (
+	paneBlocks paneKind = iota // the block list
+	paneOutput                 // the full output of the selected block
+)
+
+// pane is one independently scrollable region of the split layout.
+type pane struct {
+	kind     paneKind
+	viewport viewport.Model
+	// source is the ID of the block that was selected when the pane was last
+	// synced. A change means the pane has to scroll to the new selection.
+	source string
+}
+
+// paneRect is the screen area occupied by a pane, border included.
+type paneRect struct {
+	x, y          int
+	width, height int
+}
+
+func newPanes() [2]pane {
+	return [2]pane{
+		{kind: paneBlocks, viewport: viewport.New(0, 0)},
+		{kind: paneOutput, viewport: viewport.New(0, 0)},
+	}
+}
+
+// cycleSplit moves to the next layout: none, side by side, stacked.
+func (m *model) cycleSplit() {
+	switch m.split {
+	case splitNone:
+		m.split = splitVertical
+	case splitVertical:
+		m.split = splitHorizontal
+	default:
+		m.split = splitNone
+		m.focusedPane = 0
+	}
+	for i := range m.panes {
+		m.panes[i].source = ""
+	}
+}
+
+// handlePaneKey handles keys that only make sense while the layout is split.
+// It reports whether the key was consumed.
+func (m *model) handlePaneKey(msg tea.KeyMsg) bool {
+	p := &m.panes[m.focusedPane]
+
+	switch {
+	case key.Matches(msg, m.keys.FocusPane):
+		m.focusedPane = (m.focusedPane + 1) % len(m.panes)
+
+	case key.Matches(msg, m.keys.SwapPane):
+		// Flip the focused pane between block list and output
+		if p.kind == paneBlocks {
+			p.kind = paneOutput
+		} else {
+			p.kind = paneBlocks
+		}
+		p.source = ""
+		p.viewport.GotoTop()
+
+	case key.Matches(msg, m.keys.PageUp):
+		p.viewport.ViewUp()
+	case key.Matches(msg, m.keys.PageDown):
+		p.viewport.ViewDown()
+	case key.Matches(msg, m.keys.HalfPageUp):
+		p.viewport.HalfViewUp()
+	case key.Matches(msg, m.keys.HalfPageDown):
+		p.viewport.HalfViewDown()
+	case key.Matches(msg, m.keys.Top):
+		p.viewport.GotoTop()
+	case key.Matches(msg, m.keys.Bottom):
+		p.viewport.GotoBottom()
+
+	// Output panes scroll; block panes fall through to selection
+	case p.kind == paneOutput && key.Matches(msg, m.keys.Down):
+		p.viewport.LineDown(1)
+	case p.kind == paneOutput && key.Matches(msg, m.keys.Up):
+		p.viewport.LineUp(1)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// paneRects computes where each pane goes given the already rendered chrome
+// above and below the body.
+func (m model) paneRects(top, bottom string) [2]paneRect {
+	y := strings.Count(top, "\n")
+	height := m.height - y - strings.Count(bottom, "\n") - 1
+	if height < 4 {
+		height = 4
+	}
+
+	if m.split == splitHorizontal {
+		upper := height / 2
+		return [2]paneRect{
+			{x: 0, y: y, width: m.width, height: upper},
+			{x: 0, y: y + upper, width: m.width, height: height - upper},
+		}
+	}
+
+	left := m.width / 2
+	return [2]paneRect{
+		{x: 0, y: y, width: left, height: height},
+		{x: left, y: y, width: m.width - left, height: height},
+	}
+}
+
+// syncPanes refreshes pane content and sizes after an update that may have
+// changed the blocks, so that View only has to draw them. Scroll positions
+// survive unless the selected block changed, in which case the focused
+// block pane follows the selection and output panes jump back to the top.
+func (m *model) syncPanes() {
+	if m.split == splitNone || m.width == 0 {
+		return
+	}
+
+	rects := m.paneRects(m.renderTop(), m.renderBottom())
+	selectedID := ""
+	if m.selectedIdx < len(m.blocks) {
+		selectedID = m.blocks[m.selectedIdx].ID
+	}
+
+	for i := range m.panes {
+		p := &m.panes[i]
+		p.viewport.Width = rects[i].width - 2
+		p.viewport.Height = rects[i].height - 2
+		changed := p.source != selectedID
+		p.source = selectedID
+
+		switch p.kind {
+		case paneBlocks:
+			content, spans := m.renderBlockList(p.viewport.Width)
+			p.viewport.SetContent(content)
+			if changed && i == m.focusedPane && m.selectedIdx < len(spans) {
+				revealLines(&p.viewport, spans[m.selectedIdx])
+			}
+
+		case paneOutput:
+			p.viewport.SetContent(m.renderFullOutput(p.viewport.Width))
+			if changed {
+				p.viewport.GotoTop()
+			}
+		}
+	}
+}
+
+// layoutPanes is syncPanes for updates that leave the blocks alone, such
+// as typing into the input: the panes are rendered again only when one of
+// them changed size or the selection moved.
+func (m *model) layoutPanes() {
+	if m.split == splitNone || m.width == 0 {
+		return
+	}
+
+	rects := m.paneRects(m.renderTop(), m.renderBottom())
+	selectedID := ""
+	if m.selectedIdx < len(m.blocks) {
+		selectedID = m.blocks[m.selectedIdx].ID
+	}
+	for i, p := range m.panes {
+		if p.viewport.Width != rects[i].width-2 || p.viewport.Height != rects[i].height-2 || p.source != selectedID {
+			m.syncPanes()
+			return
+		}
+	}
+}
+
+// live reports whether the blocks change on their own, without input:
+// while commands run or wait, sources are read, progress moves or a
+// border flashes.
+func (m model) live() bool {
+	if len(m.jobs) > 0 || len(m.queue) > 0 {
+		return true
+	}
+	for _, b := range m.blocks {
+		if b.IsLoading {
+			return true
+		}
+	}
+	for _, hit := range m.alerts.flashes {
+		// One more period draws the border without the flash
+		if time.Since(hit.time) <= alertFlashFor+alertFlashPeriod {
+			return true
+		}
+	}
+	return false
+}
+
+// lineSpan is the half-open range of rendered lines [start, end).
+type lineSpan struct {
+	start, end int
+}
+
+// revealLines scrolls vp the minimum amount needed to show span, preferring
+// its start when the span is taller than vp.
+func revealLines(vp *viewport.Model, span lineSpan) {
+	switch {
+	case span.start < vp.YOffset || span.end-span.start > vp.Height:
+		vp.SetYOffset(span.start)
+	case span.end > vp.YOffset+vp.Height:
+		vp.SetYOffset(span.end - vp.Height)
+	}
+}
+
+// renderBlockList renders every block at the given width and returns the
+// lines each one occupies.
+func (m model) renderBlockList(width int) (string, []lineSpan) {
+	var b strings.Builder
+	spans := make([]lineSpan, len(m.blocks))
+	line := 0
+
+	for i, block := range m.blocks {
+		rendered := m.renderBlockWidth(block, i == m.selectedIdx, width)
+		height := lipgloss.Height(rendered)
+		spans[i] = lineSpan{start: line, end: line + height}
+		b.WriteString(rendered)
+		b.WriteString("\n")
+		line += height
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), spans
+}
+
+// renderFullOutput renders everything the selected block produced, without
+// the block frame, for display in an output pane.
+func (m model) renderFullOutput(width int) string {
+	if m.selectedIdx >= len(m.blocks) {
+		return m.styles.Muted.Render("  No block selected")
+	}
+
+	block := m.blocks[m.selectedIdx]
+	var content strings.Builder
+
+	content.WriteString(m.styles.BlockTitle.Render(block.Title))
+	content.WriteString("\n")
+
+	if block.Command != "" {
+		content.WriteString(m.styles.CommandLine.Render(fmt.Sprintf("  $ %s", block.Command)))
+		content.WriteString("\n\n")
+	}
+
+	switch {
+	case len(block.TableData) > 0:
+		content.WriteString(m.renderTable(block.TableData))
+	case block.Output != "":
+		content.WriteString(m.renderOutput(block.Output))
+	case block.Content != "":
+		content.WriteString(m.renderOutput(block.Content))
+	}
+
+	if block.Error != "" {
+		content.WriteString(m.styles.ErrorText.Render("  ✗ " + block.Error))
+	}
+
+	return lipgloss.NewStyle().Width(width).Render(content.String())
+}
+
+// renderPanes draws both panes, highlighting the border of the focused one.
+func (m model) renderPanes(rects [2]paneRect) string {
+	rendered := make([]string, len(m.panes))
+
+	for i, p := range m.panes {
+		style := m.styles.Pane
+		if i == m.focusedPane {
+			style = m.styles.FocusedPane
+		}
+
+		// Size the viewport for this frame; the stored one may lag a resize
+		vp := p.viewport
+		vp.Width = rects[i].width - 2
+		vp.Height = rects[i].height - 2
+
+		rendered[i] = style.Render(vp.View())
+	}
+
+	if m.split == splitHorizontal {
+		return lipgloss.JoinVertical(lipgloss.Left, rendered...)
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, rendered...)
+}
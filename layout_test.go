@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// splitModel is a model split side by side, its panes rendered.
+func splitModel(t *testing.T) model {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	m := newModel([]Block{
+		{ID: "1", Title: "first", Command: "ls", Output: "one\n", Type: BlockTypeSuccess, Expanded: true, Timestamp: time.Now()},
+		{ID: "2", Title: "second", Command: "ls", Output: "two\n", Type: BlockTypeSuccess, Expanded: true, Timestamp: time.Now()},
+	})
+	m.width, m.height = 100, 40
+	m.split = splitVertical
+	m.syncPanes()
+	return m
+}
+
+func TestLayoutPanes(t *testing.T) {
+	shows := func(m model, text string) bool {
+		return strings.Contains(m.panes[0].viewport.View(), text) && strings.Contains(m.panes[1].viewport.View(), text)
+	}
+
+	m := splitModel(t)
+	if !shows(m, "one") {
+		t.Fatal("panes not rendered")
+	}
+
+	// Changed behind the panes' back, as only syncPanes may notice
+	m.blocks[0].Output = "changed\n"
+	m.layoutPanes()
+	if shows(m, "changed") {
+		t.Error("rendered again though nothing moved")
+	}
+
+	m.width = 90
+	m.layoutPanes()
+	if !shows(m, "changed") {
+		t.Error("not rendered again after a resize")
+	}
+
+	m.blocks[1].Output = "moved\n"
+	m.selectBlock(1)
+	m.layoutPanes()
+	if !strings.Contains(m.panes[1].viewport.View(), "moved") {
+		t.Error("output pane does not show the new selection")
+	}
+}
+
+func TestTypingLeavesPanes(t *testing.T) {
+	m := splitModel(t)
+	m.inputMode, m.showInput = true, true
+	m.syncPanes()
+	m.blocks[0].Output = "changed\n"
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	m = next.(model)
+	if m.textInput.Value() != "x" {
+		t.Fatalf("input = %q", m.textInput.Value())
+	}
+	if strings.Contains(m.panes[1].viewport.View(), "changed") {
+		t.Error("typing rendered the panes again")
+	}
+
+	// Submitting adds a block
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if !strings.Contains(m.panes[0].viewport.View(), "User Input") {
+		t.Error("submitting did not render the panes again")
+	}
+}
+
+func TestLive(t *testing.T) {
+	tests := []struct {
+		name string
+		m    model
+		want bool
+	}{
+		{name: "idle", m: model{blocks: []Block{{ID: "1"}}}},
+		{name: "loading", m: model{blocks: []Block{{ID: "1"}, {ID: "2", IsLoading: true}}}, want: true},
+		{name: "job", m: model{jobs: map[string]*job{"1": {}}}, want: true},
+		{name: "queued", m: model{queue: []queuedCommand{{blockID: "1"}}}, want: true},
+		{name: "flashing", m: model{alerts: alerts{flashes: map[string]alertHit{"1": {time: time.Now()}}}}, want: true},
+		{name: "flashed", m: model{alerts: alerts{flashes: map[string]alertHit{"1": {time: time.Now().Add(-time.Minute)}}}}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.live(); got != tt.want {
+			t.Errorf("%s: live = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
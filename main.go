@@ -1,17 +1,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -33,8 +38,29 @@ type Block struct {
 	Command   string
 	Output    string
 	Error     string
+	ExitCode  int
 	TableData [][]string
 	Viewport  viewport.Model
+	// Expected is the output a command should produce, kept in notebooks
+	Expected string
+	// Assertions are the expectations the command's result is checked
+	// against; Checks are how they fared on its last run
+	Assertions []Assertion
+	Checks     []Check
+	// Policy overrides the configured timeout and retries of the command
+	Policy *RunPolicy
+	// Attempts are the runs of the command's last execution, more than
+	// one when it was retried; ShowAttempts expands what each printed
+	Attempts     []Attempt
+	ShowAttempts bool
+	// Unseen marks a command that finished in the background and has not
+	// been selected since
+	Unseen bool
+	// Alerts counts the lines that matched an alert rule since the block
+	// was last selected
+	Alerts int
+	// Notice marks status messages, which are not saved with a notebook
+	Notice bool
 }
 
 type BlockType string
@@ -59,10 +85,60 @@ type model struct {
 	textInput   textinput.Model
 	showInput   bool
 	inputMode   bool
+	multiline   bool
+	editor      textarea.Model
 	styles      Styles
 	table       table.Model
 	showTable   bool
 	helpMode    bool
+	split       splitMode
+	panes       [2]pane
+	focusedPane int
+	keys        KeyMap
+	theme       Theme
+	themes      []Theme
+	history     History
+	search      historySearch
+	palette     palette
+	config      Config
+	// runbook is the Markdown runbook the blocks came from, if any
+	runbook *runbook
+	// notebook is the .gbx file the blocks are saved to, if any
+	notebook *notebook
+	// lastID is the highest block ID handed out so far
+	lastID int
+	// pipeFrom is the ID of the block whose output the input is piped from
+	pipeFrom string
+	// expectFor is the ID of the block the input adds an expectation to
+	expectFor string
+	// startup is run once the UI is up, for gbloxs run and replay
+	startup *startupMsg
+	// jobs are the commands running in the background, by block ID
+	jobs map[string]*job
+	// jobDone receives the commands that exited
+	jobDone   chan jobDoneMsg
+	jobsPanel jobsPanel
+	// queue holds the commands waiting for a free job slot, oldest first
+	queue []queuedCommand
+	// steps is the run of steps going on, if any
+	steps *stepRun
+	// notifyAfter is how long a command runs before its end is notified
+	notifyAfter time.Duration
+	// alerts are the alert rules and the lines that matched them
+	alerts alerts
+	// git is the repository state the status bar shows
+	git gitInfo
+	// streamed is the data read into stream blocks since the last tick, by
+	// block ID
+	streamed map[string]*strings.Builder
+	// shell is the hosted shell of gbloxs shell, if any
+	shell      *shellSession
+	workflows  []Workflow
+	workflow   workflowForm
+	cwd        string
+	completion completion
+	// pathCommands caches the executables found on $PATH for completion
+	pathCommands []string
 }
 
 type Styles struct {
@@ -75,95 +151,214 @@ type Styles struct {
 	ErrorBlock        lipgloss.Style
 	SuccessBlock      lipgloss.Style
 	InfoBlock         lipgloss.Style
+	ProgressBlock     lipgloss.Style
+	TableBlock        lipgloss.Style
 	ProgressBar       lipgloss.Style
 	TableHeader       lipgloss.Style
 	TableCell         lipgloss.Style
 	TableSelectedCell lipgloss.Style
+	TableSelectedRow  lipgloss.Style
+	TableBorder       lipgloss.Style
+
+	Header      lipgloss.Style
+	HelpOverlay lipgloss.Style
+	TableBox    lipgloss.Style
+	InputBox    lipgloss.Style
+	Footer      lipgloss.Style
+	Pane        lipgloss.Style
+	FocusedPane lipgloss.Style
+	Spinner     lipgloss.Style
+
+	Muted       lipgloss.Style
+	CommandLine lipgloss.Style
+	ErrorText   lipgloss.Style
+	SuccessText lipgloss.Style
+
+	// Output highlighting
+	OutputText  lipgloss.Style
+	Directory   lipgloss.Style
+	Executable  lipgloss.Style
+	File        lipgloss.Style
+	ErrorLine   lipgloss.Style
+	SuccessLine lipgloss.Style
+	Number      lipgloss.Style
+	Path        lipgloss.Style
+	URL         lipgloss.Style
+
+	// Shell syntax in the script editor
+	SyntaxCommand  lipgloss.Style
+	SyntaxKeyword  lipgloss.Style
+	SyntaxString   lipgloss.Style
+	SyntaxVariable lipgloss.Style
+	SyntaxOperator lipgloss.Style
+	SyntaxComment  lipgloss.Style
+	MatchBracket   lipgloss.Style
+	Unmatched      lipgloss.Style
+	Cursor         lipgloss.Style
 }
 
-func NewStyles() Styles {
+func NewStyles(t Theme) Styles {
+	frame := func(bt BlockType) lipgloss.Style {
+		return lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(t.border(bt)).
+			Padding(1, 2)
+	}
+	fg := func(c string) lipgloss.Style {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(c))
+	}
+
 	return Styles{
 		BlockBorder: lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("62")).
+			BorderForeground(lipgloss.Color(t.Border)).
 			Padding(1, 2),
 
-		BlockTitle: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
+		BlockTitle: fg(t.Title).
 			Bold(true).
 			MarginBottom(1),
 
-		BlockContent: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252")).
+		BlockContent: fg(t.Content).
 			MarginTop(1),
 
 		SelectedBlock: lipgloss.NewStyle().
 			Border(lipgloss.DoubleBorder()).
-			BorderForeground(lipgloss.Color("39")).
+			BorderForeground(lipgloss.Color(t.SelectedBorder)).
 			Padding(1, 2),
 
-		CommandBlock: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("220")).
-			Padding(1, 2),
+		CommandBlock:  frame(BlockTypeCommand),
+		OutputBlock:   frame(BlockTypeOutput),
+		ErrorBlock:    frame(BlockTypeError),
+		SuccessBlock:  frame(BlockTypeSuccess),
+		InfoBlock:     frame(BlockTypeInfo),
+		ProgressBlock: frame(BlockTypeProgress),
+		TableBlock:    frame(BlockTypeTable),
+
+		ProgressBar: fg(t.Title),
+
+		TableHeader: fg(t.TableHeader).
+			Bold(true).
+			Padding(0, 1),
 
-		OutputBlock: lipgloss.NewStyle().
+		TableCell: fg(t.TableCell).
+			Padding(0, 1),
+
+		TableSelectedCell: fg(t.Accent).
+			Bold(true).
+			Padding(0, 1),
+
+		TableSelectedRow: fg(t.TableSelectedForeground).
+			Background(lipgloss.Color(t.TableSelectedBackground)).
+			Bold(false),
+
+		TableBorder: fg(t.TableBorder),
+
+		Header: fg(t.Title).
+			Bold(true).
+			Align(lipgloss.Center).
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("34")).
-			Padding(1, 2),
+			BorderForeground(lipgloss.Color(t.HeaderBorder)).
+			Padding(0, 1),
 
-		ErrorBlock: lipgloss.NewStyle().
+		HelpOverlay: lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("196")).
-			Padding(1, 2),
+			BorderForeground(lipgloss.Color(t.Accent)).
+			Padding(1, 2).
+			Background(lipgloss.Color(t.OverlayBackground)),
 
-		SuccessBlock: lipgloss.NewStyle().
+		TableBox: lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("46")).
+			BorderForeground(t.border(BlockTypeOutput)).
 			Padding(1, 2),
 
-		InfoBlock: lipgloss.NewStyle().
+		InputBox: lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("39")).
+			BorderForeground(lipgloss.Color(t.Command)).
 			Padding(1, 2),
 
-		ProgressBar: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")),
+		Footer: fg(t.Muted).
+			Italic(true).
+			Align(lipgloss.Center),
 
-		TableHeader: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
-			Bold(true).
-			Padding(0, 1),
-
-		TableCell: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252")).
-			Padding(0, 1),
+		Pane: lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(t.Muted)),
 
-		TableSelectedCell: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("39")).
-			Bold(true).
-			Padding(0, 1),
+		FocusedPane: lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(t.Accent)),
+
+		Spinner: fg(t.Title),
+
+		Muted:       fg(t.Muted),
+		CommandLine: fg(t.Command),
+		ErrorText:   fg(t.Error),
+		SuccessText: fg(t.Success),
+
+		OutputText:  fg(t.Content),
+		Directory:   fg(t.Highlight.Directory),
+		Executable:  fg(t.Highlight.Executable),
+		File:        fg(t.Highlight.File),
+		ErrorLine:   fg(t.Highlight.Error).Bold(true),
+		SuccessLine: fg(t.Highlight.Success),
+		Number:      fg(t.Highlight.Number),
+		Path:        fg(t.Highlight.Path).Underline(true),
+		URL:         fg(t.Highlight.URL).Underline(true),
+
+		SyntaxCommand:  fg(t.Command).Bold(true),
+		SyntaxKeyword:  fg(t.Title).Bold(true),
+		SyntaxString:   fg(t.Success),
+		SyntaxVariable: fg(t.Highlight.Number),
+		SyntaxOperator: fg(t.Accent).Bold(true),
+		SyntaxComment:  fg(t.Muted).Italic(true),
+		MatchBracket: fg(t.TableSelectedForeground).
+			Background(lipgloss.Color(t.TableSelectedBackground)),
+		Unmatched: fg(t.Error).Bold(true).Underline(true),
+		Cursor:    lipgloss.NewStyle().Reverse(true),
 	}
 }
 
-func initialModel() model {
-	s := spinner.New()
-	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-
-	p := progress.New(progress.WithScaledGradient("#FF7CCB", "#FDFF8C"))
-	p.Width = 40
+// syntaxStyle is the editor style for a shell token.
+func (s Styles) syntaxStyle(kind tokenKind) lipgloss.Style {
+	switch kind {
+	case tokCommand:
+		return s.SyntaxCommand
+	case tokKeyword:
+		return s.SyntaxKeyword
+	case tokString:
+		return s.SyntaxString
+	case tokVariable:
+		return s.SyntaxVariable
+	case tokOperator:
+		return s.SyntaxOperator
+	case tokComment:
+		return s.SyntaxComment
+	}
+	return s.OutputText
+}
 
-	ti := textinput.New()
-	ti.Placeholder = "Enter command or text..."
-	ti.CharLimit = 500
-	ti.Width = 50
-	ti.Focus()
+// tableStyles adapts the theme to the bubbles table component.
+func (s Styles) tableStyles() table.Styles {
+	tableStyles := table.DefaultStyles()
+	tableStyles.Header = tableStyles.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(s.TableBorder.GetForeground()).
+		BorderBottom(true).
+		Bold(false)
+	tableStyles.Selected = s.TableSelectedRow
+	return tableStyles
+}
 
-	styles := NewStyles()
+func newProgress(t Theme, width int) progress.Model {
+	p := progress.New(progress.WithScaledGradient(t.ProgressFrom, t.ProgressTo))
+	p.Width = width
+	return p
+}
 
-	// Create some example blocks
-	blocks := []Block{
+// exampleBlocks is the demo session shown when gbloxs starts without a
+// document.
+func exampleBlocks() []Block {
+	return []Block{
 		{
 			ID:        "1",
 			Title:     "Command Execution",
@@ -217,6 +412,77 @@ func initialModel() model {
 			Timestamp: time.Now(),
 		},
 	}
+}
+
+func initialModel() model {
+	return newModel(exampleBlocks())
+}
+
+// newModel sets up the UI around blocks.
+func newModel(blocks []Block) model {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+
+	ti := textinput.New()
+	ti.Placeholder = "Enter command or text..."
+	ti.CharLimit = 0
+	ti.Width = 50
+	ti.Focus()
+
+	// Problems with the user's config are reported in a block rather than
+	// refusing to start
+	var warnings []string
+	cfg, err := loadConfig()
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	keys := DefaultKeyMap()
+	warnings = append(warnings, keys.Apply(cfg.Keys)...)
+
+	themes, themeWarnings := loadThemes()
+	warnings = append(warnings, themeWarnings...)
+	theme, err := resolveTheme(themes, cfg.Theme)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	history, historyWarnings := loadHistory(cfg.History)
+	warnings = append(warnings, historyWarnings...)
+
+	workflows, workflowWarnings := loadWorkflows(cfg.Workflows)
+	warnings = append(warnings, workflowWarnings...)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	notifyAfter, err := cfg.Notify.threshold()
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	warnings = append(warnings, cfg.StatusBar.check()...)
+	warnings = append(warnings, cfg.Jobs.check()...)
+	alerts, alertWarnings := newAlerts(cfg.Alerts)
+	warnings = append(warnings, alertWarnings...)
+
+	styles := NewStyles(theme)
+	s.Style = styles.Spinner
+	p := newProgress(theme, 40)
+
+	if len(warnings) > 0 {
+		blocks = append(blocks, Block{
+			ID:        strconv.Itoa(highestBlockID(blocks) + 1),
+			Title:     "Configuration Problems",
+			Content:   strings.Join(warnings, "\n"),
+			Type:      BlockTypeError,
+			Expanded:  true,
+			Timestamp: time.Now(),
+			Error:     "Some settings in " + configPath() + " were ignored",
+			Metadata:  make(map[string]string),
+			Notice:    true,
+		})
+	}
 
 	// Initialize viewports for blocks that need scrolling
 	for i := range blocks {
@@ -251,17 +517,7 @@ func initialModel() model {
 		table.WithHeight(7),
 	)
 
-	tableStyles := table.DefaultStyles()
-	tableStyles.Header = tableStyles.Header.
-		BorderStyle(lipgloss.NormalBorder()).
-		BorderForeground(lipgloss.Color("240")).
-		BorderBottom(true).
-		Bold(false)
-	tableStyles.Selected = tableStyles.Selected.
-		Foreground(lipgloss.Color("229")).
-		Background(lipgloss.Color("57")).
-		Bold(false)
-	t.SetStyles(tableStyles)
+	t.SetStyles(styles.tableStyles())
 
 	return model{
 		blocks:      blocks,
@@ -269,20 +525,52 @@ func initialModel() model {
 		spinner:     s,
 		progress:    p,
 		textInput:   ti,
+		editor:      newEditor(),
 		showInput:   false,
 		inputMode:   false,
 		styles:      styles,
 		table:       t,
 		showTable:   false,
 		helpMode:    false,
+		split:       splitNone,
+		panes:       newPanes(),
+		focusedPane: 0,
+		keys:        keys,
+		theme:       theme,
+		themes:      themes,
+		history:     history,
+		search:      historySearch{input: newHistorySearchInput()},
+		palette:     palette{input: newPaletteInput()},
+		config:      cfg,
+		workflows:   workflows,
+		workflow:    workflowForm{input: newWorkflowInput()},
+		jobs:        make(map[string]*job),
+		streamed:    make(map[string]*strings.Builder),
+		jobDone:     make(chan jobDoneMsg),
+		notifyAfter: notifyAfter,
+		alerts:      alerts,
+		cwd:         cwd,
+		lastID:      highestBlockID(blocks),
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(
-		m.spinner.Tick,
-		animateProgress(m.blocks[2]),
-	)
+	cmds := []tea.Cmd{m.spinner.Tick}
+	// Runbooks and notebooks may have no progress block at all
+	for _, b := range m.blocks {
+		if b.Type == BlockTypeProgress && b.IsLoading {
+			cmds = append(cmds, animateProgress(b))
+		}
+	}
+	cmds = append(cmds, waitJob(m.jobDone))
+	if m.config.StatusBar.showsGit() {
+		cmds = append(cmds, readGit(m.cwd))
+	}
+	if m.startup != nil {
+		startup := *m.startup
+		cmds = append(cmds, func() tea.Msg { return startup })
+	}
+	return tea.Batch(cmds...)
 }
 
 type progressMsg struct {
@@ -313,125 +601,104 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			vp.Height = 15
 			m.blocks[i].Viewport = vp
 		}
+		if m.shell != nil {
+			m.shell.resize(msg.Width-8, msg.Height)
+		}
 
 	case tea.KeyMsg:
-		if m.inputMode {
-			switch msg.String() {
-			case "esc":
-				m.inputMode = false
-				m.showInput = false
-				m.textInput.Blur()
-			case "enter":
-				// Process input
-				input := m.textInput.Value()
-				if input != "" {
-					m.addBlockFromInput(input)
-					m.textInput.SetValue("")
-				}
-				m.inputMode = false
-				m.showInput = false
-				m.textInput.Blur()
-			default:
-				var cmd tea.Cmd
-				m.textInput, cmd = m.textInput.Update(msg)
-				cmds = append(cmds, cmd)
-			}
+		if m.inputMode && m.search.active {
+			cmds = append(cmds, m.updateHistorySearch(msg))
+			m.layoutPanes()
 			return m, tea.Batch(cmds...)
 		}
 
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
+		if m.workflow.active {
+			cmds = append(cmds, m.updateWorkflow(msg))
+			m.syncPanes()
+			return m, tea.Batch(cmds...)
+		}
 
-		case "i", "I":
-			// Toggle input mode
-			m.inputMode = !m.inputMode
-			m.showInput = !m.showInput
-			if m.inputMode {
-				m.textInput.Focus()
-			} else {
-				m.textInput.Blur()
-			}
+		if m.palette.active {
+			cmds = append(cmds, m.updatePalette(msg))
+			m.syncPanes()
+			return m, tea.Batch(cmds...)
+		}
 
-		case "j", "down":
-			if m.selectedIdx < len(m.blocks)-1 {
-				m.blocks[m.selectedIdx].Selected = false
-				m.selectedIdx++
-				m.blocks[m.selectedIdx].Selected = true
-			}
+		if m.jobsPanel.active {
+			cmds = append(cmds, m.updateJobsPanel(msg))
+			m.syncPanes()
+			return m, tea.Batch(cmds...)
+		}
 
-		case "k", "up":
-			if m.selectedIdx > 0 {
-				m.blocks[m.selectedIdx].Selected = false
-				m.selectedIdx--
-				m.blocks[m.selectedIdx].Selected = true
+		if m.shellInput() {
+			if key.Matches(msg, m.keys.LeaveShell) {
+				m.closeInput()
+			} else {
+				cmds = append(cmds, m.updateShell(msg))
 			}
+			// What the keys do shows in the shell's output
+			m.layoutPanes()
+			return m, tea.Batch(cmds...)
+		}
 
-		case "e", "E":
-			// Expand/collapse block
-			m.blocks[m.selectedIdx].Expanded = !m.blocks[m.selectedIdx].Expanded
-
-		case "c", "C":
-			// Copy block content to clipboard
-			if m.selectedIdx < len(m.blocks) {
-				block := m.blocks[m.selectedIdx]
-				contentToCopy := block.Output
-				if contentToCopy == "" {
-					contentToCopy = block.Content
-				}
-				if contentToCopy == "" && block.Command != "" {
-					contentToCopy = block.Command
-				}
-				if contentToCopy != "" {
-					clipboard.WriteAll(contentToCopy)
-					m.blocks[m.selectedIdx].Metadata["copied"] = "true"
-					// Show feedback message
-					m.addInfoBlock("Content copied to clipboard!")
-				}
-			}
+		if m.inputMode && m.multiline {
+			cmds = append(cmds, m.updateEditor(msg))
+			m.syncPanes()
+			return m, tea.Batch(cmds...)
+		}
 
-		case "r", "R":
-			// Refresh/reload block
-			if m.blocks[m.selectedIdx].Type == BlockTypeProgress {
-				m.blocks[m.selectedIdx].Progress = 0
-				m.blocks[m.selectedIdx].IsLoading = true
-				cmds = append(cmds, animateProgress(m.blocks[m.selectedIdx]))
-			}
+		if m.inputMode && m.completion.active && m.updateCompletion(msg) {
+			m.layoutPanes()
+			return m, nil
+		}
 
-		case "d", "D":
-			// Delete block
-			if len(m.blocks) > 1 {
-				m.blocks = append(m.blocks[:m.selectedIdx], m.blocks[m.selectedIdx+1:]...)
-				if m.selectedIdx >= len(m.blocks) {
-					m.selectedIdx = len(m.blocks) - 1
+		if m.inputMode {
+			// Only submitting input changes the blocks
+			submitted := key.Matches(msg, m.keys.Submit)
+			switch {
+			case key.Matches(msg, m.keys.Cancel):
+				m.closeInput()
+			case key.Matches(msg, m.keys.Submit) && m.expectFor != "":
+				m.submitExpectation(m.textInput.Value())
+			case key.Matches(msg, m.keys.Submit):
+				m.submitInput(m.textInput.Value())
+			case key.Matches(msg, m.keys.Multiline):
+				cmds = append(cmds, m.openEditor(scriptOf(m.textInput.Value())+"\n"))
+			case key.Matches(msg, m.keys.ExternalEditor):
+				cmds = append(cmds, m.openExternalEditor(scriptOf(m.textInput.Value())))
+			case key.Matches(msg, m.keys.HistoryPrev):
+				if input, ok := m.history.Prev(m.textInput.Value()); ok {
+					cmds = append(cmds, m.recallInput(input))
 				}
-				if len(m.blocks) > 0 {
-					m.blocks[m.selectedIdx].Selected = true
+			case key.Matches(msg, m.keys.HistoryNext):
+				if input, ok := m.history.Next(m.textInput.Value()); ok {
+					cmds = append(cmds, m.recallInput(input))
 				}
+			case key.Matches(msg, m.keys.HistorySearch):
+				cmds = append(cmds, m.openHistorySearch())
+			case key.Matches(msg, m.keys.Complete):
+				m.complete(1)
+			default:
+				var cmd tea.Cmd
+				m.textInput, cmd = m.textInput.Update(msg)
+				cmds = append(cmds, cmd)
 			}
+			if submitted {
+				m.syncPanes()
+			} else {
+				m.layoutPanes()
+			}
+			return m, tea.Batch(cmds...)
+		}
 
-		case " ", "enter":
-			// Toggle selection or execute action
-			m.blocks[m.selectedIdx].Expanded = !m.blocks[m.selectedIdx].Expanded
-
-		case "h", "H":
-			// Toggle help mode
-			m.helpMode = !m.helpMode
-
-		case "t", "T":
-			// Toggle table view
-			m.showTable = !m.showTable
-
-		case "ctrl+l":
-			// Clear all blocks
-			m.blocks = []Block{}
-			m.selectedIdx = 0
+		// Pane focus and scrolling take precedence while split
+		if m.split != splitNone && m.handlePaneKey(msg) {
+			m.syncPanes()
+			return m, nil
+		}
 
-		case "x", "X":
-			// Execute command in selected block
-			if m.blocks[m.selectedIdx].Command != "" {
-				m.executeCommand(m.blocks[m.selectedIdx].Command)
-			}
+		if cmd, ok := m.dispatchKey(msg); ok {
+			cmds = append(cmds, cmd)
 		}
 
 		// Handle table navigation when table is shown
@@ -441,10 +708,81 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 
+	case tea.MouseMsg:
+		cmds = append(cmds, m.handleMouse(msg))
+
+	case editorFinishedMsg:
+		m.finishExternalEditor(msg)
+
+	case startupMsg:
+		m.startup = nil
+		if msg.input != "" {
+			m.submitInput(msg.input)
+		}
+		if msg.runSteps {
+			m.runSteps(0)
+		}
+
+	case streamMsg:
+		m.appendStream(msg)
+		if !msg.done && msg.err == nil {
+			// The data shows on the next tick
+			m.layoutPanes()
+			return m, tea.Batch(cmds...)
+		}
+
+	case controlMsg:
+		msg.reply <- m.handleControl(msg.req)
+
+	case shellOutputMsg:
+		if m.shell != nil {
+			running, n := m.shell.blockID, len(m.blocks)
+			m.feedShell(msg)
+			if m.shell.blockID == running && len(m.blocks) == n {
+				// No command started or ended; its output shows on the
+				// next tick
+				m.layoutPanes()
+				return m, tea.Batch(cmds...)
+			}
+		}
+
+	case shellExitMsg:
+		if m.shell != nil {
+			m.shellExited(msg)
+		}
+
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
 		cmds = append(cmds, cmd)
+		// Running commands, streams and the hosted shell show their output
+		// as it arrives, once a tick however fast it comes
+		m.flushStreams()
+		m.flushShell()
+		m.pollJobs()
+		cmds = append(cmds, m.checkAlerts())
+		if !m.live() {
+			m.layoutPanes()
+			return m, tea.Batch(cmds...)
+		}
+
+	case jobDoneMsg:
+		cmds = append(cmds, m.finishJob(msg), waitJob(m.jobDone))
+
+	case gitInfoMsg, gitRefreshMsg:
+		cmds = append(cmds, m.updateGit(msg))
+
+	case notifyErrorMsg:
+		m.addInfoBlock("Notification command failed: " + msg.err.Error())
+
+	case notifyEscapeMsg:
+		// The renderer draws frames from a goroutine of its own, so these
+		// writes are not ordered with its frames and can interleave with
+		// them; tea.Printf would keep them apart, but prints nothing in the
+		// alt screen. The escapes draw nothing themselves; one that cuts
+		// into an escape of a frame can garble the lines that frame drew
+		// until they are drawn again, which is accepted as rare.
+		os.Stdout.WriteString(string(msg))
 
 	case progressMsg:
 		for i := range m.blocks {
@@ -463,21 +801,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
-	// Update viewports for scrolling
-	for i := range m.blocks {
-		if m.blocks[i].Expanded {
-			var cmd tea.Cmd
-			m.blocks[i].Viewport, cmd = m.blocks[i].Viewport.Update(msg)
-			cmds = append(cmds, cmd)
-		}
-	}
+	m.syncPanes()
 
 	return m, tea.Batch(cmds...)
 }
 
-func (m model) addBlockFromInput(input string) {
+func (m *model) addBlockFromInput(input string) {
 	newBlock := Block{
-		ID:        fmt.Sprintf("%d", len(m.blocks)+1),
+		ID:        m.newBlockID(),
 		Title:     "User Input",
 		Content:   input,
 		Command:   input,
@@ -491,7 +822,13 @@ func (m model) addBlockFromInput(input string) {
 	// Try to execute as command if it looks like one
 	if strings.HasPrefix(input, "/") || strings.HasPrefix(input, "!") {
 		cmdStr := strings.TrimPrefix(strings.TrimPrefix(input, "/"), "!")
-		m.executeCommandInBlock(cmdStr, &newBlock)
+		newBlock.Command = cmdStr
+		if dir, ok := cdTarget(cmdStr); ok {
+			// cd has to change the session, not a throwaway shell
+			m.changeDir(dir, &newBlock)
+		} else {
+			m.startCommand(cmdStr, &newBlock)
+		}
 	} else {
 		// Simulate command output
 		if strings.HasPrefix(input, "ls") {
@@ -499,6 +836,7 @@ func (m model) addBlockFromInput(input string) {
 			newBlock.Type = BlockTypeSuccess
 		} else if strings.HasPrefix(input, "error") {
 			newBlock.Error = "Error: Command failed"
+			newBlock.ExitCode = 1
 			newBlock.Type = BlockTypeError
 		} else {
 			newBlock.Output = fmt.Sprintf("Executed: %s\nStatus: OK", input)
@@ -519,29 +857,172 @@ func (m model) addBlockFromInput(input string) {
 	m.blocks[m.selectedIdx].Selected = true
 }
 
-func (m model) executeCommandInBlock(cmdStr string, block *Block) {
+// executeCommandInBlock runs cmdStr for block and waits for it to finish,
+// retrying it as its policy says. It reports whether gbloxs was
+// interrupted meanwhile; the command was then stopped too.
+func (m model) executeCommandInBlock(cmdStr string, block *Block) bool {
+	block.Attempts = nil
+	for attempt := 1; ; attempt++ {
+		cmd, in := m.prepareCommand(cmdStr, block)
+		if cmd == nil {
+			in.cleanup()
+			return false
+		}
+		started := time.Now()
+		output, timedOut, interrupted, err := runTimed(cmd, m.policyFor(*block).Timeout)
+		in.cleanup()
+		delay, retry := m.finishAttempt(block, output, err, started, attempt, timedOut, interrupted)
+		if !retry {
+			return interrupted
+		}
+		time.Sleep(delay)
+	}
+}
+
+// prepareCommand marks block as running cmdStr and returns the process to
+// run it in. It returns nil, with block showing the error, when the
+// command's block references cannot be resolved.
+func (m model) prepareCommand(cmdStr string, block *Block) (*exec.Cmd, blockInput) {
+	if block.Metadata == nil {
+		block.Metadata = make(map[string]string)
+	}
 	block.IsLoading = true
 	block.Metadata["executing"] = "true"
+	delete(block.Metadata, "status")
+	block.Error = ""
+	block.Checks = nil
+	block.Timestamp = time.Now()
+
+	in, err := m.resolveRefs(cmdStr)
+	if len(in.inputs) > 0 {
+		block.Metadata["inputs"] = "#" + strings.Join(in.inputs, ", #")
+	}
+	if err != nil {
+		block.IsLoading = false
+		delete(block.Metadata, "executing")
+		block.ExitCode = 1
+		block.Error = err.Error()
+		block.Type = BlockTypeError
+		block.Output = ""
+		block.Viewport = viewport.New(m.width-10, 10)
+		return nil, in
+	}
+	// What the last run printed would stand in for this run's output, and
+	// be scanned for alerts again
+	setOutput(block, "")
+
+	cmd := exec.Command("sh", "-c", in.command)
+	cmd.Dir = m.cwd
+	cmd.Env = append(os.Environ(), in.env...)
+	if in.stdin != nil {
+		cmd.Stdin = strings.NewReader(*in.stdin)
+	}
+	return cmd, in
+}
 
-	// Execute command
-	cmd := exec.Command("sh", "-c", cmdStr)
-	output, err := cmd.CombinedOutput()
-
+// finishCommand records how a command ended in its block.
+func (m model) finishCommand(block *Block, output string, err error) {
 	block.IsLoading = false
 	delete(block.Metadata, "executing")
 
+	block.ExitCode = exitCode(err)
 	if err != nil {
 		block.Error = err.Error()
 		block.Type = BlockTypeError
-		block.Output = string(output)
 	} else {
-		block.Output = string(output)
 		block.Type = BlockTypeSuccess
 	}
 
-	vp := viewport.New(m.width-10, 10)
-	vp.SetContent(block.Output)
-	block.Viewport = vp
+	if block.Viewport.Height == 0 {
+		block.Viewport = viewport.New(m.width-10, 10)
+	}
+	setOutput(block, output)
+}
+
+// cdTarget reports whether cmdStr is a plain cd and where it goes. The
+// argument has to be a single word; quotes and backslashes are undone the
+// way the shell would.
+func cdTarget(cmdStr string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(cmdStr), "cd")
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return "~", true
+	}
+	if strings.ContainsAny(rest, ";&|$`<>(){}*?[\n") {
+		// Leave anything more than a path to the shell
+		return "", false
+	}
+
+	var dir strings.Builder
+	var quote rune
+	escaped := false
+	for i, r := range rest {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == 0,
+			r == '\\' && quote == '"' && strings.ContainsAny(rest[i+1:min(i+2, len(rest))], `"\`):
+			escaped = true
+			continue
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			continue
+		case r == ' ' || r == '\t':
+			// More than one argument
+			return "", false
+		}
+		dir.WriteRune(r)
+	}
+	if quote != 0 || escaped || dir.Len() == 0 {
+		return "", false
+	}
+	return dir.String(), true
+}
+
+// changeDir moves the session's working directory, which every later
+// command runs in.
+func (m *model) changeDir(dir string, block *Block) {
+	dir = expandHome(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(m.cwd, dir)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		block.Type = BlockTypeError
+		block.ExitCode = 1
+		block.Error = "cd: no such directory: " + dir
+		return
+	}
+
+	m.cwd = dir
+	block.Type = BlockTypeSuccess
+	block.Output = dir
+}
+
+// exitCode maps the error from running a command to a shell exit status.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// Killed by a signal, reported the way shells do
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	default:
+		// The command could not be started at all
+		return 127
+	}
 }
 
 func (m *model) executeCommand(cmdStr string) {
@@ -550,12 +1031,12 @@ func (m *model) executeCommand(cmdStr string) {
 	}
 
 	block := &m.blocks[m.selectedIdx]
-	m.executeCommandInBlock(cmdStr, block)
+	m.startCommand(cmdStr, block)
 }
 
 func (m *model) addInfoBlock(message string) {
 	infoBlock := Block{
-		ID:        fmt.Sprintf("info-%d", time.Now().UnixNano()),
+		ID:        m.newBlockID(),
 		Title:     "Info",
 		Content:   message,
 		Type:      BlockTypeInfo,
@@ -563,6 +1044,7 @@ func (m *model) addInfoBlock(message string) {
 		Selected:  false,
 		Timestamp: time.Now(),
 		Metadata:  make(map[string]string),
+		Notice:    true,
 	}
 
 	vp := viewport.New(m.width-10, 5)
@@ -570,31 +1052,11 @@ func (m *model) addInfoBlock(message string) {
 	infoBlock.Viewport = vp
 
 	m.blocks = append(m.blocks, infoBlock)
-	m.selectedIdx = len(m.blocks) - 1
-	m.blocks[m.selectedIdx].Selected = true
+	m.selectBlock(len(m.blocks) - 1)
 }
 
 func (m model) addHelpBlock() {
-	helpContent := `Keyboard Shortcuts:
-  j / ↓     - Navigate down
-  k / ↑     - Navigate up
-  e         - Expand/collapse block
-  c         - Copy block content
-  r         - Refresh/reload block
-  d         - Delete block
-  i         - Toggle input mode
-  h         - Show this help
-  q / Ctrl+C - Quit
-  Space/Enter - Toggle block expansion
-
-Block Types:
-  • Command blocks (yellow) - Show command execution
-  • Output blocks (green) - Show command output
-  • Error blocks (red) - Show errors
-  • Success blocks (green) - Show success messages
-  • Info blocks (blue) - Show information
-  • Progress blocks - Show progress indicators
-  • Table blocks - Show tabular data`
+	helpContent := m.renderHelp()
 
 	helpBlock := Block{
 		ID:        "help",
@@ -605,6 +1067,7 @@ Block Types:
 		Selected:  false,
 		Timestamp: time.Now(),
 		Metadata:  make(map[string]string),
+		Notice:    true,
 	}
 
 	vp := viewport.New(m.width-10, 20)
@@ -623,140 +1086,168 @@ func (m model) View() string {
 
 	var b strings.Builder
 
+	top := m.renderTop()
+	bottom := m.renderBottom()
+
+	b.WriteString(top)
+
+	if m.split != splitNone {
+		// Panes fill whatever the header, overlays, input and footer leave
+		b.WriteString(m.renderPanes(m.paneRects(top, bottom)))
+		b.WriteString("\n")
+	} else {
+		// Render blocks
+		for i, block := range m.blocks {
+			b.WriteString(m.renderBlock(block, i == m.selectedIdx))
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString(bottom)
+
+	return b.String()
+}
+
+// renderTop renders the header and any overlays shown above the blocks.
+func (m model) renderTop() string {
+	var b strings.Builder
+
 	// Header
-	headerStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("205")).
-		Bold(true).
-		Align(lipgloss.Center).
-		Width(m.width).
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
-		Padding(0, 1)
+	headerStyle := m.styles.Header.Copy().Width(m.width)
 
 	header := headerStyle.Render("╔═══ Gbloxs - Interactive Terminal Blocks ═══╗")
 	b.WriteString(header + "\n\n")
 
+	if m.palette.active {
+		b.WriteString(m.renderPalette() + "\n\n")
+	}
+	if m.workflow.active {
+		b.WriteString(m.renderWorkflow() + "\n\n")
+	}
+	if m.jobsPanel.active {
+		b.WriteString(m.renderJobsPanel() + "\n\n")
+	}
+
 	// Show help overlay if help mode is on
 	if m.helpMode {
 		helpContent := m.renderHelp()
-		helpBox := lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("39")).
-			Padding(1, 2).
+		helpBox := m.styles.HelpOverlay.Copy().
 			Width(m.width - 4).
-			Background(lipgloss.Color("235")).
 			Render(helpContent)
 		b.WriteString(helpBox + "\n\n")
 	}
 
 	// Show table if table mode is on
 	if m.showTable {
-		tableBox := lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("34")).
-			Padding(1, 2).
-			Render(m.table.View())
+		tableBox := m.styles.TableBox.Render(m.table.View())
 		b.WriteString(tableBox + "\n\n")
 	}
 
-	// Render blocks
-	for i, block := range m.blocks {
-		b.WriteString(m.renderBlock(block, i == m.selectedIdx))
-		b.WriteString("\n")
-	}
+	return b.String()
+}
+
+// renderBottom renders the input area and the footer shown below the blocks.
+func (m model) renderBottom() string {
+	var b strings.Builder
 
 	// Input area
 	if m.showInput {
 		b.WriteString("\n")
-		inputBox := lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("220")).
-			Padding(1, 2).
-			Render(
-				m.styles.BlockTitle.Render("Input Mode (ESC to cancel, Enter to submit, /cmd or !cmd to execute):") + "\n" +
+		if m.search.active {
+			b.WriteString(m.renderHistorySearch())
+			b.WriteString("\n")
+		}
+		if m.completion.active {
+			b.WriteString(m.renderCompletion())
+			b.WriteString("\n")
+		}
+		var inputBox string
+		if m.shellInput() {
+			inputBox = m.styles.InputBox.Render(
+				m.styles.BlockTitle.Render(m.shellTitle()) + "\n" + m.renderShell(),
+			)
+		} else if m.multiline {
+			title := fmt.Sprintf("Script Editor (%s to run, %s to edit in $EDITOR, ESC to cancel):",
+				m.keys.EditorSubmit.Help().Key, m.keys.ExternalEditor.Help().Key)
+			inputBox = m.styles.InputBox.Render(
+				m.styles.BlockTitle.Render(title) + "\n" + m.renderEditor(),
+			)
+		} else {
+			title := "Input Mode (ESC to cancel, Enter to submit, /cmd or !cmd to execute):"
+			if m.pipeFrom != "" {
+				title = fmt.Sprintf("Pipe output of #%s into (ESC to cancel, Enter to run):", m.pipeFrom)
+			}
+			if m.expectFor != "" {
+				title = fmt.Sprintf("Expect of #%s: exit N, contains TEXT, matches REGEX or json PATH = VALUE (ESC to cancel):", m.expectFor)
+			}
+			inputBox = m.styles.InputBox.Render(
+				m.styles.BlockTitle.Render(title) + "\n" +
 					m.textInput.View(),
 			)
+		}
 		b.WriteString(inputBox)
 		b.WriteString("\n")
 	}
 
 	// Footer with instructions
-	footerStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("240")).
-		Italic(true).
-		Align(lipgloss.Center).
-		Width(m.width)
-
-	shortcuts := "i: input | h: help | j/k: navigate | e: expand | c: copy | r: refresh | d: delete | x: execute | t: table | q: quit"
-	footer := footerStyle.Render(shortcuts)
+	footerStyle := m.styles.Footer.Copy().Width(m.width)
+
+	if status := m.renderStatusBar(); status != "" {
+		b.WriteString("\n" + status)
+	}
+	footer := footerStyle.Render(m.keys.footer())
 	b.WriteString("\n" + footer)
 
 	return b.String()
 }
 
 func (m model) renderHelp() string {
-	helpText := `╔═══════════════════════════════════════════════════════════════╗
-║                    KEYBOARD SHORTCUTS                        ║
-╠═══════════════════════════════════════════════════════════════╣
-║  Navigation:                                                  ║
-║    j / ↓     Navigate down to next block                      ║
-║    k / ↑     Navigate up to previous block                    ║
-║                                                               ║
-║  Block Actions:                                               ║
-║    e         Expand/collapse selected block                    ║
-║    c         Copy block content to clipboard                   ║
-║    r         Refresh/reload block content                      ║
-║    d         Delete selected block                             ║
-║    x         Execute command in selected block                  ║
-║    Space     Toggle block expansion                            ║
-║    Enter     Toggle block expansion                            ║
-║                                                               ║
-║  Modes:                                                       ║
-║    i         Toggle input mode                                 ║
-║    h         Toggle help (this screen)                         ║
-║    t         Toggle table view                                 ║
-║                                                               ║
-║  Input Mode:                                                  ║
-║    /cmd      Execute shell command (e.g., /ls -la)            ║
-║    !cmd      Execute shell command (alternative)               ║
-║    ESC       Cancel input                                      ║
-║    Enter     Submit input                                     ║
-║                                                               ║
-║  General:                                                     ║
-║    q         Quit application                                  ║
-║    Ctrl+C    Quit application                                  ║
-║    Ctrl+L    Clear all blocks                                 ║
-╠═══════════════════════════════════════════════════════════════╣
-║  BLOCK TYPES:                                                 ║
-║    🟡 Command  - Yellow border, shows command execution        ║
-║    🟢 Output   - Green border, shows command output            ║
-║    🔴 Error    - Red border, shows error messages             ║
-║    🔵 Info     - Blue border, shows information                ║
-║    📊 Table    - Shows tabular data                            ║
-║    ⏳ Progress - Shows progress indicators                     ║
-╚═══════════════════════════════════════════════════════════════╝`
-
-	return helpText
+	var b strings.Builder
+
+	b.WriteString(m.styles.BlockTitle.Render("KEYBOARD SHORTCUTS"))
+	b.WriteString("\n")
+	b.WriteString(m.keys.helpSections())
+
+	b.WriteString(`
+Input Commands:
+  /cmd           Execute shell command (e.g., /ls -la)
+  !cmd           Execute shell command (alternative)
+
+Mouse:
+  Click          Select block, click title to expand/collapse
+  Wheel          Scroll long output inside a block
+  Click link     Open URL or copy path
+
+BLOCK TYPES:
+  🟡 Command  - Yellow border, shows command execution
+  🟢 Output   - Green border, shows command output
+  🔴 Error    - Red border, shows error messages
+  🔵 Info     - Blue border, shows information
+  📊 Table    - Shows tabular data
+  ⏳ Progress - Shows progress indicators
+
+Keys can be changed in the keys section of ` + configPath())
+	b.WriteString("\nTheme: " + m.theme.Name)
+
+	return b.String()
 }
 
 func (m model) renderBlock(block Block, selected bool) string {
-	var style lipgloss.Style
+	return m.renderBlockWidth(block, selected, 0)
+}
 
-	// Choose style based on block type and selection
-	if selected {
-		style = m.styles.SelectedBlock
-	} else {
-		switch block.Type {
-		case BlockTypeCommand:
-			style = m.styles.CommandBlock
-		case BlockTypeOutput, BlockTypeSuccess:
-			style = m.styles.OutputBlock
-		case BlockTypeError:
-			style = m.styles.ErrorBlock
-		case BlockTypeInfo:
-			style = m.styles.InfoBlock
-		default:
-			style = m.styles.BlockBorder
+// renderBlockWidth renders a block wrapped to the given outer width. A width
+// of zero lets the block size itself to its content.
+func (m model) renderBlockWidth(block Block, selected bool, width int) string {
+	style := m.blockStyle(block, selected)
+	if color, ok := m.alertBorder(block); ok {
+		style = style.Copy().BorderForeground(color)
+	}
+
+	if width > 0 {
+		style = style.Width(width - style.GetHorizontalBorderSize())
+		if limit := width - style.GetHorizontalFrameSize() - 4; m.progress.Width > limit {
+			m.progress.Width = limit
 		}
 	}
 
@@ -772,28 +1263,48 @@ func (m model) renderBlock(block Block, selected bool) string {
 	if block.Selected {
 		title = fmt.Sprintf("● %s", title)
 	}
-	content.WriteString(m.styles.BlockTitle.Render(title))
+	renderedTitle := m.styles.BlockTitle.Render(title)
+	if _, err := strconv.Atoi(block.ID); err == nil {
+		// The number used to reference the block's output
+		renderedTitle = lipgloss.JoinHorizontal(lipgloss.Top, renderedTitle, m.styles.Muted.Render(" #"+block.ID))
+	}
+	if block.Unseen {
+		badge := m.styles.SuccessText
+		if block.Type == BlockTypeError {
+			badge = m.styles.ErrorText
+		}
+		renderedTitle = lipgloss.JoinHorizontal(lipgloss.Top, renderedTitle, badge.Render(" ● new"))
+	}
+	if badge := m.alertBadge(block); badge != "" {
+		renderedTitle = lipgloss.JoinHorizontal(lipgloss.Top, renderedTitle, badge)
+	}
+	if block.Metadata["status"] == statusQueued {
+		renderedTitle = lipgloss.JoinHorizontal(lipgloss.Top, renderedTitle, m.styles.Muted.Render(" "+m.queuedBadge(block)))
+	}
+	content.WriteString(renderedTitle)
 	content.WriteString("\n")
 
 	if block.Expanded {
 		// Timestamp
 		timeStr := block.Timestamp.Format("15:04:05")
-		content.WriteString(lipgloss.NewStyle().
-			Foreground(lipgloss.Color("240")).
-			Render(fmt.Sprintf("  %s", timeStr)))
+		content.WriteString(m.styles.Muted.Render(fmt.Sprintf("  %s", timeStr)))
 		content.WriteString("\n\n")
 
+		// Output switched to table view renders like a table block
+		if block.Metadata["view"] == "table" {
+			block.Type = BlockTypeTable
+			block.TableData = parseTable(block.Output)
+		}
+
 		// Render based on block type
 		switch block.Type {
 		case BlockTypeCommand:
 			if block.Command != "" {
-				content.WriteString(lipgloss.NewStyle().
-					Foreground(lipgloss.Color("220")).
-					Render(fmt.Sprintf("  $ %s", block.Command)))
+				content.WriteString(m.styles.CommandLine.Render(fmt.Sprintf("  $ %s", block.Command)))
 				content.WriteString("\n\n")
 			}
 			if block.Output != "" {
-				content.WriteString(m.renderOutput(block.Output))
+				content.WriteString(m.renderScrollable(block, block.Output))
 			}
 
 		case BlockTypeProgress:
@@ -812,33 +1323,40 @@ func (m model) renderBlock(block Block, selected bool) string {
 			}
 
 		case BlockTypeError:
-			content.WriteString(lipgloss.NewStyle().
-				Foreground(lipgloss.Color("196")).
-				Render("  ✗ " + block.Error))
-			if block.Content != "" {
-				content.WriteString("\n" + m.renderOutput(block.Content))
+			content.WriteString(m.styles.ErrorText.Render("  ✗ " + block.Error))
+			if text := scrollText(block); text != "" {
+				content.WriteString("\n" + m.renderScrollable(block, text))
 			}
 
 		case BlockTypeSuccess:
-			content.WriteString(lipgloss.NewStyle().
-				Foreground(lipgloss.Color("46")).
-				Render("  ✓ " + block.Content))
+			content.WriteString(m.styles.SuccessText.Render("  ✓ " + block.Content))
+			if block.Output != "" {
+				content.WriteString("\n\n" + m.renderScrollable(block, block.Output))
+			}
 
 		default:
 			if block.Content != "" {
-				content.WriteString(m.renderOutput(block.Content))
+				content.WriteString(m.renderScrollable(block, block.Content))
 			} else if block.Output != "" {
-				content.WriteString(m.renderOutput(block.Output))
+				content.WriteString(m.renderScrollable(block, block.Output))
 			}
 		}
 
+		if expectation := m.expectationView(block); expectation != "" {
+			content.WriteString("\n" + expectation)
+		}
+		if checks := m.checksView(block); checks != "" {
+			content.WriteString("\n" + checks)
+		}
+		if attempts := m.attemptsView(block); attempts != "" {
+			content.WriteString("\n" + attempts)
+		}
+
 		// Metadata
 		if len(block.Metadata) > 0 {
 			content.WriteString("\n")
 			for k, v := range block.Metadata {
-				content.WriteString(lipgloss.NewStyle().
-					Foreground(lipgloss.Color("240")).
-					Render(fmt.Sprintf("  [%s: %s]", k, v)))
+				content.WriteString(m.styles.Muted.Render(fmt.Sprintf("  [%s: %s]", k, v)))
 			}
 		}
 	}
@@ -846,6 +1364,32 @@ func (m model) renderBlock(block Block, selected bool) string {
 	return style.Render(content.String())
 }
 
+// blockStyle chooses the frame style based on block type and selection.
+func (m model) blockStyle(block Block, selected bool) lipgloss.Style {
+	if selected {
+		return m.styles.SelectedBlock
+	}
+
+	switch block.Type {
+	case BlockTypeCommand:
+		return m.styles.CommandBlock
+	case BlockTypeOutput:
+		return m.styles.OutputBlock
+	case BlockTypeSuccess:
+		return m.styles.SuccessBlock
+	case BlockTypeError:
+		return m.styles.ErrorBlock
+	case BlockTypeInfo:
+		return m.styles.InfoBlock
+	case BlockTypeProgress:
+		return m.styles.ProgressBlock
+	case BlockTypeTable:
+		return m.styles.TableBlock
+	default:
+		return m.styles.BlockBorder
+	}
+}
+
 func (m model) renderOutput(output string) string {
 	// Enhanced syntax highlighting
 	lines := strings.Split(output, "\n")
@@ -858,7 +1402,6 @@ func (m model) renderOutput(output string) string {
 	errorPattern := regexp.MustCompile(`(?i)(error|failed|fatal|exception)`)
 	successPattern := regexp.MustCompile(`(?i)(success|ok|done|complete)`)
 	numberPattern := regexp.MustCompile(`\d+`)
-	pathPattern := regexp.MustCompile(`(/[^\s]+|\./[^\s]+|~\w+)`)
 
 	for _, line := range lines {
 		if line == "" {
@@ -866,40 +1409,38 @@ func (m model) renderOutput(output string) string {
 			continue
 		}
 
-		style := lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
+		style := m.styles.OutputText.Copy()
 
 		// Directory detection
 		if dirPattern.MatchString(line) {
-			style = style.Foreground(lipgloss.Color("39")) // Blue for directories
+			style = style.Foreground(m.styles.Directory.GetForeground())
 		} else if execPattern.MatchString(line) {
-			style = style.Foreground(lipgloss.Color("46")) // Green for executables
+			style = style.Foreground(m.styles.Executable.GetForeground())
 		} else if filePattern.MatchString(line) {
-			style = style.Foreground(lipgloss.Color("252")) // White for files
+			style = style.Foreground(m.styles.File.GetForeground())
 		}
 
 		// Error highlighting
 		if errorPattern.MatchString(line) {
-			style = style.Foreground(lipgloss.Color("196")).Bold(true)
+			style = style.Foreground(m.styles.ErrorLine.GetForeground()).Bold(true)
 		}
 
 		// Success highlighting
 		if successPattern.MatchString(line) {
-			style = style.Foreground(lipgloss.Color("46"))
+			style = style.Foreground(m.styles.SuccessLine.GetForeground())
 		}
 
-		// Highlight paths
-		line = pathPattern.ReplaceAllStringFunc(line, func(match string) string {
-			return lipgloss.NewStyle().
-				Foreground(lipgloss.Color("220")).
-				Underline(true).
-				Render(match)
+		// Highlight URLs and paths
+		line = linkPattern.ReplaceAllStringFunc(line, func(match string) string {
+			if urlPattern.MatchString(match) {
+				return m.styles.URL.Render(match)
+			}
+			return m.styles.Path.Render(match)
 		})
 
 		// Highlight numbers
 		line = numberPattern.ReplaceAllStringFunc(line, func(match string) string {
-			return lipgloss.NewStyle().
-				Foreground(lipgloss.Color("205")).
-				Render(match)
+			return m.styles.Number.Render(match)
 		})
 
 		highlighted.WriteString(style.Render("  " + line))
@@ -909,6 +1450,60 @@ func (m model) renderOutput(output string) string {
 	return highlighted.String()
 }
 
+// renderScrollable renders text through the block's viewport once it is
+// taller than the viewport, so long output scrolls inside the block instead
+// of stretching it.
+func (m model) renderScrollable(block Block, text string) string {
+	rendered := strings.TrimSuffix(m.renderOutput(text), "\n")
+	vp := block.Viewport
+	total := lipgloss.Height(rendered)
+	if vp.Height <= 0 || total <= vp.Height {
+		return rendered + "\n"
+	}
+
+	// Let the block frame decide the width; only clip the height
+	vp.Width = 0
+	vp.SetContent(rendered)
+
+	last := vp.YOffset + vp.Height
+	if last > total {
+		last = total
+	}
+	indicator := m.styles.Muted.Render(fmt.Sprintf("  ↕ lines %d-%d of %d", vp.YOffset+1, last, total))
+
+	return vp.View() + "\n" + indicator + "\n"
+}
+
+// scrollText returns the text renderBlock shows for a block, which is what
+// its viewport scrolls over.
+func scrollText(block Block) string {
+	switch {
+	case block.Type == BlockTypeCommand:
+		return block.Output
+	case block.Type == BlockTypeError || block.Type == BlockTypeSuccess:
+		// Command output when there is any, otherwise the message
+		if block.Output != "" || block.Type == BlockTypeSuccess {
+			return block.Output
+		}
+		return block.Content
+	case block.Content != "":
+		return block.Content
+	default:
+		return block.Output
+	}
+}
+
+// scrollBlock scrolls the viewport of the block at index i by delta lines.
+func (m *model) scrollBlock(i, delta int) {
+	vp := &m.blocks[i].Viewport
+	vp.SetContent(strings.TrimSuffix(m.renderOutput(scrollText(m.blocks[i])), "\n"))
+	if delta < 0 {
+		vp.LineUp(-delta)
+	} else {
+		vp.LineDown(delta)
+	}
+}
+
 func (m model) renderTable(data [][]string) string {
 	if len(data) == 0 {
 		return ""
@@ -944,9 +1539,5 @@ func (m model) renderTable(data [][]string) string {
 }
 
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
-	}
+	os.Exit(runCLI(os.Args[1:]))
 }
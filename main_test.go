@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestCdTarget(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		dir  string
+		isCd bool
+	}{
+		{cmd: "cd", dir: "~", isCd: true},
+		{cmd: "  cd  ", dir: "~", isCd: true},
+		{cmd: "cd /tmp", dir: "/tmp", isCd: true},
+		{cmd: "cd ../src", dir: "../src", isCd: true},
+		{cmd: "cd ~/work", dir: "~/work", isCd: true},
+		{cmd: `cd "a b"`, dir: "a b", isCd: true},
+		{cmd: `cd 'a b'`, dir: "a b", isCd: true},
+		{cmd: `cd a\ b`, dir: "a b", isCd: true},
+		{cmd: `cd "a"b'c d'`, dir: "abc d", isCd: true},
+		{cmd: `cd 'a\b'`, dir: `a\b`, isCd: true},
+		{cmd: `cd "a\b"`, dir: `a\b`, isCd: true},
+		{cmd: `cd "a\"b"`, dir: `a"b`, isCd: true},
+
+		{cmd: "cdx", isCd: false},
+		{cmd: "echo cd /tmp", isCd: false},
+		{cmd: `cd "a b" c`, isCd: false},
+		{cmd: "cd a b", isCd: false},
+		{cmd: `cd "a b`, isCd: false},
+		{cmd: `cd a\`, isCd: false},
+		{cmd: `cd ''`, isCd: false},
+		{cmd: "cd /tmp && ls", isCd: false},
+		{cmd: "cd $HOME", isCd: false},
+		{cmd: "cd `pwd`", isCd: false},
+		{cmd: "cd src*", isCd: false},
+	}
+
+	for _, tt := range tests {
+		dir, ok := cdTarget(tt.cmd)
+		if ok != tt.isCd || dir != tt.dir {
+			t.Errorf("cdTarget(%q) = %q, %v, want %q, %v", tt.cmd, dir, ok, tt.dir, tt.isCd)
+		}
+	}
+}
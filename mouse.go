@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// wheelLines is how far one mouse wheel notch scrolls.
+const wheelLines = 3
+
+var (
+	// urlPattern and linkPattern match what renderOutput underlines;
+	// clicking an underlined URL opens it, clicking a path copies it.
+	urlPattern  = regexp.MustCompile(`^https?://`)
+	linkPattern = regexp.MustCompile(`(https?://[^\s]+|/[^\s]+|\./[^\s]+|~\w+)`)
+
+	// ansiPattern matches the escape sequences lipgloss emits.
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+)
+
+// frameRunes are drawn by block and pane borders and never part of a link.
+const frameRunes = "│║╭╮╰╯╔╗╚╝─═"
+
+// handleMouse selects, expands and scrolls blocks, and follows links, based
+// on where in the rendered layout the event landed.
+func (m *model) handleMouse(msg tea.MouseMsg) tea.Cmd {
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp || msg.Button == tea.MouseButtonWheelDown:
+		delta := wheelLines
+		if msg.Button == tea.MouseButtonWheelUp {
+			delta = -delta
+		}
+
+		if i, _, ok := m.blockAt(msg.X, msg.Y); ok && m.blockScrollable(i) {
+			m.scrollBlock(i, delta)
+			return nil
+		}
+		if p, ok := m.paneAt(msg.X, msg.Y); ok {
+			vp := &m.panes[p].viewport
+			if delta < 0 {
+				vp.LineUp(-delta)
+			} else {
+				vp.LineDown(delta)
+			}
+		}
+
+	case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+		if p, ok := m.paneAt(msg.X, msg.Y); ok {
+			m.focusedPane = p
+			if m.panes[p].kind == paneOutput {
+				// Nothing to select there, only links to follow
+				if link := m.paneLinkAt(p, msg.X, msg.Y); link != "" {
+					m.followLink(link)
+				}
+				return nil
+			}
+		}
+
+		i, row, ok := m.blockAt(msg.X, msg.Y)
+		if !ok {
+			return nil
+		}
+
+		// Look the link up before selection restyles the block
+		link := ""
+		if row != m.titleRow(i) {
+			link = linkAt(m.screenLine(msg.Y), msg.X)
+		}
+
+		m.selectBlock(i)
+
+		switch {
+		case link != "":
+			m.followLink(link)
+		case row == m.titleRow(i):
+			m.blocks[i].Expanded = !m.blocks[i].Expanded
+		}
+	}
+
+	return nil
+}
+
+// selectBlock moves the selection to the block at index i.
+func (m *model) selectBlock(i int) {
+	if m.selectedIdx < len(m.blocks) {
+		m.blocks[m.selectedIdx].Selected = false
+	}
+	m.selectedIdx = i
+	m.blocks[i].Selected = true
+	m.blocks[i].Unseen = false
+	m.blocks[i].Alerts = 0
+}
+
+// titleRow is the line within a rendered block that holds its title.
+func (m model) titleRow(i int) int {
+	style := m.blockStyle(m.blocks[i], i == m.selectedIdx)
+	return style.GetBorderTopSize() + style.GetPaddingTop()
+}
+
+// blockScrollable reports whether the block at index i currently shows its
+// output through its viewport.
+func (m model) blockScrollable(i int) bool {
+	block := m.blocks[i]
+	if !block.Expanded || block.Viewport.Height <= 0 {
+		return false
+	}
+	return strings.Count(m.renderOutput(scrollText(block)), "\n") > block.Viewport.Height
+}
+
+// paneAt returns the pane under the given screen cell while split.
+func (m model) paneAt(x, y int) (int, bool) {
+	if m.split == splitNone {
+		return 0, false
+	}
+
+	rects := m.paneRects(m.renderTop(), m.renderBottom())
+	for i, r := range rects {
+		if x >= r.x && x < r.x+r.width && y >= r.y && y < r.y+r.height {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// blockAt returns the index of the block under the given screen cell and
+// the line within that block.
+func (m model) blockAt(x, y int) (int, int, bool) {
+	if m.split != splitNone {
+		p, ok := m.paneAt(x, y)
+		if !ok || m.panes[p].kind != paneBlocks {
+			return 0, 0, false
+		}
+
+		// Skip the pane border, then account for the pane's scroll
+		rect := m.paneRects(m.renderTop(), m.renderBottom())[p]
+		vp := m.panes[p].viewport
+		_, spans := m.renderBlockList(vp.Width)
+		return spanAt(spans, y-rect.y-1+vp.YOffset)
+	}
+
+	// The renderer keeps the bottom of a view that is taller than the
+	// terminal, so screen row 0 may be several lines into the view
+	line := y + m.hiddenLines() - strings.Count(m.renderTop(), "\n")
+
+	spans := make([]lineSpan, len(m.blocks))
+	start := 0
+	for i, block := range m.blocks {
+		end := start + strings.Count(m.renderBlock(block, i == m.selectedIdx), "\n") + 1
+		spans[i] = lineSpan{start: start, end: end}
+		start = end
+	}
+	return spanAt(spans, line)
+}
+
+func spanAt(spans []lineSpan, line int) (int, int, bool) {
+	for i, s := range spans {
+		if line >= s.start && line < s.end {
+			return i, line - s.start, true
+		}
+	}
+	return 0, 0, false
+}
+
+// paneLinkAt returns the URL or path under the given screen cell of pane
+// p, looking at the lines its viewport shows.
+func (m model) paneLinkAt(p, x, y int) string {
+	rect := m.paneRects(m.renderTop(), m.renderBottom())[p]
+	lines := strings.Split(m.panes[p].viewport.View(), "\n")
+	// Inside the pane border
+	row := y - rect.y - 1
+	if row < 0 || row >= len(lines) {
+		return ""
+	}
+	return linkAt(ansiPattern.ReplaceAllString(lines[row], ""), x-rect.x-1)
+}
+
+// hiddenLines is how many lines at the top of the view do not fit on screen.
+func (m model) hiddenLines() int {
+	if hidden := strings.Count(m.View(), "\n") + 1 - m.height; hidden > 0 {
+		return hidden
+	}
+	return 0
+}
+
+// screenLine returns the plain text drawn on screen row y.
+func (m model) screenLine(y int) string {
+	lines := strings.Split(m.View(), "\n")
+	y += m.hiddenLines()
+	if y < 0 || y >= len(lines) {
+		return ""
+	}
+	return ansiPattern.ReplaceAllString(lines[y], "")
+}
+
+// linkAt returns the URL or path under column x of a plain text line.
+func linkAt(line string, x int) string {
+	runes := []rune(line)
+
+	// Find the rune drawn at column x
+	col, idx := 0, -1
+	for i, r := range runes {
+		w := runewidth.RuneWidth(r)
+		if x >= col && x < col+w {
+			idx = i
+			break
+		}
+		col += w
+	}
+	if idx < 0 || isLinkBoundary(runes[idx]) {
+		return ""
+	}
+
+	start, end := idx, idx+1
+	for start > 0 && !isLinkBoundary(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && !isLinkBoundary(runes[end]) {
+		end++
+	}
+
+	// Punctuation around a link is not part of it, but ./ starts a path
+	word := strings.TrimLeft(string(runes[start:end]), `,;:!?()[]{}<>'"`)
+	word = strings.TrimRight(word, `.,;:!?()[]{}<>'"`)
+	if loc := linkPattern.FindStringIndex(word); loc == nil || loc[0] != 0 || loc[1] != len(word) {
+		return ""
+	}
+	return word
+}
+
+func isLinkBoundary(r rune) bool {
+	return r == ' ' || r == '\t' || strings.ContainsRune(frameRunes, r)
+}
+
+// followLink opens URLs in the system browser and copies paths to the
+// clipboard.
+func (m *model) followLink(link string) {
+	if urlPattern.MatchString(link) {
+		if err := openURL(link); err != nil {
+			m.addInfoBlock("Could not open " + link + ": " + err.Error())
+		}
+		return
+	}
+
+	if err := clipboard.WriteAll(link); err != nil {
+		m.addInfoBlock("Could not copy path: " + err.Error())
+		return
+	}
+	m.addInfoBlock("Path copied to clipboard: " + link)
+}
+
+func openURL(url string) error {
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	cmd := exec.Command(opener, url)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reaped once the opener exits, so it does not linger as a zombie
+	go cmd.Wait()
+	return nil
+}
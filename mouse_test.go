@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+)
+
+func TestLinkAt(t *testing.T) {
+	tests := []struct {
+		line string
+		x    int
+		want string
+	}{
+		{line: "see https://example.com/docs for more", x: 4, want: "https://example.com/docs"},
+		{line: "see https://example.com/docs for more", x: 27, want: "https://example.com/docs"},
+		{line: "see https://example.com/docs for more", x: 28, want: ""},
+		{line: "see https://example.com/docs for more", x: 1, want: ""},
+		{line: "(https://example.com).", x: 5, want: "https://example.com"},
+		{line: "│ /var/log/app.log │", x: 4, want: "/var/log/app.log"},
+		{line: "│ /var/log/app.log │", x: 0, want: ""},
+		{line: "wrote ./out/report.txt", x: 10, want: "./out/report.txt"},
+		{line: "cd ~stefan", x: 5, want: "~stefan"},
+		// Wide runes take two columns
+		{line: "日本 https://example.jp", x: 5, want: "https://example.jp"},
+		{line: "日本 https://example.jp", x: 3, want: ""},
+		{line: "not/a/link here", x: 2, want: ""},
+		{line: "short", x: 40, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := linkAt(tt.line, tt.x); got != tt.want {
+			t.Errorf("linkAt(%q, %d) = %q, want %q", tt.line, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestPaneLinkAt(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	output := strings.Repeat("line\n", 30) + "docs at https://example.com/guide\n"
+	m := newModel([]Block{{ID: "1", Title: "build", Command: "make", Output: output, Type: BlockTypeSuccess, Timestamp: time.Now()}})
+	m.width, m.height = 100, 30
+
+	for _, split := range []splitMode{splitVertical, splitHorizontal} {
+		m.split = split
+		m.syncPanes()
+		// Scrolled, so the link is not on the line it has in the output
+		m.panes[1].viewport.GotoBottom()
+
+		// Find the link on screen, in the output pane
+		rect := m.paneRects(m.renderTop(), m.renderBottom())[1]
+		x, y := -1, -1
+		for row, line := range strings.Split(m.View(), "\n") {
+			line = ansiPattern.ReplaceAllString(line, "")
+			if i := strings.Index(line, "https://"); i >= 0 && row >= rect.y {
+				x, y = runewidth.StringWidth(line[:i])+3, row-m.hiddenLines()
+			}
+		}
+		if x < 0 {
+			t.Fatalf("split %d: link not on screen:\n%s", split, m.View())
+		}
+
+		if got := m.paneLinkAt(1, x, y); got != "https://example.com/guide" {
+			t.Errorf("split %d: paneLinkAt(%d, %d) = %q", split, x, y, got)
+		}
+		if got := m.paneLinkAt(1, x, y-1); got != "" {
+			t.Errorf("split %d: line above the link gave %q", split, got)
+		}
+		if p, ok := m.paneAt(x, y); !ok || p != 1 {
+			t.Errorf("split %d: the link is in pane %d, %v", split, p, ok)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A .gbx notebook is plain text so that it diffs cleanly. Every line that
+// starts with "%%" is a header; the lines up to the next header are its
+// body. Body lines that themselves start with "%%" or "\" are written with
+// an extra leading "\".
+//
+//	%% gbloxs notebook 1
+//	%% note "Introduction" id=1
+//	Free text.
+//
+//	%% command "Build" id=2
+//	make build
+//	%% expect
+//	ok
+//	%% assert
+//	exit 0
+//	contains ok
+//	%% output exit=0 time=2026-01-02T15:04:05Z
+//	ok
+//
+// The id of a cell is the ID of its block, which {{block:N}} references
+// use. Consecutive commands with the same group, such as group=build, run
+// at the same time when the notebook is run; timeout=30s, retries=3 and
+// backoff=2s override the jobs settings for one command. A command is
+// followed by an optional expect section, the output it should produce,
+// an optional assert section, the expectations its result is checked
+// against one per line, and an optional output section, its last result.
+// A command that was retried has an attempt section for each earlier run
+// before its output. "Clear outputs" drops the output sections, leaving
+// only what was written by hand.
+const notebookHeader = "%% gbloxs notebook 1"
+
+// notebookExt is the extension gbloxs open recognizes as a notebook.
+const notebookExt = ".gbx"
+
+// notebook is the .gbx file the blocks came from or are saved to.
+type notebook struct {
+	path string
+}
+
+// loadNotebook reads a notebook. A file that does not exist yet is an
+// empty notebook that is created on the first save.
+func loadNotebook(path string) (*notebook, []Block, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &notebook{path: path}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks, err := parseNotebook(string(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &notebook{path: path}, blocks, nil
+}
+
+func parseNotebook(data string) ([]Block, error) {
+	var blocks []Block
+	var section string // the header the body lines belong to
+	var body []string
+	lineNo := 0
+	bodyLine := 0               // the line the body starts at
+	ids := make(map[string]int) // the line each id was given on
+
+	flush := func() error {
+		text := strings.TrimRight(strings.Join(body, "\n"), "\n")
+		body = nil
+		if len(blocks) == 0 {
+			if strings.TrimSpace(text) != "" {
+				return fmt.Errorf("line %d: text before the first cell", lineNo)
+			}
+			return nil
+		}
+		b := &blocks[len(blocks)-1]
+		switch section {
+		case "note":
+			b.Content = text
+		case "command":
+			b.Command = text
+			b.Content = text
+		case "expect":
+			b.Expected = text
+		case "assert":
+			list, err := parseAssertions(text, bodyLine)
+			if err != nil {
+				return err
+			}
+			b.Assertions = list
+		case "attempt":
+			b.Attempts[len(b.Attempts)-1].Output = text
+		case "output":
+			b.Output = text
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+
+		if !strings.HasPrefix(line, "%%") {
+			if strings.HasPrefix(line, `\`) {
+				line = line[1:]
+			}
+			body = append(body, line)
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if line == notebookHeader {
+			continue
+		}
+
+		kind, rest, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "%%")), " ")
+		rest = strings.TrimSpace(rest)
+		section = kind
+		bodyLine = lineNo + 1
+
+		switch kind {
+		case "note", "command":
+			title, attrs := rest, ""
+			if quoted, err := strconv.QuotedPrefix(rest); err == nil {
+				title, _ = strconv.Unquote(quoted)
+				attrs = rest[len(quoted):]
+			}
+			b := Block{
+				Title:    title,
+				Type:     BlockTypeInfo,
+				Expanded: true,
+				Metadata: make(map[string]string),
+			}
+			if kind == "command" {
+				b.Type = BlockTypeCommand
+				b.Metadata["status"] = statusNotRun
+			}
+			for _, field := range strings.Fields(attrs) {
+				if id, ok := strings.CutPrefix(field, "id="); ok {
+					// References would find only one of the cells
+					if prev, dup := ids[id]; dup {
+						return nil, fmt.Errorf("line %d: id=%s is already the id of the cell on line %d", lineNo, id, prev)
+					}
+					ids[id] = lineNo
+					b.ID = id
+				}
+				if kind != "command" {
+					continue
+				}
+				if group, ok := strings.CutPrefix(field, "group="); ok {
+					b.Metadata["group"] = group
+				}
+				if _, err := policyAttr(field, &b.Policy); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+			}
+			blocks = append(blocks, b)
+
+		case "expect", "assert", "attempt", "output":
+			if len(blocks) == 0 || blocks[len(blocks)-1].Type == BlockTypeInfo {
+				return nil, fmt.Errorf("line %d: %s section outside a command cell", lineNo, kind)
+			}
+			switch kind {
+			case "attempt":
+				b := &blocks[len(blocks)-1]
+				b.Attempts = append(b.Attempts, parseAttempt(rest))
+			case "output":
+				applyResult(&blocks[len(blocks)-1], rest)
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: unknown section %q", lineNo, kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	// Cells written without an ID get new ones
+	lastID := highestBlockID(blocks)
+	step := 0
+	for i := range blocks {
+		if blocks[i].ID == "" {
+			lastID++
+			blocks[i].ID = strconv.Itoa(lastID)
+		}
+		if blocks[i].Timestamp.IsZero() {
+			blocks[i].Timestamp = time.Now()
+		}
+		if blocks[i].Command != "" {
+			step++
+			blocks[i].Metadata["step"] = strconv.Itoa(step)
+		}
+		if b := &blocks[i]; len(b.Attempts) > 0 {
+			// The output section is the last attempt
+			b.Attempts = append(b.Attempts, Attempt{Started: b.Timestamp, ExitCode: b.ExitCode, Error: b.Error, Output: b.Output})
+		}
+		if b := &blocks[i]; b.Metadata["status"] != statusNotRun && b.Command != "" {
+			checkAssertions(b)
+		}
+	}
+	return blocks, nil
+}
+
+// parseAttempt reads the attributes of an attempt header.
+func parseAttempt(attrs string) Attempt {
+	var a Attempt
+	for _, field := range strings.Fields(attrs) {
+		k, v, _ := strings.Cut(field, "=")
+		switch k {
+		case "exit":
+			a.ExitCode, _ = strconv.Atoi(v)
+		case "time":
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				a.Started = t.Local()
+			}
+		case "duration":
+			a.Duration, _ = time.ParseDuration(v)
+		case "timeout":
+			a.TimedOut = true
+		}
+	}
+	if a.TimedOut {
+		a.Error = "timed out"
+	} else if a.ExitCode != 0 {
+		a.Error = fmt.Sprintf("exit status %d", a.ExitCode)
+	}
+	return a
+}
+
+// applyResult restores a command's last result from the attributes of its
+// output header.
+func applyResult(b *Block, attrs string) {
+	delete(b.Metadata, "status")
+	b.Type = BlockTypeSuccess
+	for _, field := range strings.Fields(attrs) {
+		k, v, _ := strings.Cut(field, "=")
+		switch k {
+		case "exit":
+			b.ExitCode, _ = strconv.Atoi(v)
+		case "time":
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				b.Timestamp = t.Local()
+			}
+		}
+	}
+	if b.ExitCode != 0 {
+		b.Type = BlockTypeError
+		b.Error = fmt.Sprintf("exit status %d", b.ExitCode)
+	}
+}
+
+// renderNotebook writes blocks as a notebook. Commands become command
+// cells; other blocks with text become notes. Status messages, tables and
+// progress bars are not part of a notebook.
+func renderNotebook(blocks []Block) string {
+	var b strings.Builder
+	b.WriteString(notebookHeader + "\n")
+
+	for _, block := range blocks {
+		if block.Notice {
+			continue
+		}
+
+		switch {
+		case block.Command != "":
+			fmt.Fprintf(&b, "%%%% command %s%s%s%s\n", strconv.Quote(block.Title), cellID(block), cellGroup(block), policyAttrs(block.Policy))
+			writeNotebookBody(&b, block.Command)
+			if block.Expected != "" {
+				b.WriteString("%% expect\n")
+				writeNotebookBody(&b, block.Expected)
+			}
+			if len(block.Assertions) > 0 {
+				b.WriteString("%% assert\n")
+				writeNotebookBody(&b, assertionsText(block.Assertions))
+			}
+			if block.Metadata["status"] != statusNotRun && (block.Type == BlockTypeSuccess || block.Type == BlockTypeError) {
+				// The attempts before the last, which is the output
+				for i := 0; len(block.Attempts) > 1 && i < len(block.Attempts)-1; i++ {
+					a := block.Attempts[i]
+					fmt.Fprintf(&b, "%%%% attempt exit=%d time=%s duration=%s", a.ExitCode, a.Started.UTC().Format(time.RFC3339), a.Duration.Round(time.Millisecond))
+					if a.TimedOut {
+						b.WriteString(" timeout")
+					}
+					b.WriteString("\n")
+					writeNotebookBody(&b, a.Output)
+				}
+				fmt.Fprintf(&b, "%%%% output exit=%d time=%s\n", block.ExitCode, block.Timestamp.UTC().Format(time.RFC3339))
+				writeNotebookBody(&b, block.Output)
+			}
+
+		case block.Content != "":
+			fmt.Fprintf(&b, "%%%% note %s%s\n", strconv.Quote(block.Title), cellID(block))
+			writeNotebookBody(&b, block.Content)
+
+		default:
+			continue
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// cellID keeps a block's ID in the notebook so that references to its
+// output still work after the notebook is opened again.
+func cellID(block Block) string {
+	if _, err := strconv.Atoi(block.ID); err != nil {
+		return ""
+	}
+	return " id=" + block.ID
+}
+
+// cellGroup keeps the group a command runs in with the others of its
+// group.
+func cellGroup(block Block) string {
+	if group := block.Metadata["group"]; group != "" {
+		return " group=" + group
+	}
+	return ""
+}
+
+func writeNotebookBody(b *strings.Builder, text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "%%") || strings.HasPrefix(line, `\`) {
+			line = `\` + line
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+// saveDocument saves the runbook the session came from, or else the
+// session as a notebook.
+func (m *model) saveDocument() tea.Cmd {
+	if m.runbook != nil {
+		return m.saveRunbook()
+	}
+	return m.saveNotebook()
+}
+
+// saveNotebook writes the session to its notebook, creating one in the
+// working directory when the session did not come from one. Every command
+// becomes a step of the notebook.
+func (m *model) saveNotebook() tea.Cmd {
+	if m.notebook == nil {
+		name := "notebook-" + time.Now().Format("20060102-150405") + notebookExt
+		m.notebook = &notebook{path: filepath.Join(m.cwd, name)}
+	}
+
+	if err := os.WriteFile(m.notebook.path, []byte(renderNotebook(m.blocks)), 0o644); err != nil {
+		m.addInfoBlock("Saving notebook failed: " + err.Error())
+		return nil
+	}
+
+	step := 0
+	for i := range m.blocks {
+		if m.blocks[i].Command != "" && !m.blocks[i].Notice {
+			step++
+			if m.blocks[i].Metadata == nil {
+				m.blocks[i].Metadata = make(map[string]string)
+			}
+			m.blocks[i].Metadata["step"] = strconv.Itoa(step)
+		}
+	}
+
+	m.addInfoBlock("Notebook saved to " + m.notebook.path)
+	return nil
+}
+
+// clearOutputs forgets the results of every step.
+func (m *model) clearOutputs() tea.Cmd {
+	for i := range m.blocks {
+		b := &m.blocks[i]
+		if !b.isStep() {
+			continue
+		}
+		b.Output = ""
+		b.Error = ""
+		b.ExitCode = 0
+		b.Attempts = nil
+		b.Checks = nil
+		b.Type = BlockTypeCommand
+		b.Metadata["status"] = statusNotRun
+		b.Viewport = viewport.New(m.width-10, 10)
+	}
+	return nil
+}
+
+// expectSelected makes the selected command's last output the output it is
+// expected to produce.
+func (m *model) expectSelected() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) || m.blocks[m.selectedIdx].Command == "" {
+		return nil
+	}
+	b := &m.blocks[m.selectedIdx]
+	if b.Metadata["status"] == statusNotRun {
+		m.addInfoBlock("Run the command first; its output becomes the expected output")
+		return nil
+	}
+	b.Expected = b.Output
+	return nil
+}
+
+// expectationView shows whether a command produced its expected output.
+func (m model) expectationView(block Block) string {
+	switch {
+	case block.Expected == "":
+		return ""
+	case block.Metadata["status"] == statusNotRun || block.Type == BlockTypeCommand:
+		return m.styles.Muted.Render("  ◇ expected output recorded")
+	case strings.TrimSpace(block.Output) == strings.TrimSpace(block.Expected):
+		return m.styles.SuccessText.Render("  ✓ output matches the expected output")
+	default:
+		return m.styles.ErrorText.Render("  ≠ output differs from the expected output")
+	}
+}
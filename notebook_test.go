@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotebookRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "empty",
+			text: notebookHeader + "\n",
+		},
+		{
+			name: "note and command",
+			text: `%% gbloxs notebook 1
+%% note "Introduction" id=1
+Free text.
+
+Second paragraph.
+
+%% command "Build" id=2
+make build
+`,
+		},
+		{
+			name: "result and expectations",
+			text: `%% gbloxs notebook 1
+%% command "Test" id=3 group=ci timeout=30s
+go test ./...
+%% expect
+ok
+%% assert
+exit 0
+contains ok
+%% output exit=0 time=2026-01-02T15:04:05Z
+ok
+`,
+		},
+		{
+			name: "failed with attempts",
+			text: `%% gbloxs notebook 1
+%% command "Flaky" id=4 retries=2
+./flaky.sh
+%% attempt exit=1 time=2026-01-02T15:04:05Z duration=1.5s
+first try
+%% attempt exit=143 time=2026-01-02T15:04:07Z duration=30s timeout
+%% output exit=2 time=2026-01-02T15:04:40Z
+gave up
+`,
+		},
+		{
+			name: "escaped body lines",
+			text: `%% gbloxs notebook 1
+%% note "Escapes" id=5
+\%% not a header
+\\ starts with a backslash
+plain
+`,
+		},
+		{
+			name: "quoted title",
+			text: `%% gbloxs notebook 1
+%% command "say \"hi\"" id=6
+echo "hi"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseNotebook(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := renderNotebook(blocks); got != tt.text {
+				t.Errorf("render = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestParseNotebook(t *testing.T) {
+	text := `%% gbloxs notebook 1
+%% note "Intro"
+\%% literal
+%% command "One" id=7
+echo one
+%% output exit=3 time=2026-01-02T15:04:05Z
+one
+%% command "Two"
+echo two
+`
+	blocks, err := parseNotebook(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+
+	tests := []struct {
+		id, title, content, step, status string
+		exit                             int
+		typ                              BlockType
+	}{
+		{id: "8", title: "Intro", content: "%% literal", typ: BlockTypeInfo},
+		{id: "7", title: "One", content: "echo one", step: "1", exit: 3, typ: BlockTypeError},
+		{id: "9", title: "Two", content: "echo two", step: "2", status: statusNotRun, typ: BlockTypeCommand},
+	}
+	for i, tt := range tests {
+		b := blocks[i]
+		if b.ID != tt.id || b.Title != tt.title || b.Content != tt.content {
+			t.Errorf("block %d = #%s %q %q, want #%s %q %q", i, b.ID, b.Title, b.Content, tt.id, tt.title, tt.content)
+		}
+		if b.Metadata["step"] != tt.step || b.Metadata["status"] != tt.status {
+			t.Errorf("block %d step %q status %q, want %q %q", i, b.Metadata["step"], b.Metadata["status"], tt.step, tt.status)
+		}
+		if b.ExitCode != tt.exit || b.Type != tt.typ {
+			t.Errorf("block %d exit %d type %v, want %d %v", i, b.ExitCode, b.Type, tt.exit, tt.typ)
+		}
+	}
+	if blocks[1].Output != "one" {
+		t.Errorf("output = %q, want %q", blocks[1].Output, "one")
+	}
+}
+
+func TestParseNotebookErrors(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{
+			name: "text before a cell",
+			text: "%% gbloxs notebook 1\nstray\n%% note \"x\"\n",
+			want: "line 3: text before the first cell",
+		},
+		{
+			name: "output of a note",
+			text: "%% gbloxs notebook 1\n%% note \"x\"\n%% output exit=0\n",
+			want: "line 3: output section outside a command cell",
+		},
+		{
+			name: "unknown section",
+			text: "%% gbloxs notebook 1\n%% command \"x\"\nls\n%% result\n",
+			want: `line 4: unknown section "result"`,
+		},
+		{
+			name: "duplicate id",
+			text: "%% gbloxs notebook 1\n%% command \"a\" id=2\nls\n\n%% command \"b\" id=2\nls\n",
+			want: "line 5: id=2 is already the id of the cell on line 2",
+		},
+		{
+			name: "bad policy",
+			text: "%% gbloxs notebook 1\n%% command \"x\" retries=many\nls\n",
+			want: "line 2: retries=many",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseNotebook(tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
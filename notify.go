@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// defaultNotifyAfter is how long a command runs before gbloxs notifies
+// that it finished, unless notify.after says otherwise.
+const defaultNotifyAfter = 10 * time.Second
+
+// notifyErrorMsg reports that the notification command failed.
+type notifyErrorMsg struct{ err error }
+
+// notifyEscapeMsg carries the escapes of a notification to Update, which
+// writes them to the terminal the screen is drawn on.
+type notifyEscapeMsg string
+
+// threshold is how long a command must run for its end to be notified;
+// zero turns notifications off.
+func (c NotifyConfig) threshold() (time.Duration, error) {
+	switch c.After {
+	case "":
+		return defaultNotifyAfter, nil
+	case "off", "0":
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.After)
+	if err != nil || d < 0 {
+		return defaultNotifyAfter, fmt.Errorf("notify.after: %q is not a duration such as 30s", c.After)
+	}
+	return d, nil
+}
+
+// methods are the ways notifications are delivered.
+func (c NotifyConfig) methods() []string {
+	if c.Via == nil {
+		return []string{"bell"}
+	}
+	return c.Via
+}
+
+// notify tells the user that a long command finished: with the terminal
+// bell, a desktop notification escape the terminal turns into a popup, or
+// the user's own command.
+func (m model) notify(b Block, elapsed time.Duration) tea.Cmd {
+	title := b.Title
+	if title == "" || title == "User Input" {
+		title = b.Command
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	status := "succeeded"
+	if b.Type == BlockTypeError {
+		status = "failed with " + b.failure()
+	}
+	duration := shortDuration(elapsed)
+	body := fmt.Sprintf("%s after %s", status, duration)
+
+	return m.deliver(title, body, []string{
+		"GBLOXS_TITLE=" + title,
+		"GBLOXS_STATUS=" + status,
+		"GBLOXS_EXIT=" + strconv.Itoa(b.ExitCode),
+		"GBLOXS_DURATION=" + duration,
+		"GBLOXS_BLOCK=" + b.ID,
+		"GBLOXS_COMMAND=" + b.Command,
+	})
+}
+
+// deliver sends a notification the ways notify.via lists. The command
+// gets it in env.
+func (m model) deliver(title, body string, env []string) tea.Cmd {
+	var escapes strings.Builder
+	command := ""
+	for _, method := range m.config.Notify.methods() {
+		switch method {
+		case "bell":
+			escapes.WriteString("\a")
+		case "osc9":
+			fmt.Fprintf(&escapes, "\x1b]9;%s: %s\a", oscText(title), body)
+		case "osc777":
+			fmt.Fprintf(&escapes, "\x1b]777;notify;%s;%s\a", strings.ReplaceAll(oscText(title), ";", ","), body)
+		case "command":
+			command = m.config.Notify.Command
+		}
+	}
+
+	var cmds []tea.Cmd
+	if escapes.Len() > 0 {
+		text := notifyEscapeMsg(escapes.String())
+		cmds = append(cmds, func() tea.Msg { return text })
+	}
+	if command != "" {
+		cmds = append(cmds, func() tea.Msg {
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Env = append(os.Environ(), env...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				if text := strings.TrimSpace(string(out)); text != "" {
+					err = fmt.Errorf("%w: %s", err, text)
+				}
+				return notifyErrorMsg{err: err}
+			}
+			return nil
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// oscText removes the control characters that would end an escape
+// sequence early.
+func oscText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
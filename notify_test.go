@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runCmd runs cmd and the commands it batches, collecting their messages.
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		var msgs []tea.Msg
+		for _, c := range batch {
+			msgs = append(msgs, runCmd(c)...)
+		}
+		return msgs
+	}
+	if msg == nil {
+		return nil
+	}
+	return []tea.Msg{msg}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     NotifyConfig
+		escapes string
+		failed  bool
+	}{
+		{name: "bell by default", escapes: "\a"},
+		{name: "nowhere", cfg: NotifyConfig{Via: []string{}}},
+		{
+			name:    "osc9 and osc777",
+			cfg:     NotifyConfig{Via: []string{"osc9", "osc777"}},
+			escapes: "\x1b]9;make;test: done\a\x1b]777;notify;make,test;done\a",
+		},
+		{
+			name:   "command that fails",
+			cfg:    NotifyConfig{Via: []string{"command"}, Command: "exit 3"},
+			failed: true,
+		},
+		{
+			name: "command",
+			cfg:  NotifyConfig{Via: []string{"command"}, Command: `test "$GBLOXS_TITLE" = "make; test"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := model{config: Config{Notify: tt.cfg}}
+			escapes, failed := "", false
+			// The title loses the newline that would end the escape early
+			for _, msg := range runCmd(m.deliver("make;\ntest", "done", []string{"GBLOXS_TITLE=make; test"})) {
+				switch msg := msg.(type) {
+				case notifyEscapeMsg:
+					escapes += string(msg)
+				case notifyErrorMsg:
+					failed = true
+				default:
+					t.Errorf("unexpected message %T", msg)
+				}
+			}
+			if escapes != tt.escapes || failed != tt.failed {
+				t.Errorf("escapes %q failed %v, want %q %v", escapes, failed, tt.escapes, tt.failed)
+			}
+		})
+	}
+}
+
+func TestNotifyThreshold(t *testing.T) {
+	tests := []struct {
+		after string
+		want  time.Duration
+		err   bool
+	}{
+		{after: "", want: defaultNotifyAfter},
+		{after: "off", want: 0},
+		{after: "0", want: 0},
+		{after: "90s", want: 90 * time.Second},
+		{after: "soon", want: defaultNotifyAfter, err: true},
+		{after: "-5s", want: defaultNotifyAfter, err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NotifyConfig{After: tt.after}.threshold()
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("threshold(%q) = %v, %v, want %v, error %v", tt.after, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(darwin || freebsd || linux || netbsd || openbsd)
+
+package main
+
+// checkPrivateDir makes sure that only this user can get into dir. There
+// are no Unix owners and modes to check here.
+func checkPrivateDir(dir string) error {
+	return nil
+}
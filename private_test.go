@@ -0,0 +1,54 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPrivateDir(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	private := filepath.Join(root, "private")
+	if err := os.Mkdir(private, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+	open := filepath.Join(root, "open")
+	if err := os.Mkdir(open, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// Mkdir is subject to the umask; Chmod is not
+	if err := os.Chmod(open, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{dir: private},
+		{dir: open, want: "has mode 0755"},
+		{dir: file, want: "not a directory"},
+		{dir: link, want: "not a directory"},
+		{dir: filepath.Join(root, "missing"), want: "no such file"},
+	}
+	for _, tt := range tests {
+		err := checkPrivateDir(tt.dir)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("checkPrivateDir(%s) = %v, want nil", tt.dir, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("checkPrivateDir(%s) = %v, want %q", tt.dir, err, tt.want)
+		}
+	}
+}
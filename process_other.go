@@ -0,0 +1,23 @@
+//go:build !(darwin || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// ownProcessGroup makes cmd the leader of a new process group, so the
+// commands it starts can be signalled together and keep running when
+// gbloxs lets go of them.
+func ownProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup asks the process group of a started cmd to terminate, or
+// kills it when force is set. Without process groups only the process
+// itself is signalled.
+func signalGroup(cmd *exec.Cmd, force bool) error {
+	if force {
+		return cmd.Process.Kill()
+	}
+	return cmd.Process.Signal(os.Interrupt)
+}
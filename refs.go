@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Commands can use the output of earlier blocks, named by block ID:
+//
+//	grep ERROR {{block:3}}    the path of a file holding block 3's output
+//	grep ERROR "$B3"          the same path, from the environment
+//	{{block:3}} | grep ERROR  block 3's output on stdin
+//
+// The files are written just before the command runs and removed when it
+// finishes. Rerunning a block reads the referenced blocks again. A block
+// whose command still runs or waits in the queue cannot be read yet.
+var (
+	blockRef    = regexp.MustCompile(`\{\{\s*block:(\d+)\s*\}\}`)
+	blockEnvRef = regexp.MustCompile(`\$\{?B(\d+)\b\}?`)
+	blockPipe   = regexp.MustCompile(`^\s*\{\{\s*block:(\d+)\s*\}\}\s*\|`)
+)
+
+// blockInput is a command with its block references resolved.
+type blockInput struct {
+	command string
+	// stdin is the output piped into the command, if any
+	stdin *string
+	env   []string
+	// inputs are the IDs of the blocks the command reads, in order
+	inputs []string
+	files  []string
+}
+
+// newBlockID returns an ID no block in the session has had before, so
+// references keep pointing at the same block after others are deleted.
+func (m *model) newBlockID() string {
+	m.lastID++
+	return strconv.Itoa(m.lastID)
+}
+
+// highestBlockID is the largest numeric ID among blocks.
+func highestBlockID(blocks []Block) int {
+	highest := 0
+	for _, b := range blocks {
+		if n, err := strconv.Atoi(b.ID); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+func (m model) blockByID(id string) (Block, bool) {
+	for _, b := range m.blocks {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return Block{}, false
+}
+
+// resolveRefs replaces the block references in cmdStr. Call cleanup on the
+// result once the command has finished, also when an error is returned.
+func (m model) resolveRefs(cmdStr string) (blockInput, error) {
+	in := blockInput{command: cmdStr}
+	paths := make(map[string]string)
+
+	output := func(id string) (string, error) {
+		b, ok := m.blockByID(id)
+		if !ok {
+			return "", fmt.Errorf("block %s does not exist", id)
+		}
+		if _, running := m.jobs[id]; running || m.queuedIndex(id) >= 0 {
+			return "", fmt.Errorf("block %s is still running; its output is not complete", id)
+		}
+		if !slices.Contains(in.inputs, id) {
+			in.inputs = append(in.inputs, id)
+		}
+		return b.Output, nil
+	}
+	file := func(id string) (string, error) {
+		if path, ok := paths[id]; ok {
+			return path, nil
+		}
+		text, err := output(id)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.CreateTemp("", "gbloxs-block-"+id+"-*.txt")
+		if err != nil {
+			return "", err
+		}
+		in.files = append(in.files, f.Name())
+		_, err = f.WriteString(text)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		paths[id] = f.Name()
+		return f.Name(), err
+	}
+
+	if match := blockPipe.FindStringSubmatch(in.command); match != nil {
+		text, err := output(match[1])
+		if err != nil {
+			return in, err
+		}
+		in.stdin = &text
+		in.command = in.command[len(match[0]):]
+	}
+
+	var err error
+	in.command = blockRef.ReplaceAllStringFunc(in.command, func(ref string) string {
+		path, ferr := file(blockRef.FindStringSubmatch(ref)[1])
+		if ferr != nil && err == nil {
+			err = ferr
+		}
+		return shellQuote(path)
+	})
+	if err != nil {
+		return in, err
+	}
+
+	for _, match := range blockEnvRef.FindAllStringSubmatch(in.command, -1) {
+		path, err := file(match[1])
+		if err != nil {
+			return in, err
+		}
+		in.env = append(in.env, "B"+match[1]+"="+path)
+	}
+	return in, nil
+}
+
+func (in blockInput) cleanup() {
+	for _, f := range in.files {
+		os.Remove(f)
+	}
+}
+
+// shellSafe matches words sh takes literally.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s as a single word for sh, leaving words that need no
+// quoting as they are.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// openPipe starts input for a command that reads the selected block's
+// output on stdin.
+func (m *model) openPipe() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	source := m.blocks[m.selectedIdx].ID
+	if _, err := strconv.Atoi(source); err != nil {
+		return nil
+	}
+	m.closeInput()
+	m.pipeFrom = source
+	m.inputMode = true
+	m.showInput = true
+	m.textInput.SetValue("| ")
+	m.textInput.CursorEnd()
+	return m.textInput.Focus()
+}
+
+// pipeInput turns "| cmd", typed after openPipe, into a command reading
+// the source block through a reference, so that rerunning it or saving it
+// in a notebook keeps the link. It also returns the source block's ID.
+// Input that no longer starts with | runs as typed.
+func (m *model) pipeInput(input string) (string, string) {
+	source := m.pipeFrom
+	m.pipeFrom = ""
+	rest, ok := strings.CutPrefix(strings.TrimLeft(input, " "), "|")
+	if source == "" || !ok {
+		return input, ""
+	}
+	if strings.TrimSpace(rest) == "" {
+		return "", ""
+	}
+	return "!{{block:" + source + "}} |" + rest, source
+}
+
+// selectPipeSource selects the block the selected block's input was piped
+// from.
+func (m *model) selectPipeSource() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	source := strings.TrimPrefix(m.blocks[m.selectedIdx].Metadata["source"], "#")
+	for i, b := range m.blocks {
+		if source != "" && b.ID == source {
+			m.selectBlock(i)
+			return nil
+		}
+	}
+	m.addInfoBlock("The selected block was not piped from a block that still exists")
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveRefs(t *testing.T) {
+	m := model{
+		blocks: []Block{
+			{ID: "1", Output: "one\n"},
+			{ID: "10", Output: "ten\n"},
+			{ID: "3", Output: "partial", IsLoading: true},
+			{ID: "4", Output: "old"},
+		},
+		jobs:  map[string]*job{"3": {blockID: "3"}},
+		queue: []queuedCommand{{blockID: "4"}},
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		// want is the command with the paths of the files written as the
+		// ID of the block they hold
+		want    string
+		stdin   string
+		env     []string
+		inputs  []string
+		wantErr string
+	}{
+		{name: "none", command: "ls -l", want: "ls -l"},
+		{name: "file", command: "grep ERROR {{block:1}}", want: "grep ERROR @1", inputs: []string{"1"}},
+		{name: "spaces", command: "wc {{ block:10 }} {{block:1}}", want: "wc @10 @1", inputs: []string{"10", "1"}},
+		{name: "one file per block", command: "diff {{block:1}} {{block:1}}", want: "diff @1 @1", inputs: []string{"1"}},
+		{name: "stdin", command: "{{block:1}} | grep o", want: " grep o", stdin: "one\n", inputs: []string{"1"}},
+		{name: "stdin and file", command: " {{block:10}} |diff - {{block:1}}", want: "diff - @1", stdin: "ten\n", inputs: []string{"10", "1"}},
+		{
+			name:    "environment",
+			command: `cat "$B1" "$B10" ${B1}`,
+			want:    `cat "$B1" "$B10" ${B1}`,
+			env:     []string{"B1=@1", "B10=@10", "B1=@1"},
+			inputs:  []string{"1", "10"},
+		},
+		{name: "not a reference", command: "echo $B1x $BX {{block:}}", want: "echo $B1x $BX {{block:}}"},
+
+		{name: "unknown block", command: "cat {{block:2}}", wantErr: "block 2 does not exist"},
+		{name: "unknown in the environment", command: "cat $B11", wantErr: "block 11 does not exist"},
+		{name: "unknown on stdin", command: "{{block:99}} | wc", wantErr: "block 99 does not exist"},
+		{name: "running", command: "cat {{block:3}}", wantErr: "block 3 is still running"},
+		{name: "queued", command: "cat $B4", wantErr: "block 4 is still running"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := m.resolveRefs(tt.command)
+			defer in.cleanup()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every file holds the output of its block
+			byPath := make(map[string]string)
+			for _, path := range in.files {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, b := range m.blocks {
+					if b.Output == string(data) {
+						byPath[path] = "@" + b.ID
+					}
+				}
+			}
+			named := func(s string) string {
+				for path, name := range byPath {
+					s = strings.ReplaceAll(s, path, name)
+				}
+				return s
+			}
+
+			if got := named(in.command); got != tt.want {
+				t.Errorf("command = %q, want %q", got, tt.want)
+			}
+			stdin := ""
+			if in.stdin != nil {
+				stdin = *in.stdin
+			}
+			if stdin != tt.stdin {
+				t.Errorf("stdin = %q, want %q", stdin, tt.stdin)
+			}
+			var env []string
+			for _, e := range in.env {
+				env = append(env, named(e))
+			}
+			if !reflect.DeepEqual(env, tt.env) {
+				t.Errorf("env = %q, want %q", env, tt.env)
+			}
+			if !reflect.DeepEqual(in.inputs, tt.inputs) {
+				t.Errorf("inputs = %q, want %q", in.inputs, tt.inputs)
+			}
+
+			files := in.files
+			in.cleanup()
+			for _, path := range files {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s left behind", path)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeInput(t *testing.T) {
+	tests := []struct {
+		from    string
+		input   string
+		command string
+		source  string
+	}{
+		{from: "3", input: "| grep ERROR", command: "!{{block:3}} | grep ERROR", source: "3"},
+		{from: "3", input: "  |sort -u", command: "!{{block:3}} |sort -u", source: "3"},
+		{from: "12", input: "| jq . | less", command: "!{{block:12}} | jq . | less", source: "12"},
+		// Nothing to pipe into
+		{from: "3", input: "|", command: ""},
+		{from: "3", input: "|   ", command: ""},
+		// The | was deleted, or no block was piped from
+		{from: "3", input: "grep ERROR", command: "grep ERROR"},
+		{from: "", input: "| grep ERROR", command: "| grep ERROR"},
+	}
+
+	for _, tt := range tests {
+		m := model{pipeFrom: tt.from}
+		command, source := m.pipeInput(tt.input)
+		if command != tt.command || source != tt.source {
+			t.Errorf("pipeInput(%q) from %q = %q, %q, want %q, %q", tt.input, tt.from, command, source, tt.command, tt.source)
+		}
+		if m.pipeFrom != "" {
+			t.Errorf("pipeInput(%q) kept the source", tt.input)
+		}
+	}
+}
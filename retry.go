@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// defaultBackoff is the wait before the first retry unless jobs.backoff
+	// says otherwise; it doubles after every retry.
+	defaultBackoff = time.Second
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = 5 * time.Minute
+	// timeoutGrace is how long a command that timed out has to exit after
+	// it was asked to, before it is killed.
+	timeoutGrace = 5 * time.Second
+	// exitTimedOut is the exit code of a command that timed out, the one
+	// timeout(1) uses.
+	exitTimedOut = 124
+)
+
+// RunPolicy limits how long a command runs and how often it is run again
+// when it fails. A block's own policy uses -1 for the fields it leaves to
+// the jobs settings.
+type RunPolicy struct {
+	// Timeout stops the command once it ran this long; 0 is no timeout.
+	Timeout time.Duration
+	// Retries is how often a failed command is run again.
+	Retries int
+	// Backoff is the wait before the first retry, doubling after each.
+	Backoff time.Duration
+}
+
+// Attempt is one run of a block's command: what it printed and how it
+// ended. A command that is retried has one per run.
+type Attempt struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+	Output   string        `json:"output"`
+	TimedOut bool          `json:"timed_out,omitempty"`
+}
+
+// runPolicy is the policy of the jobs settings. Settings that cannot be
+// read are left at their defaults; check reports them.
+func (c JobsConfig) runPolicy() RunPolicy {
+	p := RunPolicy{Retries: max(c.Retries, 0), Backoff: defaultBackoff}
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		p.Timeout = d
+	}
+	if d, err := time.ParseDuration(c.Backoff); err == nil && d >= 0 {
+		p.Backoff = d
+	}
+	return p
+}
+
+// policyFor is the policy the block's command runs with: the block's own
+// settings over the jobs settings.
+func (m model) policyFor(b Block) RunPolicy {
+	p := m.config.Jobs.runPolicy()
+	if own := b.Policy; own != nil {
+		if own.Timeout >= 0 {
+			p.Timeout = own.Timeout
+		}
+		if own.Retries >= 0 {
+			p.Retries = own.Retries
+		}
+		if own.Backoff >= 0 {
+			p.Backoff = own.Backoff
+		}
+	}
+	return p
+}
+
+// backoff is the wait after the given attempt failed.
+func (p RunPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// policyAttr reads a timeout=, retries= or backoff= attribute of a
+// notebook cell or runbook fence into the block's own policy, creating it.
+// It reports false for other attributes.
+func policyAttr(field string, policy **RunPolicy) (bool, error) {
+	name, value, _ := strings.Cut(field, "=")
+	if name != "timeout" && name != "retries" && name != "backoff" {
+		return false, nil
+	}
+	if *policy == nil {
+		*policy = &RunPolicy{Timeout: -1, Retries: -1, Backoff: -1}
+	}
+	p := *policy
+
+	if name == "retries" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("retries=%s is not a number of retries", value)
+		}
+		p.Retries = n
+		return true, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return true, fmt.Errorf("%s is not a duration such as 30s", field)
+	}
+	if name == "timeout" {
+		p.Timeout = d
+	} else {
+		p.Backoff = d
+	}
+	return true, nil
+}
+
+// policyAttrs writes a block's own policy as the attributes policyAttr
+// reads.
+func policyAttrs(p *RunPolicy) string {
+	if p == nil {
+		return ""
+	}
+	var attrs string
+	if p.Timeout >= 0 {
+		attrs += " timeout=" + p.Timeout.String()
+	}
+	if p.Retries >= 0 {
+		attrs += " retries=" + strconv.Itoa(p.Retries)
+	}
+	if p.Backoff >= 0 {
+		attrs += " backoff=" + p.Backoff.String()
+	}
+	return attrs
+}
+
+// finishAttempt records how one run of the block's command ended. It
+// reports whether the command is to be run again, and after how long:
+// runs that failed, by their exit code or their expectations, are retried
+// as the policy allows, unless they were stopped on purpose.
+func (m model) finishAttempt(b *Block, output string, err error, started time.Time, attempt int, timedOut, stopped bool) (time.Duration, bool) {
+	m.finishCommand(b, output, err)
+	policy := m.policyFor(*b)
+	if timedOut {
+		b.ExitCode = exitTimedOut
+		b.Error = fmt.Sprintf("timed out after %s", policy.Timeout)
+		b.Type = BlockTypeError
+	}
+	// Expectations see the exit code of the timeout, not of the signal
+	// that ended the command
+	checkAssertions(b)
+
+	if attempt == 1 {
+		b.Attempts = nil
+	}
+	b.Attempts = append(b.Attempts, Attempt{
+		Started:  started,
+		Duration: time.Since(started),
+		ExitCode: b.ExitCode,
+		Error:    b.Error,
+		Output:   output,
+		TimedOut: timedOut,
+	})
+
+	if !b.failed() || stopped || attempt > policy.Retries {
+		return 0, false
+	}
+	return policy.backoff(attempt), true
+}
+
+// shortDuration rounds a duration to tenths of a second below ten seconds
+// and to seconds above.
+func shortDuration(d time.Duration) string {
+	if d < 10*time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// toggleAttempts shows or hides the attempts of the selected block.
+func (m *model) toggleAttempts() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	b := &m.blocks[m.selectedIdx]
+	if len(b.Attempts) < 2 {
+		m.addInfoBlock("The selected block's command ran once; there are no attempts to show")
+		return nil
+	}
+	b.ShowAttempts = !b.ShowAttempts
+	return nil
+}
+
+// attemptsView shows the attempts of a command that was retried: one line
+// per attempt, and what each printed when they are expanded.
+func (m model) attemptsView(b Block) string {
+	if len(b.Attempts) < 2 {
+		return ""
+	}
+
+	var out strings.Builder
+	hint := ""
+	if !b.ShowAttempts && m.keys.Attempts.Enabled() {
+		hint = fmt.Sprintf(" (%s to expand)", m.keys.Attempts.Help().Key)
+	}
+	out.WriteString(m.styles.Muted.Render(fmt.Sprintf("  ↻ %d attempts%s", len(b.Attempts), hint)))
+
+	for i, a := range b.Attempts {
+		mark, style := "✓", m.styles.SuccessText
+		if a.ExitCode != 0 {
+			mark, style = "✗", m.styles.ErrorText
+		}
+		result := fmt.Sprintf("exit %d", a.ExitCode)
+		if a.TimedOut {
+			result = "timed out"
+		}
+		line := fmt.Sprintf("    %s %d. %s, %s, %s", mark, i+1, a.Started.Format("15:04:05"), shortDuration(a.Duration), result)
+		out.WriteString("\n" + style.Render(line))
+
+		if b.ShowAttempts && strings.TrimSpace(a.Output) != "" {
+			for _, l := range strings.Split(strings.TrimRight(a.Output, "\n"), "\n") {
+				out.WriteString("\n" + m.styles.Muted.Render("      │ ") + l)
+			}
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{backoff: time.Second, attempt: 1, want: time.Second},
+		{backoff: time.Second, attempt: 2, want: 2 * time.Second},
+		{backoff: time.Second, attempt: 4, want: 8 * time.Second},
+		{backoff: time.Minute, attempt: 3, want: 4 * time.Minute},
+		{backoff: time.Minute, attempt: 4, want: maxBackoff},
+		{backoff: time.Second, attempt: 1000, want: maxBackoff},
+		{backoff: time.Hour, attempt: 1, want: maxBackoff},
+		{backoff: 0, attempt: 5, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := (RunPolicy{Backoff: tt.backoff}).backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff %s after attempt %d = %s, want %s", tt.backoff, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs JobsConfig
+		want RunPolicy
+	}{
+		{name: "defaults", want: RunPolicy{Backoff: defaultBackoff}},
+		{name: "set", jobs: JobsConfig{Timeout: "1m", Retries: 2, Backoff: "3s"}, want: RunPolicy{Timeout: time.Minute, Retries: 2, Backoff: 3 * time.Second}},
+		{name: "no wait", jobs: JobsConfig{Backoff: "0s"}, want: RunPolicy{}},
+		{name: "unreadable", jobs: JobsConfig{Timeout: "soon", Retries: -1, Backoff: "-1s"}, want: RunPolicy{Backoff: defaultBackoff}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.jobs.runPolicy(); got != tt.want {
+			t.Errorf("%s: runPolicy = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	m := model{config: Config{Jobs: JobsConfig{Timeout: "1m", Retries: 2, Backoff: "3s"}}}
+	jobs := RunPolicy{Timeout: time.Minute, Retries: 2, Backoff: 3 * time.Second}
+
+	tests := []struct {
+		name string
+		own  *RunPolicy
+		want RunPolicy
+	}{
+		{name: "none of its own", want: jobs},
+		{name: "all inherited", own: &RunPolicy{Timeout: -1, Retries: -1, Backoff: -1}, want: jobs},
+		{name: "retries only", own: &RunPolicy{Timeout: -1, Retries: 5, Backoff: -1}, want: RunPolicy{Timeout: time.Minute, Retries: 5, Backoff: 3 * time.Second}},
+		{name: "zero overrides", own: &RunPolicy{Timeout: 0, Retries: 0, Backoff: 0}, want: RunPolicy{}},
+	}
+
+	for _, tt := range tests {
+		if got := m.policyFor(Block{Policy: tt.own}); got != tt.want {
+			t.Errorf("%s: policyFor = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAttr(t *testing.T) {
+	tests := []struct {
+		fields  []string
+		want    *RunPolicy
+		attrs   string
+		wantErr string
+	}{
+		{fields: []string{"id=build"}, want: nil},
+		{fields: []string{"timeout=30s"}, want: &RunPolicy{Timeout: 30 * time.Second, Retries: -1, Backoff: -1}, attrs: " timeout=30s"},
+		{fields: []string{"retries=3", "backoff=500ms"}, want: &RunPolicy{Timeout: -1, Retries: 3, Backoff: 500 * time.Millisecond}, attrs: " retries=3 backoff=500ms"},
+		{fields: []string{"timeout=0s", "retries=0"}, want: &RunPolicy{Timeout: 0, Retries: 0, Backoff: -1}, attrs: " timeout=0s retries=0"},
+
+		{fields: []string{"timeout=30"}, wantErr: "timeout=30 is not a duration"},
+		{fields: []string{"timeout=-1s"}, wantErr: "timeout=-1s is not a duration"},
+		{fields: []string{"backoff="}, wantErr: "backoff= is not a duration"},
+		{fields: []string{"retries=many"}, wantErr: "retries=many is not a number"},
+		{fields: []string{"retries=-2"}, wantErr: "retries=-2 is not a number"},
+	}
+
+	for _, tt := range tests {
+		var policy *RunPolicy
+		var err error
+		for _, field := range tt.fields {
+			name, _, _ := strings.Cut(field, "=")
+			ok, ferr := policyAttr(field, &policy)
+			if want := name != "id"; ok != want {
+				t.Errorf("policyAttr(%q) reports %v, want %v", field, ok, want)
+			}
+			if ferr != nil {
+				err = ferr
+			}
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: error = %v, want %q", tt.fields, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.fields, err)
+			continue
+		}
+		if (policy == nil) != (tt.want == nil) || (policy != nil && *policy != *tt.want) {
+			t.Errorf("%q: policy = %+v, want %+v", tt.fields, policy, tt.want)
+		}
+		if got := policyAttrs(policy); got != tt.attrs {
+			t.Errorf("%q: written as %q, want %q", tt.fields, got, tt.attrs)
+		}
+	}
+}
+
+func TestFinishAttemptRetries(t *testing.T) {
+	failed := errors.New("exit status 1")
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		stopped bool
+		retry   bool
+		delay   time.Duration
+	}{
+		{name: "success", attempt: 1},
+		{name: "first failure", err: failed, attempt: 1, retry: true, delay: time.Second},
+		{name: "second failure", err: failed, attempt: 2, retry: true, delay: 2 * time.Second},
+		{name: "retries used up", err: failed, attempt: 3},
+		{name: "stopped", err: failed, attempt: 1, stopped: true},
+	}
+
+	for _, tt := range tests {
+		b := Block{
+			Command:  "make",
+			Metadata: map[string]string{},
+			Policy:   &RunPolicy{Timeout: -1, Retries: 2, Backoff: time.Second},
+			Attempts: []Attempt{{ExitCode: 1}},
+		}
+		delay, retry := model{}.finishAttempt(&b, "out", tt.err, time.Now(), tt.attempt, false, tt.stopped)
+		if retry != tt.retry || delay != tt.delay {
+			t.Errorf("%s: retry %v after %s, want %v after %s", tt.name, retry, delay, tt.retry, tt.delay)
+		}
+		// A first attempt starts the list over
+		if want := min(tt.attempt, 2); len(b.Attempts) != want {
+			t.Errorf("%s: %d attempts recorded, want %d", tt.name, len(b.Attempts), want)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// statusNotRun marks a step that has not been executed in this session.
+const statusNotRun = "not run"
+
+var (
+	fenceOpen     = regexp.MustCompile("^([ \t]*)(`{3,}|~{3,})[ \t]*([^ \t\r\n`]*)([^\r\n`]*)")
+	headingLine   = regexp.MustCompile(`^#{1,6}[ \t]+(.*?)[ \t#]*$`)
+	runbookResult = regexp.MustCompile(`^<!-- gbloxs: (.*) -->$`)
+)
+
+// shellLanguages are the fence languages whose code becomes a step.
+var shellLanguages = map[string]bool{"sh": true, "bash": true, "shell": true, "zsh": true}
+
+// runbook is a Markdown runbook: the document split into prose, kept
+// verbatim, and shell code blocks, which become steps. Saving writes the
+// document back with each step's last result after its code block.
+// Consecutive steps whose fence names the same group, as in
+// "```sh group=build", run at the same time; timeout=, retries= and
+// backoff= on the fence set a step's own timeout and retries. An assert
+// code block right after a step holds the step's expectations.
+type runbook struct {
+	path  string
+	parts []runbookPart
+}
+
+type runbookPart struct {
+	text string // prose, verbatim
+
+	// Steps have a number, counting from 1, and the fence they were
+	// written with so that saving keeps them as they were.
+	step   int
+	indent string
+	fence  string
+	lang   string
+	info   string // what follows the language, such as group=build
+	code   string
+	// assert is the assert code block after the step, verbatim with the
+	// blank lines before it, and assertions what it expects
+	assert     string
+	assertions []Assertion
+}
+
+// loadRunbook reads a Markdown runbook and turns it into blocks: an info
+// block per prose section and a command block, not yet run, per shell code
+// block. Results embedded by an earlier save are dropped.
+func loadRunbook(path string) (*runbook, []Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rb := &runbook{path: path}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		// Not a line; it would become one in a fence left open
+		lines = lines[:len(lines)-1]
+	}
+	var prose strings.Builder
+
+	for i := 0; i < len(lines); i++ {
+		open := fenceOpen.FindStringSubmatch(lines[i])
+		if open == nil {
+			prose.WriteString(lines[i])
+			continue
+		}
+
+		end := closingFence(lines, i+1, open[2])
+		if !shellLanguages[strings.ToLower(open[3])] {
+			for ; i < end && i < len(lines); i++ {
+				prose.WriteString(lines[i])
+			}
+			if i < len(lines) {
+				prose.WriteString(lines[i])
+			}
+			continue
+		}
+
+		if prose.Len() > 0 {
+			rb.parts = append(rb.parts, runbookPart{text: prose.String()})
+			prose.Reset()
+		}
+
+		var code []string
+		for _, line := range lines[i+1 : min(end, len(lines))] {
+			code = append(code, strings.TrimPrefix(strings.TrimRight(line, "\r\n"), open[1]))
+		}
+		var policy *RunPolicy
+		for _, field := range strings.Fields(open[4]) {
+			if _, err := policyAttr(field, &policy); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+			}
+		}
+		part := runbookPart{
+			step:   rb.steps() + 1,
+			indent: open[1],
+			fence:  open[2],
+			lang:   open[3],
+			info:   open[4],
+			code:   strings.Join(code, "\n"),
+		}
+
+		next := end + 1
+		if j, assertEnd, text := assertBlock(lines, next); j >= 0 {
+			for k, line := range strings.Split(text, "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				a, err := parseAssertion(line)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s:%d: %w", path, j+2+k, err)
+				}
+				part.assertions = append(part.assertions, a)
+			}
+			part.assert = strings.Join(lines[next:min(assertEnd+1, len(lines))], "")
+			next = assertEnd + 1
+		}
+		rb.parts = append(rb.parts, part)
+
+		i = skipResult(lines, next) - 1
+	}
+	if prose.Len() > 0 {
+		rb.parts = append(rb.parts, runbookPart{text: prose.String()})
+	}
+
+	return rb, rb.blocks(), nil
+}
+
+// closingFence returns the line index of the fence closing one opened with
+// marker, or len(lines) when it is never closed.
+func closingFence(lines []string, from int, marker string) int {
+	for i := from; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == "" {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// assertBlock finds an assert code block that follows a step, after
+// blank lines only, from line index from on. It returns the indexes of its
+// opening and closing fences and its text, or -1 when there is none.
+func assertBlock(lines []string, from int) (int, int, string) {
+	i := from
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i >= len(lines) {
+		return -1, 0, ""
+	}
+	open := fenceOpen.FindStringSubmatch(lines[i])
+	if open == nil || open[3] != "assert" {
+		return -1, 0, ""
+	}
+	end := closingFence(lines, i+1, open[2])
+	var text []string
+	for _, line := range lines[i+1 : min(end, len(lines))] {
+		text = append(text, strings.TrimRight(line, "\r\n"))
+	}
+	return i, end, strings.Join(text, "\n")
+}
+
+// skipResult skips the result a previous save put after a step: a marker
+// comment followed by an output code block. It returns the index of the
+// first line that belongs to the document.
+func skipResult(lines []string, from int) int {
+	i := from
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i >= len(lines) || !runbookResult.MatchString(strings.TrimSpace(lines[i])) {
+		return from
+	}
+	i++
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i < len(lines) {
+		if open := fenceOpen.FindStringSubmatch(lines[i]); open != nil && open[3] == "output" {
+			return closingFence(lines, i+1, open[2]) + 1
+		}
+	}
+	return i
+}
+
+func (rb *runbook) steps() int {
+	n := 0
+	for _, p := range rb.parts {
+		if p.step > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// blocks builds the blocks for the runbook. Prose is split at headings;
+// the latest heading also names the steps under it.
+func (rb *runbook) blocks() []Block {
+	var blocks []Block
+	heading := ""
+
+	addInfo := func(title string, body []string) {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if text == "" {
+			return
+		}
+		if title == "" {
+			title = filepath.Base(rb.path)
+		}
+		blocks = append(blocks, Block{
+			Title:    title,
+			Content:  text,
+			Type:     BlockTypeInfo,
+			Expanded: true,
+			Metadata: make(map[string]string),
+		})
+	}
+
+	for _, p := range rb.parts {
+		if p.step == 0 {
+			var body []string
+			for _, line := range strings.Split(p.text, "\n") {
+				if m := headingLine.FindStringSubmatch(line); m != nil {
+					addInfo(heading, body)
+					heading, body = m[1], nil
+					continue
+				}
+				body = append(body, line)
+			}
+			addInfo(heading, body)
+			continue
+		}
+
+		title := fmt.Sprintf("Step %d", p.step)
+		if heading != "" {
+			title += ": " + heading
+		}
+		metadata := map[string]string{"step": strconv.Itoa(p.step), "status": statusNotRun}
+		var policy *RunPolicy
+		for _, field := range strings.Fields(p.info) {
+			if group, ok := strings.CutPrefix(field, "group="); ok {
+				metadata["group"] = group
+			}
+			// Checked when the runbook was read
+			policyAttr(field, &policy)
+		}
+		blocks = append(blocks, Block{
+			Title:      title,
+			Content:    p.code,
+			Command:    p.code,
+			Type:       BlockTypeCommand,
+			Expanded:   true,
+			Metadata:   metadata,
+			Policy:     policy,
+			Assertions: p.assertions,
+		})
+	}
+
+	now := time.Now()
+	for i := range blocks {
+		blocks[i].ID = strconv.Itoa(i + 1)
+		blocks[i].Timestamp = now
+	}
+	return blocks
+}
+
+// render writes the runbook back out with the expectations of every step,
+// each step that ran followed by its exit code, time and output.
+func (rb *runbook) render(blocks []Block) string {
+	results := make(map[string]Block)
+	steps := make(map[string]Block)
+	for _, b := range blocks {
+		if step := b.Metadata["step"]; step != "" && b.Metadata["status"] != statusNotRun {
+			results[step] = b
+		}
+		if step := b.Metadata["step"]; step != "" {
+			steps[step] = b
+		}
+	}
+
+	var out strings.Builder
+	for _, p := range rb.parts {
+		if p.step == 0 {
+			out.WriteString(p.text)
+			continue
+		}
+
+		out.WriteString(p.indent + p.fence + p.lang + p.info + "\n")
+		for _, line := range strings.Split(p.code, "\n") {
+			out.WriteString(p.indent + line + "\n")
+		}
+		out.WriteString(p.indent + p.fence + "\n")
+
+		// Expectations added or cleared in the session replace the assert
+		// block the step had
+		assert := p.assert
+		if b, ok := steps[strconv.Itoa(p.step)]; ok && assertionsText(b.Assertions) != assertionsText(p.assertions) {
+			assert = ""
+			if len(b.Assertions) > 0 {
+				assert = fence("assert", assertionsText(b.Assertions))
+				if p.indent != "" {
+					assert = strings.ReplaceAll(assert, "\n", "\n"+p.indent)
+					assert = strings.TrimSuffix(assert, p.indent)
+				}
+			}
+		}
+		out.WriteString(assert)
+
+		b, ok := results[strconv.Itoa(p.step)]
+		if !ok {
+			continue
+		}
+		outcome := fmt.Sprintf("exit %d", b.ExitCode)
+		if len(b.Checks) > 0 && b.failed() {
+			outcome += ", " + b.failure()
+		}
+		fmt.Fprintf(&out, "\n%s<!-- gbloxs: %s, %s -->\n", p.indent, outcome, b.Timestamp.Format("2006-01-02 15:04:05"))
+		output := fence("output", b.Output)
+		if p.indent != "" {
+			output = strings.ReplaceAll(output, "\n", "\n"+p.indent)
+			output = strings.TrimSuffix(output, p.indent)
+		}
+		out.WriteString(strings.TrimPrefix(output, "\n"))
+	}
+	return out.String()
+}
+
+// isStep reports whether the block is a step of a runbook or notebook,
+// the blocks stepping and run all work on.
+func (b Block) isStep() bool {
+	return b.Metadata["step"] != "" && b.Command != ""
+}
+
+// stepSelected runs the selected block and moves on to the next step
+// that has not run, so pressing x repeatedly walks through a runbook.
+func (m *model) stepSelected() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) || m.blocks[m.selectedIdx].Command == "" {
+		return nil
+	}
+	block := m.blocks[m.selectedIdx]
+	if m.running(m.selectedIdx) {
+		state := "still running"
+		if block.Metadata["status"] == statusQueued {
+			state = "queued"
+		}
+		m.addInfoBlock(fmt.Sprintf("%s is %s", block.Title, state))
+		return nil
+	}
+	m.executeCommand(block.Command)
+
+	if !block.isStep() {
+		return nil
+	}
+	for i := m.selectedIdx + 1; i < len(m.blocks); i++ {
+		if m.blocks[i].isStep() && m.blocks[i].Metadata["status"] == statusNotRun {
+			m.selectBlock(i)
+			break
+		}
+	}
+	return nil
+}
+
+// saveRunbook writes the runbook back to its file with the results of the
+// steps that ran.
+func (m *model) saveRunbook() tea.Cmd {
+	if m.runbook == nil {
+		m.addInfoBlock("No runbook is open; start gbloxs with: gbloxs open runbook.md")
+		return nil
+	}
+	if err := os.WriteFile(m.runbook.path, []byte(m.runbook.render(m.blocks)), 0o644); err != nil {
+		m.addInfoBlock("Saving runbook failed: " + err.Error())
+		return nil
+	}
+	m.addInfoBlock("Runbook saved to " + m.runbook.path)
+	return nil
+}
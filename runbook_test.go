@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRunbook puts text in a runbook file of its own.
+func writeRunbook(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "runbook.md")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunbookRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "prose only",
+			text: "# Title\n\nNothing to run here.\n",
+		},
+		{
+			name: "steps and other code",
+			text: "# Deploy\n\nBuild first.\n\n```sh\nmake build\n```\n\n```go\nfmt.Println(\"not a step\")\n```\n\n## Ship\n\n```bash group=ship timeout=30s\nmake push\nmake tag\n```\n",
+		},
+		{
+			name: "indented and tilde fences",
+			text: "1. Check\n\n   ~~~shell\n   uptime\n   ~~~\n",
+		},
+		{
+			name: "assert block",
+			text: "```sh\necho ok\n```\n\n```assert\nexit 0\ncontains ok\n```\n\nDone.\n",
+		},
+		{
+			name: "unclosed fence",
+			text: "```sh\necho never closed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, blocks, err := loadRunbook(writeRunbook(t, tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rb.render(blocks)
+			// An unclosed fence is closed on the way out
+			want := tt.text
+			if tt.name == "unclosed fence" {
+				want += "```\n"
+			}
+			if got != want {
+				t.Errorf("render = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadRunbookSteps(t *testing.T) {
+	text := "# Setup\n\n```sh\napt update\n```\n\n```assert\nexit 0\n```\n\n## Build\n\n```sh group=build retries=2\nmake a\n```\n\n```zsh group=build\nmake b\n```\n"
+	_, blocks, err := loadRunbook(writeRunbook(t, text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []Block
+	for _, b := range blocks {
+		if b.isStep() {
+			steps = append(steps, b)
+		}
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+
+	tests := []struct {
+		title, command, group string
+		assertions            int
+		retries               int
+	}{
+		{title: "Step 1: Setup", command: "apt update", assertions: 1, retries: -2},
+		{title: "Step 2: Build", command: "make a", group: "build", retries: 2},
+		{title: "Step 3: Build", command: "make b", group: "build", retries: -2},
+	}
+	for i, tt := range tests {
+		b := steps[i]
+		if b.Title != tt.title || b.Command != tt.command || b.Metadata["group"] != tt.group {
+			t.Errorf("step %d = %q %q group %q, want %q %q group %q", i+1, b.Title, b.Command, b.Metadata["group"], tt.title, tt.command, tt.group)
+		}
+		if b.Metadata["status"] != statusNotRun {
+			t.Errorf("step %d status = %q, want %q", i+1, b.Metadata["status"], statusNotRun)
+		}
+		if len(b.Assertions) != tt.assertions {
+			t.Errorf("step %d has %d assertions, want %d", i+1, len(b.Assertions), tt.assertions)
+		}
+		// -2 stands for no policy of its own
+		retries := -2
+		if b.Policy != nil {
+			retries = b.Policy.Retries
+		}
+		if retries != tt.retries {
+			t.Errorf("step %d retries = %d, want %d", i+1, retries, tt.retries)
+		}
+	}
+}
+
+func TestRunbookResults(t *testing.T) {
+	text := "```sh\necho hi\n```\n\nAfter.\n"
+	path := writeRunbook(t, text)
+	rb, blocks, err := loadRunbook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range blocks {
+		if blocks[i].isStep() {
+			blocks[i].Metadata["status"] = "done"
+			blocks[i].ExitCode = 0
+			blocks[i].Output = "hi\n"
+			blocks[i].Timestamp = time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+		}
+	}
+	saved := rb.render(blocks)
+	want := "```sh\necho hi\n```\n\n<!-- gbloxs: exit 0, 2024-05-01 12:00:00 -->\n```output\nhi\n```\n\nAfter.\n"
+	if saved != want {
+		t.Fatalf("render = %q, want %q", saved, want)
+	}
+
+	// Loading the saved runbook drops the result again
+	if err := os.WriteFile(path, []byte(saved), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rb, blocks, err = loadRunbook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rb.render(blocks); got != text {
+		t.Errorf("render after reload = %q, want %q", got, text)
+	}
+}
+
+func TestLoadRunbookErrors(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{
+			name: "bad policy",
+			text: "intro\n\n```sh timeout=soon\nsleep 1\n```\n",
+			want: "runbook.md:3:",
+		},
+		{
+			name: "bad assertion",
+			text: "```sh\necho\n```\n\n```assert\nexit 0\nsometimes ok\n```\n",
+			want: "runbook.md:7:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := loadRunbook(writeRunbook(t, tt.text))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to name %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// What run all does when a step fails.
+const (
+	// failureStop starts no more steps and lets the running ones finish
+	failureStop = "stop"
+	// failureKill also stops the steps still running
+	failureKill = "kill"
+	// failureContinue runs the remaining steps anyway
+	failureContinue = "continue"
+)
+
+// statusQueued marks a block whose command waits for a free job slot.
+const statusQueued = "queued"
+
+// queuedCommand is a command waiting until fewer than jobs.max_parallel
+// commands run. Commands start in the order they were queued.
+type queuedCommand struct {
+	blockID string
+	command string
+	queued  time.Time
+	// status is the block's status before it was queued, restored when
+	// the command is taken off the queue without running
+	status string
+	// history is the input recorded in the history once the command ran,
+	// if any
+	history string
+	// attempt counts the runs of the command, from 1; a retry waits
+	// until notBefore
+	attempt   int
+	notBefore time.Time
+}
+
+// stepRun is a run of several steps, started by run all or by rerunning
+// the failed commands. Groups of steps run one after another; the steps
+// of a group run at the same time, as many as jobs.max_parallel allows.
+type stepRun struct {
+	groups [][]string // block IDs of the steps, by group
+	next   int        // the group to start next
+	// running are the steps of the current group that did not finish
+	running   map[string]bool
+	onFailure string
+	failed    []string // IDs of the steps that failed, in order
+	stopped   bool     // set once a failure stopped the run
+}
+
+// check reports settings that are out of range.
+func (c JobsConfig) check() []string {
+	var warnings []string
+	if c.MaxParallel < 0 {
+		warnings = append(warnings, fmt.Sprintf("jobs.max_parallel: %d is negative; use 0 for no limit", c.MaxParallel))
+	}
+	switch c.OnFailure {
+	case "", failureStop, failureKill, failureContinue:
+	default:
+		warnings = append(warnings, fmt.Sprintf("jobs.on_failure: %q is not stop, kill or continue", c.OnFailure))
+	}
+	for _, d := range []struct{ name, value string }{{"timeout", c.Timeout}, {"backoff", c.Backoff}} {
+		if v, err := time.ParseDuration(d.value); d.value != "" && (err != nil || v < 0) {
+			warnings = append(warnings, fmt.Sprintf("jobs.%s: %q is not a duration such as 30s", d.name, d.value))
+		}
+	}
+	if c.Retries < 0 {
+		warnings = append(warnings, fmt.Sprintf("jobs.retries: %d is negative", c.Retries))
+	}
+	return warnings
+}
+
+// policy is what run all does when a step fails.
+func (c JobsConfig) policy() string {
+	switch c.OnFailure {
+	case failureKill, failureContinue:
+		return c.OnFailure
+	}
+	return failureStop
+}
+
+// slotFree reports whether another command may start now.
+func (m model) slotFree() bool {
+	return m.config.Jobs.MaxParallel <= 0 || len(m.jobs) < m.config.Jobs.MaxParallel
+}
+
+// queuedIndex is the position of the block's command in the queue, or -1.
+func (m model) queuedIndex(blockID string) int {
+	for i, q := range m.queue {
+		if q.blockID == blockID {
+			return i
+		}
+	}
+	return -1
+}
+
+// enqueue puts the command of block at the end of the queue.
+func (m *model) enqueue(cmdStr string, block *Block) {
+	m.enqueueAttempt(queuedCommand{command: cmdStr, attempt: 1}, block)
+}
+
+// enqueueAttempt queues q, a first run or a retry, for block.
+func (m *model) enqueueAttempt(q queuedCommand, block *Block) {
+	if block.Metadata == nil {
+		block.Metadata = make(map[string]string)
+	}
+	q.blockID = block.ID
+	q.queued = time.Now()
+	q.status = block.Metadata["status"]
+	m.queue = append(m.queue, q)
+	block.Metadata["status"] = statusQueued
+}
+
+// due counts the queued commands that may start as soon as a job slot is
+// free, leaving out retries still waiting.
+func (m model) due() int {
+	n := 0
+	now := time.Now()
+	for _, q := range m.queue {
+		if !q.notBefore.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// unqueue takes the command at position i off the queue without running
+// it and returns it.
+func (m *model) unqueue(i int) queuedCommand {
+	q := m.queue[i]
+	m.queue = append(m.queue[:i], m.queue[i+1:]...)
+	if idx := m.blockIndex(q.blockID); idx >= 0 {
+		b := &m.blocks[idx]
+		if q.status == "" {
+			delete(b.Metadata, "status")
+		} else {
+			b.Metadata["status"] = q.status
+		}
+	}
+	return q
+}
+
+// startQueued starts queued commands while there are free job slots,
+// oldest first. Retries wait for their backoff to pass.
+func (m *model) startQueued() {
+	now := time.Now()
+	for i := 0; i < len(m.queue) && m.slotFree(); {
+		q := m.queue[i]
+		if q.notBefore.After(now) {
+			i++
+			continue
+		}
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+		idx := m.blockIndex(q.blockID)
+		if idx < 0 {
+			// The block was deleted while it waited
+			m.stepDone(q.blockID, false)
+			continue
+		}
+		m.launch(q.command, &m.blocks[idx], q.attempt)
+		if j, ok := m.jobs[q.blockID]; ok {
+			j.history = q.history
+		} else {
+			if q.history != "" {
+				m.recordHistory(q.history, m.blocks[idx].ExitCode)
+			}
+			m.stepFinished(q.blockID)
+		}
+	}
+}
+
+// dropQueued takes the command at position i off the queue for good. A
+// retry that is dropped leaves its block failed.
+func (m *model) dropQueued(i int) {
+	q := m.unqueue(i)
+	if q.attempt <= 1 {
+		m.stepDone(q.blockID, false)
+		return
+	}
+	if idx := m.blockIndex(q.blockID); idx >= 0 && q.history != "" {
+		m.recordHistory(q.history, m.blocks[idx].ExitCode)
+	}
+	m.stepFinished(q.blockID)
+}
+
+// queuedBadge tells that the block's command waits in the queue, or for
+// its next attempt.
+func (m model) queuedBadge(b Block) string {
+	i := m.queuedIndex(b.ID)
+	if i < 0 || m.queue[i].attempt <= 1 {
+		return "◌ queued"
+	}
+	q := m.queue[i]
+	badge := fmt.Sprintf("↻ attempt %d of %d", q.attempt, m.policyFor(b).Retries+1)
+	if wait := time.Until(q.notBefore); wait > 0 {
+		badge += " in " + shortDuration(wait)
+	}
+	return badge
+}
+
+// blockIndex is the index of the block with the ID, or -1.
+func (m model) blockIndex(id string) int {
+	for i := range m.blocks {
+		if m.blocks[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// runSteps runs every step from block index from on. Steps run in order,
+// each starting when the one before it finished, except that consecutive
+// steps of the same group run together. What happens when a step fails
+// follows jobs.on_failure.
+func (m *model) runSteps(from int) tea.Cmd {
+	return m.runStepsWith(from, m.config.Jobs.policy())
+}
+
+// runStepsWith is runSteps with the given failure policy.
+func (m *model) runStepsWith(from int, onFailure string) tea.Cmd {
+	var groups [][]string
+	prev := ""
+	for i := from; i < len(m.blocks); i++ {
+		b := m.blocks[i]
+		if !b.isStep() {
+			continue
+		}
+		group := b.Metadata["group"]
+		if group != "" && group == prev {
+			groups[len(groups)-1] = append(groups[len(groups)-1], b.ID)
+		} else {
+			groups = append(groups, []string{b.ID})
+		}
+		prev = group
+	}
+	if len(groups) == 0 {
+		m.addInfoBlock("There are no steps to run")
+		return nil
+	}
+	m.startRun(groups, onFailure)
+	return nil
+}
+
+// rerunFailed runs every failed command again, all as one group.
+func (m *model) rerunFailed() tea.Cmd {
+	var group []string
+	for _, b := range m.blocks {
+		if b.Type == BlockTypeError && b.Command != "" && !b.Notice {
+			group = append(group, b.ID)
+		}
+	}
+	if len(group) == 0 {
+		m.addInfoBlock("No commands failed")
+		return nil
+	}
+	m.startRun([][]string{group}, m.config.Jobs.policy())
+	return nil
+}
+
+// startRun starts running groups of steps, unless a run is going on.
+func (m *model) startRun(groups [][]string, onFailure string) {
+	if m.steps != nil {
+		m.addInfoBlock("Steps are still running; stop them from the jobs panel to start over")
+		return
+	}
+	m.steps = &stepRun{groups: groups, onFailure: onFailure}
+	m.nextGroup()
+}
+
+// nextGroup starts the next group of steps of the run. The first step of
+// the group is selected.
+func (m *model) nextGroup() {
+	run := m.steps
+	group := run.groups[run.next]
+	run.next++
+	run.running = make(map[string]bool)
+	for _, id := range group {
+		run.running[id] = true
+	}
+
+	selected := false
+	var done []string
+	for _, id := range group {
+		i := m.blockIndex(id)
+		if i < 0 {
+			m.stepDone(id, false)
+			continue
+		}
+		if !selected {
+			m.selectBlock(i)
+			selected = true
+		}
+		m.startCommand(m.blocks[i].Command, &m.blocks[i])
+		if !m.running(i) {
+			// It failed to start
+			done = append(done, id)
+		}
+	}
+	for _, id := range done {
+		m.stepFinished(id)
+	}
+}
+
+// stepFinished moves the run on once the step with the block ID is done,
+// failed when its exit code is not 0 or its expectations failed.
+func (m *model) stepFinished(id string) {
+	i := m.blockIndex(id)
+	m.stepDone(id, i >= 0 && m.blocks[i].failed())
+}
+
+// stepDone moves the run on once a step is done: after the last step of a
+// group the next group starts. A failed step stops the run unless its
+// policy is to continue.
+func (m *model) stepDone(id string, failed bool) {
+	run := m.steps
+	if run == nil || !run.running[id] {
+		return
+	}
+	delete(run.running, id)
+
+	if failed {
+		run.failed = append(run.failed, id)
+		if !run.stopped && run.onFailure != failureContinue {
+			run.stopped = true
+			for q := len(m.queue) - 1; q >= 0; q-- {
+				if run.running[m.queue[q].blockID] {
+					delete(run.running, m.unqueue(q).blockID)
+				}
+			}
+			if run.onFailure == failureKill {
+				for other := range run.running {
+					if j, ok := m.jobs[other]; ok {
+						m.killJob(j)
+					}
+				}
+			}
+		}
+	}
+
+	if len(run.running) > 0 {
+		return
+	}
+	if !run.stopped && run.next < len(run.groups) {
+		m.nextGroup()
+		return
+	}
+	m.steps = nil
+	// Steps with expectations are summed up after every run
+	m.summarizeExpectations()
+
+	if len(run.failed) == 0 {
+		return
+	}
+	first := m.blockIndex(run.failed[0])
+	if first < 0 {
+		return
+	}
+	b := m.blocks[first]
+	if run.stopped {
+		m.addInfoBlock(fmt.Sprintf("Stopped at %s: %s", b.Title, b.failure()))
+	} else {
+		m.addInfoBlock(fmt.Sprintf("%d steps failed, the first %s: %s", len(run.failed), b.Title, b.failure()))
+	}
+	m.selectBlock(first)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stepModel is a model with a step for each group name, "" for a step in
+// no group. The steps sleep until finishStep ends them.
+func stepModel(t *testing.T, groups []string, maxParallel int, onFailure string) *model {
+	t.Helper()
+	m := &model{
+		jobs: make(map[string]*job),
+		// Room for every command, so none waits to report that it exited
+		jobDone: make(chan jobDoneMsg, len(groups)),
+		config:  Config{Jobs: JobsConfig{MaxParallel: maxParallel, OnFailure: onFailure}},
+	}
+	for i, group := range groups {
+		id := string(rune('1' + i))
+		m.blocks = append(m.blocks, Block{
+			ID:       id,
+			Title:    "step " + id,
+			Command:  "sleep 30",
+			Metadata: map[string]string{"step": id, "group": group, "status": statusNotRun},
+		})
+	}
+	m.lastID = len(groups)
+	t.Cleanup(m.stopJobs)
+	return m
+}
+
+// finishStep ends the command of the step with the ID, as if it exited
+// with status 0 or, when failed, 1.
+func finishStep(t *testing.T, m *model, id string, failed bool) {
+	t.Helper()
+	j, ok := m.jobs[id]
+	if !ok {
+		t.Fatalf("step %s is not running", id)
+	}
+	signalGroup(j.cmd, true)
+	var err error
+	if failed {
+		err = errors.New("exit status 1")
+	}
+	m.finishJob(jobDoneMsg{blockID: id, err: err})
+}
+
+// schedulerState is what the scheduler is doing: the steps with a
+// running command, the queue in order, the steps of the current group
+// that did not finish, and those that failed.
+type schedulerState struct {
+	jobs, queue, running, failed []string
+}
+
+func stateOf(m *model, run *stepRun) schedulerState {
+	var s schedulerState
+	for id := range m.jobs {
+		s.jobs = append(s.jobs, id)
+	}
+	slices.Sort(s.jobs)
+	for _, q := range m.queue {
+		s.queue = append(s.queue, q.blockID)
+	}
+	if m.steps != nil {
+		for id := range m.steps.running {
+			s.running = append(s.running, id)
+		}
+		slices.Sort(s.running)
+	}
+	s.failed = run.failed
+	return s
+}
+
+func TestRunStepsGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		want   [][]string
+	}{
+		{name: "no groups", groups: []string{"", "", ""}, want: [][]string{{"1"}, {"2"}, {"3"}}},
+		{name: "consecutive", groups: []string{"", "x", "x", ""}, want: [][]string{{"1"}, {"2", "3"}, {"4"}}},
+		{name: "interrupted", groups: []string{"x", "y", "x"}, want: [][]string{{"1"}, {"2"}, {"3"}}},
+		{name: "one after another", groups: []string{"x", "x", "y", "y"}, want: [][]string{{"1", "2"}, {"3", "4"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := stepModel(t, tt.groups, 0, "")
+			// Blocks that are no steps are left out
+			m.blocks = append(m.blocks, Block{ID: "9", Command: "true", Metadata: map[string]string{"group": "x"}})
+			m.runSteps(0)
+			if m.steps == nil {
+				t.Fatal("no run started")
+			}
+			if !reflect.DeepEqual(m.steps.groups, tt.want) {
+				t.Errorf("groups = %q, want %q", m.steps.groups, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepRun(t *testing.T) {
+	type finish struct {
+		id     string
+		failed bool
+		want   schedulerState
+	}
+	tests := []struct {
+		name        string
+		groups      []string
+		maxParallel int
+		onFailure   string
+		start       schedulerState
+		finishes    []finish
+		// info is the start of the block telling how the run ended
+		info string
+	}{
+		{
+			name:   "groups in order",
+			groups: []string{"", "x", "x", ""},
+			start:  schedulerState{jobs: []string{"1"}, running: []string{"1"}},
+			finishes: []finish{
+				{id: "1", want: schedulerState{jobs: []string{"2", "3"}, running: []string{"2", "3"}}},
+				{id: "3", want: schedulerState{jobs: []string{"2"}, running: []string{"2"}}},
+				{id: "2", want: schedulerState{jobs: []string{"4"}, running: []string{"4"}}},
+				{id: "4", want: schedulerState{}},
+			},
+		},
+		{
+			name:        "max_parallel queues the rest in order",
+			groups:      []string{"x", "x", "x", "x"},
+			maxParallel: 2,
+			start:       schedulerState{jobs: []string{"1", "2"}, queue: []string{"3", "4"}, running: []string{"1", "2", "3", "4"}},
+			finishes: []finish{
+				{id: "2", want: schedulerState{jobs: []string{"1", "3"}, queue: []string{"4"}, running: []string{"1", "3", "4"}}},
+				{id: "1", want: schedulerState{jobs: []string{"3", "4"}, running: []string{"3", "4"}}},
+				{id: "4", want: schedulerState{jobs: []string{"3"}, running: []string{"3"}}},
+				{id: "3", want: schedulerState{}},
+			},
+		},
+		{
+			name:        "stop lets running steps finish",
+			groups:      []string{"x", "x", "x", ""},
+			maxParallel: 2,
+			onFailure:   failureStop,
+			start:       schedulerState{jobs: []string{"1", "2"}, queue: []string{"3"}, running: []string{"1", "2", "3"}},
+			finishes: []finish{
+				{id: "1", failed: true, want: schedulerState{jobs: []string{"2"}, running: []string{"2"}, failed: []string{"1"}}},
+				{id: "2", want: schedulerState{failed: []string{"1"}}},
+			},
+			info: "Stopped at step 1",
+		},
+		{
+			name:      "kill stops running steps",
+			groups:    []string{"x", "x", ""},
+			onFailure: failureKill,
+			start:     schedulerState{jobs: []string{"1", "2"}, running: []string{"1", "2"}},
+			finishes: []finish{
+				{id: "2", failed: true, want: schedulerState{jobs: []string{"1"}, running: []string{"1"}, failed: []string{"2"}}},
+				{id: "1", failed: true, want: schedulerState{failed: []string{"2", "1"}}},
+			},
+			info: "Stopped at step 2",
+		},
+		{
+			name:      "continue runs the remaining steps",
+			groups:    []string{"", "", ""},
+			onFailure: failureContinue,
+			start:     schedulerState{jobs: []string{"1"}, running: []string{"1"}},
+			finishes: []finish{
+				{id: "1", failed: true, want: schedulerState{jobs: []string{"2"}, running: []string{"2"}, failed: []string{"1"}}},
+				{id: "2", want: schedulerState{jobs: []string{"3"}, running: []string{"3"}, failed: []string{"1"}}},
+				{id: "3", failed: true, want: schedulerState{failed: []string{"1", "3"}}},
+			},
+			info: "2 steps failed, the first step 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := stepModel(t, tt.groups, tt.maxParallel, tt.onFailure)
+			m.runSteps(0)
+			run := m.steps
+			if got := stateOf(m, run); !reflect.DeepEqual(got, tt.start) {
+				t.Fatalf("at the start: %+v, want %+v", got, tt.start)
+			}
+			for _, q := range m.queue {
+				if b := m.blocks[m.blockIndex(q.blockID)]; b.Metadata["status"] != statusQueued {
+					t.Errorf("queued step %s has status %q", b.ID, b.Metadata["status"])
+				}
+			}
+
+			for _, f := range tt.finishes {
+				if tt.onFailure == failureKill && len(run.failed) > 0 && !m.jobs[f.id].stopping {
+					t.Errorf("step %s was not stopped", f.id)
+				}
+				finishStep(t, m, f.id, f.failed)
+				if got := stateOf(m, run); !reflect.DeepEqual(got, f.want) {
+					t.Fatalf("after %s finished: %+v, want %+v", f.id, got, f.want)
+				}
+			}
+			if m.steps != nil {
+				t.Fatal("the run did not end")
+			}
+
+			// Steps that never ran are as they were
+			for _, b := range m.blocks {
+				if b.isStep() && b.IsLoading {
+					t.Errorf("step %s is still loading", b.ID)
+				}
+				if b.isStep() && b.Attempts == nil && b.Metadata["status"] != statusNotRun {
+					t.Errorf("step %s that did not run has status %q", b.ID, b.Metadata["status"])
+				}
+			}
+			last := m.blocks[len(m.blocks)-1]
+			if tt.info == "" {
+				if last.Notice {
+					t.Errorf("unexpected %q", last.Content)
+				}
+			} else if !strings.HasPrefix(last.Content, tt.info) {
+				t.Errorf("the run ended with %q, want %q", last.Content, tt.info)
+			}
+		})
+	}
+}
+
+func TestStartRunWhileRunning(t *testing.T) {
+	m := stepModel(t, []string{""}, 0, "")
+	m.runSteps(0)
+	run := m.steps
+	m.runSteps(0)
+	if m.steps != run || !strings.HasPrefix(m.blocks[len(m.blocks)-1].Content, "Steps are still running") {
+		t.Error("a second run started")
+	}
+}
+
+func TestUnqueueRestoresStatus(t *testing.T) {
+	m := stepModel(t, []string{"", ""}, 1, "")
+	delete(m.blocks[1].Metadata, "status")
+	m.startCommand("sleep 30", &m.blocks[0])
+	m.startCommand("true", &m.blocks[1])
+	if m.queuedIndex("2") != 0 || m.blocks[1].Metadata["status"] != statusQueued {
+		t.Fatalf("second command not queued: %+v", m.queue)
+	}
+
+	m.unqueue(0)
+	if len(m.queue) != 0 {
+		t.Errorf("queue = %+v", m.queue)
+	}
+	if status, ok := m.blocks[1].Metadata["status"]; ok {
+		t.Errorf("status %q left on a block that had none", status)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultKeepSessions is how many saved sessions are kept by default.
+const defaultKeepSessions = 100
+
+// Sessions in which commands ran are saved as notebooks in the state
+// directory when gbloxs exits, for gbloxs ls, export and replay.
+func sessionsDir() string {
+	return filepath.Join(stateDir(), "sessions")
+}
+
+// sessionInfo describes a saved session for gbloxs ls.
+type sessionInfo struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Time     time.Time `json:"time"`
+	Blocks   int       `json:"blocks"`
+	Commands int       `json:"commands"`
+	Failed   int       `json:"failed"`
+	First    string    `json:"first_command,omitempty"`
+}
+
+// saveSession writes the session if a command ran in it since started and
+// drops the oldest sessions beyond the configured number.
+func saveSession(m model, started time.Time) (string, error) {
+	cfg := m.config.Sessions
+	if cfg.Disabled {
+		return "", nil
+	}
+
+	ran := false
+	for _, b := range m.blocks {
+		if b.Command != "" && !b.Notice && b.Timestamp.After(started) && (b.Type == BlockTypeSuccess || b.Type == BlockTypeError) {
+			ran = true
+			break
+		}
+	}
+	if !ran {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(sessionsDir(), 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(sessionsDir(), started.Format("2006-01-02_150405")+notebookExt)
+	if err := os.WriteFile(path, []byte(renderNotebook(m.blocks)), 0o644); err != nil {
+		return "", err
+	}
+
+	keep := cfg.Keep
+	if keep <= 0 {
+		keep = defaultKeepSessions
+	}
+	if sessions, err := listSessions(); err == nil {
+		for _, s := range sessions[min(keep, len(sessions)):] {
+			os.Remove(s.Path)
+		}
+	}
+	return path, nil
+}
+
+// listSessions returns the saved sessions, newest first.
+func listSessions() ([]sessionInfo, error) {
+	files, err := filepath.Glob(filepath.Join(sessionsDir(), "*"+notebookExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []sessionInfo
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		s := sessionInfo{
+			Name: strings.TrimSuffix(filepath.Base(path), notebookExt),
+			Path: path,
+			Time: info.ModTime(),
+		}
+		if _, blocks, err := loadNotebook(path); err == nil {
+			s.Blocks = len(blocks)
+			for _, b := range blocks {
+				if b.Command == "" {
+					continue
+				}
+				s.Commands++
+				if b.ExitCode != 0 {
+					s.Failed++
+				}
+				if s.First == "" {
+					s.First = b.Command
+				}
+			}
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name > sessions[j].Name
+	})
+	return sessions, nil
+}
+
+// findSession resolves a session argument: a file, the name of a saved
+// session, or "last" for the newest.
+func findSession(name string) (string, error) {
+	if info, err := os.Stat(name); err == nil && !info.IsDir() {
+		return name, nil
+	}
+	if name == "last" {
+		sessions, err := listSessions()
+		if err != nil {
+			return "", err
+		}
+		if len(sessions) == 0 {
+			return "", errors.New("no saved sessions")
+		}
+		return sessions[0].Path, nil
+	}
+
+	path := filepath.Join(sessionsDir(), strings.TrimSuffix(name, notebookExt)+notebookExt)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("no session %q; gbloxs ls lists them", name)
+	}
+	return path, nil
+}
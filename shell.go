@@ -0,0 +1,388 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// gbloxs shell runs the user's own shell in a pseudo terminal, with its
+// prompt and rc files, and splits the session into blocks using the OSC
+// 133 semantic prompt markers its integration script prints:
+//
+//	ESC ] 133 ; A BEL                      the prompt starts
+//	ESC ] 133 ; B BEL                      the prompt ends, typing starts
+//	ESC ] 133 ; C ; cmdline_url=... BEL    the command runs
+//	ESC ] 133 ; D ; exit BEL               the command finished
+//
+// OSC 7 reports the shell's working directory.
+
+//go:embed shell/gbloxs.bash shell/gbloxs.zsh shell/gbloxs.fish
+var shellScripts embed.FS
+
+// shellPhase is where the shell is between markers.
+type shellPhase int
+
+const (
+	shellStarting shellPhase = iota
+	shellPrompt
+	shellTyping
+	shellRunning
+)
+
+// shellSession is the hosted shell. It is shared by every copy of the
+// model; only Update touches it.
+type shellSession struct {
+	name string
+	pty  ptyConsole
+	cmd  *exec.Cmd
+
+	parser vtParser
+	// prompt holds the prompt and the command line being typed, output
+	// holds what the running command printed
+	prompt *vtScreen
+	output *vtScreen
+	phase  shellPhase
+	// typedRow and typedCol are where typing starts on the prompt screen
+	typedRow, typedCol int
+	// blockID is the block of the running command
+	blockID string
+	// integrated is set once the shell has sent a marker
+	integrated bool
+	// changed is set when the running command printed something its block
+	// does not show yet
+	changed bool
+
+	m *model // the model being updated while output is fed
+}
+
+// shellOutputMsg is data the shell wrote to the terminal.
+type shellOutputMsg []byte
+
+// shellExitMsg reports that the shell exited.
+type shellExitMsg struct{ err error }
+
+// startShell starts path, or $SHELL, in a pseudo terminal.
+func startShell(path string, cwd string) (*shellSession, error) {
+	if path == "" {
+		path = os.Getenv("SHELL")
+	}
+	if path == "" {
+		path = "/bin/sh"
+	}
+
+	cmd := exec.Command(path, "-i")
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), "GBLOXS_SHELL=1", "TERM=xterm")
+	pty, err := startPTY(cmd, 80, 24)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shellSession{
+		name:   filepath.Base(path),
+		pty:    pty,
+		cmd:    cmd,
+		prompt: newVTScreen(80),
+		output: newVTScreen(80),
+	}
+	s.parser.handle = s
+	return s, nil
+}
+
+// readShell sends the shell's output to the program until it exits.
+func readShell(p *tea.Program, s *shellSession) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			p.Send(shellOutputMsg(append([]byte(nil), buf[:n]...)))
+		}
+		if err != nil {
+			break
+		}
+	}
+	p.Send(shellExitMsg{err: s.cmd.Wait()})
+}
+
+// close hangs up the terminal, which ends the shell.
+func (s *shellSession) close() {
+	s.pty.Close()
+}
+
+func (s *shellSession) resize(cols, rows int) {
+	cols = max(cols, 20)
+	s.prompt.width, s.output.width = cols, cols
+	s.pty.resize(cols, max(rows, 5))
+}
+
+// screen is where text goes in the current phase.
+func (s *shellSession) screen() *vtScreen {
+	if s.phase == shellRunning {
+		return s.output
+	}
+	return s.prompt
+}
+
+func (s *shellSession) print(r rune)   { s.screen().print(r) }
+func (s *shellSession) control(b byte) { s.screen().control(b) }
+func (s *shellSession) csi(final byte, private bool, params []int) {
+	s.screen().csi(final, private, params)
+}
+
+func (s *shellSession) osc(data string) {
+	code, rest, _ := strings.Cut(data, ";")
+	switch code {
+	case "133":
+		s.integrated = true
+		mark, params, _ := strings.Cut(rest, ";")
+		s.mark(mark, params)
+	case "7":
+		if u, err := url.Parse(rest); err == nil && u.Scheme == "file" && u.Path != "" {
+			s.m.cwd = u.Path
+		}
+	}
+}
+
+// mark moves the session on at a semantic prompt marker.
+func (s *shellSession) mark(mark, params string) {
+	m := s.m
+	switch mark {
+	case "A":
+		s.finish(-1)
+		s.prompt.reset()
+		s.phase = shellPrompt
+
+	case "B":
+		s.typedRow, s.typedCol = s.prompt.row, s.prompt.col
+		s.phase = shellTyping
+
+	case "C":
+		command := s.prompt.textFrom(s.typedRow, s.typedCol)
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(param, "cmdline_url="); ok {
+				if decoded, err := url.PathUnescape(v); err == nil {
+					command = decoded
+				}
+			}
+		}
+		s.output.reset()
+		s.phase = shellRunning
+
+		title := command
+		if first, _, multi := strings.Cut(title, "\n"); multi {
+			title = first + " …"
+		}
+		block := Block{
+			ID:        m.newBlockID(),
+			Title:     title,
+			Content:   command,
+			Command:   command,
+			Type:      BlockTypeCommand,
+			Expanded:  true,
+			IsLoading: true,
+			Timestamp: time.Now(),
+			Metadata:  map[string]string{"shell": s.name, "executing": "true"},
+			Viewport:  viewport.New(m.width-10, 10),
+		}
+		m.blocks = append(m.blocks, block)
+		m.selectBlock(len(m.blocks) - 1)
+		s.blockID = block.ID
+
+	case "D":
+		code, _, _ := strings.Cut(params, ";")
+		exit, err := strconv.Atoi(code)
+		if err != nil {
+			exit = -1
+		}
+		s.finish(exit)
+		s.phase = shellPrompt
+	}
+}
+
+// finish completes the running command's block. An exit code below zero
+// means the shell did not say how it ended.
+func (s *shellSession) finish(exit int) {
+	if s.blockID == "" {
+		return
+	}
+	for i := range s.m.blocks {
+		b := &s.m.blocks[i]
+		if b.ID != s.blockID {
+			continue
+		}
+		setOutput(b, s.output.text())
+		b.IsLoading = false
+		delete(b.Metadata, "executing")
+		b.ExitCode = max(exit, 0)
+		b.Type = BlockTypeSuccess
+		if exit > 0 {
+			b.Type = BlockTypeError
+			b.Error = fmt.Sprintf("exit status %d", exit)
+		}
+	}
+	s.blockID = ""
+}
+
+// feedShell runs the shell's output through the terminal emulation. The
+// running command's block shows it on the next tick.
+func (m *model) feedShell(data []byte) {
+	s := m.shell
+	s.m = m
+	s.parser.feed(data)
+	s.m = nil
+	s.changed = s.blockID != ""
+}
+
+// flushShell shows what the running command printed so far in its block.
+func (m *model) flushShell() {
+	s := m.shell
+	if s == nil || !s.changed {
+		return
+	}
+	s.changed = false
+	if i := m.blockIndex(s.blockID); i >= 0 {
+		setOutput(&m.blocks[i], s.output.text())
+	}
+}
+
+// shellExited leaves shell mode once the shell is gone.
+func (m *model) shellExited(msg shellExitMsg) {
+	m.shell.m = m
+	m.shell.finish(-1)
+	m.shell = nil
+	m.closeInput()
+	text := "The shell exited"
+	if msg.err != nil {
+		text += ": " + msg.err.Error()
+	}
+	m.addInfoBlock(text)
+}
+
+// updateShell sends keys to the shell while input mode is on.
+func (m *model) updateShell(msg tea.KeyMsg) tea.Cmd {
+	if key := keyBytes(msg); key != nil {
+		m.shell.pty.Write(key)
+	}
+	return nil
+}
+
+// keyBytes is what a terminal sends for a key.
+func keyBytes(msg tea.KeyMsg) []byte {
+	var b []byte
+	if msg.Alt {
+		b = append(b, 0x1b)
+	}
+
+	switch {
+	case msg.Type == tea.KeyRunes:
+		b = append(b, string(msg.Runes)...)
+	case msg.Type == tea.KeySpace:
+		b = append(b, ' ')
+	case msg.Type >= 0 && msg.Type < 0x20 || msg.Type == tea.KeyBackspace:
+		// Control keys are their control character
+		b = append(b, byte(msg.Type))
+	default:
+		seq, ok := keySequences[msg.Type]
+		if !ok {
+			return nil
+		}
+		b = append(b, seq...)
+	}
+	return b
+}
+
+var keySequences = map[tea.KeyType]string{
+	tea.KeyUp:        "\x1b[A",
+	tea.KeyDown:      "\x1b[B",
+	tea.KeyRight:     "\x1b[C",
+	tea.KeyLeft:      "\x1b[D",
+	tea.KeyHome:      "\x1b[H",
+	tea.KeyEnd:       "\x1b[F",
+	tea.KeyShiftTab:  "\x1b[Z",
+	tea.KeyDelete:    "\x1b[3~",
+	tea.KeyPgUp:      "\x1b[5~",
+	tea.KeyPgDown:    "\x1b[6~",
+	tea.KeyCtrlLeft:  "\x1b[1;5D",
+	tea.KeyCtrlRight: "\x1b[1;5C",
+}
+
+// renderShell draws the shell's current line for the input area: the
+// prompt and what is being typed, or the running command's last line, so
+// that questions such as password prompts can be answered.
+func (m model) renderShell() string {
+	s := m.shell
+	screen := s.screen()
+
+	first := 0
+	if s.phase != shellRunning {
+		first = max(screen.row-2, 0)
+	} else {
+		first = screen.row
+	}
+
+	var b strings.Builder
+	for row := first; row <= screen.row; row++ {
+		var line []rune
+		if row < len(screen.lines) {
+			line = screen.lines[row]
+		}
+		if row > first {
+			b.WriteString("\n")
+		}
+		if row != screen.row {
+			b.WriteString(string(line))
+			continue
+		}
+		col := min(screen.col, len(line))
+		b.WriteString(string(line[:col]))
+		cursor := " "
+		if col < len(line) {
+			cursor = string(line[col])
+		}
+		b.WriteString(m.styles.Cursor.Render(cursor))
+		if col+1 < len(line) {
+			b.WriteString(string(line[col+1:]))
+		}
+	}
+	return b.String()
+}
+
+// shellTitle is the title of the input area in shell mode.
+func (m model) shellTitle() string {
+	leave := m.keys.LeaveShell.Help().Key
+	switch {
+	case !m.shell.integrated:
+		return fmt.Sprintf("%s (no prompt markers yet: load `gbloxs shell-integration %s` in its rc file; %s to leave)",
+			m.shell.name, m.shell.name, leave)
+	case m.shell.phase == shellRunning:
+		return fmt.Sprintf("%s: running, keys go to the command (%s to leave)", m.shell.name, leave)
+	default:
+		return fmt.Sprintf("%s (%s to leave)", m.shell.name, leave)
+	}
+}
+
+// printShellIntegration is gbloxs shell-integration SHELL.
+func printShellIntegration(shell string) int {
+	data, err := shellScripts.ReadFile("shell/gbloxs." + shell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "usage: gbloxs shell-integration bash|zsh|fish")
+		return 2
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+// shellInput reports whether keys go to the hosted shell.
+func (m model) shellInput() bool {
+	return m.shell != nil && m.inputMode && !m.multiline && m.pipeFrom == "" && m.expectFor == ""
+}
@@ -0,0 +1,50 @@
+# gbloxs shell integration for bash 4.4 and later.
+#
+# Marks prompts and commands with OSC 133 so that gbloxs shell can turn
+# every command into a block. Install it with
+#
+#   eval "$(gbloxs shell-integration bash)"
+#
+# at the end of ~/.bashrc. Outside gbloxs it does nothing.
+
+if [[ -n "$GBLOXS_SHELL" && -z "$__gbloxs_loaded" ]]; then
+    __gbloxs_loaded=1
+
+    __gbloxs_urlencode() {
+        local LC_ALL=C s="$1" out="" c i
+        for ((i = 0; i < ${#s}; i++)); do
+            c=${s:i:1}
+            case "$c" in
+                [a-zA-Z0-9.~_/-]) out+="$c" ;;
+                *) printf -v c '%%%02X' "'$c"; out+="$c" ;;
+            esac
+        done
+        printf '%s' "$out"
+    }
+
+    # Runs in a subshell from PS0, after a command is read and before it
+    # runs, when history already has it.
+    __gbloxs_preexec() {
+        local cmd
+        cmd=$(HISTTIMEFORMAT= builtin history 1)
+        cmd=${cmd#*[0-9][* ]}
+        cmd=${cmd#"${cmd%%[![:space:]]*}"}
+        printf '\e]133;C;cmdline_url=%s\a' "$(__gbloxs_urlencode "$cmd")"
+    }
+
+    __gbloxs_precmd() {
+        local status=$?
+        printf '\e]133;D;%s\a\e]7;file://%s%s\a' "$status" "$HOSTNAME" "$(__gbloxs_urlencode "$PWD")"
+        return $status
+    }
+
+    # Wraps the prompt last, after anything else that sets PS1.
+    __gbloxs_prompt() {
+        if [[ "$PS1" != *'133;A'* ]]; then
+            PS1='\[\e]133;A\a\]'"$PS1"'\[\e]133;B\a\]'
+        fi
+    }
+
+    PS0='$(__gbloxs_preexec)'"$PS0"
+    PROMPT_COMMAND="__gbloxs_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND};__gbloxs_prompt"
+fi
@@ -0,0 +1,37 @@
+# gbloxs shell integration for fish 3.
+#
+# Marks prompts and commands with OSC 133 so that gbloxs shell can turn
+# every command into a block. Install it with
+#
+#   gbloxs shell-integration fish | source
+#
+# at the end of ~/.config/fish/config.fish. Outside gbloxs it does nothing.
+
+if set -q GBLOXS_SHELL; and not set -q __gbloxs_loaded
+    set -g __gbloxs_loaded 1
+
+    function __gbloxs_preexec --on-event fish_preexec
+        set -g __gbloxs_running 1
+        printf '\e]133;C;cmdline_url=%s\a' (string escape --style=url -- $argv[1])
+    end
+
+    function __gbloxs_postexec --on-event fish_postexec
+        set -l exit_status $status
+        if set -q __gbloxs_running
+            printf '\e]133;D;%s\a' $exit_status
+            set -e __gbloxs_running
+        end
+    end
+
+    function __gbloxs_cwd --on-variable PWD
+        printf '\e]7;file://%s%s\a' $hostname (string escape --style=url -- $PWD)
+    end
+    __gbloxs_cwd
+
+    functions -c fish_prompt __gbloxs_fish_prompt
+    function fish_prompt
+        printf '\e]133;A\a'
+        __gbloxs_fish_prompt
+        printf '\e]133;B\a'
+    end
+end
@@ -0,0 +1,46 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/containerd/console"
+)
+
+// ptyConsole is the controlling side of a pseudo terminal.
+type ptyConsole struct {
+	console.Console
+}
+
+func (p ptyConsole) resize(cols, rows int) error {
+	return p.Resize(console.WinSize{Width: uint16(cols), Height: uint16(rows)})
+}
+
+// startPTY starts cmd as a session leader with a new pseudo terminal as
+// its controlling terminal.
+func startPTY(cmd *exec.Cmd, cols, rows int) (ptyConsole, error) {
+	master, slavePath, err := console.NewPty()
+	if err != nil {
+		return ptyConsole{}, err
+	}
+	pty := ptyConsole{master}
+	pty.resize(cols, rows)
+
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return ptyConsole{}, err
+	}
+	defer slave.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return ptyConsole{}, err
+	}
+	return pty, nil
+}
@@ -0,0 +1,22 @@
+//go:build !(darwin || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// ptyConsole is the controlling side of a pseudo terminal.
+type ptyConsole struct {
+	io.ReadWriteCloser
+}
+
+func (p ptyConsole) resize(cols, rows int) error {
+	return nil
+}
+
+func startPTY(cmd *exec.Cmd, cols, rows int) (ptyConsole, error) {
+	return ptyConsole{}, errors.New("hosting a shell is not supported on this system")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The status bar above the key hints is laid out like a prompt: the left
+// and right formats name segments in braces, such as "{cwd} {git}", and
+// segments with nothing to show drop out along with their spacing.
+const (
+	defaultStatusLeft  = "{cwd} {git}"
+	defaultStatusRight = "{running} {queued} {failed} {alerts} {unseen} {workspace} {clock}"
+	defaultClockFormat = "15:04"
+)
+
+// gitRefreshInterval is how often the git segment rereads the repository.
+const gitRefreshInterval = 2 * time.Second
+
+// statusSegments are the segments a status bar format can name.
+var statusSegments = map[string]bool{
+	"cwd": true, "git": true, "running": true, "queued": true, "failed": true,
+	"alerts": true, "unseen": true, "workspace": true, "clock": true,
+}
+
+var segmentRef = regexp.MustCompile(`\{(\w+)\}`)
+
+// gitInfoMsg carries what was read from the repository of dir.
+type gitInfoMsg struct {
+	dir  string
+	info gitInfo
+}
+
+// gitRefreshMsg asks for the repository to be read again.
+type gitRefreshMsg struct{}
+
+// formats are the left and right formats, defaults filled in.
+func (c StatusBarConfig) formats() (string, string) {
+	left, right := c.Left, c.Right
+	if left == "" && right == "" {
+		left, right = defaultStatusLeft, defaultStatusRight
+	}
+	return left, right
+}
+
+// check lists segment names in the formats that do not exist.
+func (c StatusBarConfig) check() []string {
+	var warnings []string
+	left, right := c.formats()
+	for _, ref := range segmentRef.FindAllStringSubmatch(left+" "+right, -1) {
+		if !statusSegments[ref[1]] {
+			warnings = append(warnings, fmt.Sprintf("status_bar: unknown segment {%s}", ref[1]))
+		}
+	}
+	return warnings
+}
+
+// showsGit reports whether the status bar has the git segment, which is
+// the one that reads files in the background.
+func (c StatusBarConfig) showsGit() bool {
+	left, right := c.formats()
+	return !c.Disabled && strings.Contains(left+right, "{git}")
+}
+
+// readGit reads the repository of dir in the background.
+func readGit(dir string) tea.Cmd {
+	return func() tea.Msg {
+		return gitInfoMsg{dir: dir, info: readGitInfo(dir)}
+	}
+}
+
+// updateGit keeps the git segment current: it rereads the repository of
+// the session's directory every few seconds.
+func (m *model) updateGit(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case gitInfoMsg:
+		if msg.dir == m.cwd {
+			m.git = msg.info
+		}
+		return tea.Tick(gitRefreshInterval, func(time.Time) tea.Msg { return gitRefreshMsg{} })
+	case gitRefreshMsg:
+		return readGit(m.cwd)
+	}
+	return nil
+}
+
+// segment renders one status bar segment, or "" when it has nothing to
+// show.
+func (m model) segment(name string) string {
+	style := func(color string) lipgloss.Style {
+		if c, ok := m.config.StatusBar.Colors[name]; ok {
+			color = c
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(color))
+	}
+
+	switch name {
+	case "cwd":
+		return style(m.theme.Highlight.Directory).Render(shortPath(m.cwd))
+
+	case "git":
+		if m.git.branch == "" {
+			return ""
+		}
+		text := style(m.theme.Accent).Render("⎇ " + m.git.branch)
+		if m.git.dirty {
+			text += lipgloss.NewStyle().Foreground(lipgloss.Color(m.theme.Error)).Render("*")
+		}
+		return text
+
+	case "running":
+		n := 0
+		for _, b := range m.blocks {
+			if b.Metadata["executing"] != "" {
+				n++
+			}
+		}
+		if n == 0 {
+			return ""
+		}
+		return style(m.theme.Command).Render(fmt.Sprintf("%s %d running", m.spinner.View(), n))
+
+	case "queued":
+		if len(m.queue) == 0 {
+			return ""
+		}
+		return style(m.theme.Muted).Render(fmt.Sprintf("◌ %d queued", len(m.queue)))
+
+	case "failed":
+		n := 0
+		for _, b := range m.blocks {
+			if b.Type == BlockTypeError && b.Command != "" {
+				n++
+			}
+		}
+		if n == 0 {
+			return ""
+		}
+		return style(m.theme.Error).Render(fmt.Sprintf("✗ %d failed", n))
+
+	case "alerts":
+		if n := m.unreadAlerts(); n > 0 {
+			return style(m.theme.Command).Render(fmt.Sprintf("⚠ %d alerts", n))
+		}
+		return ""
+
+	case "unseen":
+		if n := m.unseen(); n > 0 {
+			return style(m.theme.Success).Render(fmt.Sprintf("● %d unseen", n))
+		}
+		return ""
+
+	case "workspace":
+		// gbloxs has no workspaces of its own; the open runbook or notebook
+		// is what the session works on
+		path := ""
+		switch {
+		case m.runbook != nil:
+			path = m.runbook.path
+		case m.notebook != nil:
+			path = m.notebook.path
+		}
+		if path == "" {
+			return ""
+		}
+		return style(m.theme.Title).Render(filepath.Base(path))
+
+	case "clock":
+		format := m.config.StatusBar.Clock
+		if format == "" {
+			format = defaultClockFormat
+		}
+		return style(m.theme.Muted).Render(time.Now().Format(format))
+	}
+	return ""
+}
+
+// renderFormat fills a status bar format with its segments, dropping
+// the spacing around segments that are empty.
+func (m model) renderFormat(format string) string {
+	var parts []string
+	for _, field := range strings.Fields(format) {
+		text := segmentRef.ReplaceAllStringFunc(field, func(ref string) string {
+			return m.segment(strings.Trim(ref, "{}"))
+		})
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderStatusBar renders the status bar across the full width, or ""
+// when it is turned off.
+func (m model) renderStatusBar() string {
+	if m.config.StatusBar.Disabled {
+		return ""
+	}
+	leftFormat, rightFormat := m.config.StatusBar.formats()
+	left := m.renderFormat(leftFormat)
+	right := m.renderFormat(rightFormat)
+
+	width := m.width - 2
+	gap := width - lipgloss.Width(left) - lipgloss.Width(right)
+	if gap < 1 {
+		// Narrow terminals keep the left side
+		return " " + lipgloss.NewStyle().MaxWidth(width).Render(left)
+	}
+	return " " + left + strings.Repeat(" ", gap) + right
+}
+
+// shortPath shows a directory with ~ for the home directory and only its
+// last three parts when it is deep.
+func shortPath(dir string) string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+		if dir == home {
+			return "~"
+		}
+		if rest, ok := strings.CutPrefix(dir, home+string(filepath.Separator)); ok {
+			dir = filepath.Join("~", rest)
+		}
+	}
+	parts := strings.Split(dir, string(filepath.Separator))
+	if len(parts) > 4 {
+		dir = filepath.Join(append([]string{"…"}, parts[len(parts)-3:]...)...)
+	}
+	return dir
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// followInterval is how often a followed file is checked for new data.
+const followInterval = 500 * time.Millisecond
+
+// streamSource is input read into a block while the UI runs: piped stdin
+// or a file given with -f.
+type streamSource struct {
+	name string
+	// path is empty for stdin
+	path string
+	// follow keeps reading a file after its end, like tail -f
+	follow bool
+}
+
+// streamMsg carries data read from a source to the block showing it.
+type streamMsg struct {
+	blockID string
+	data    string
+	done    bool
+	err     error
+}
+
+// stdinIsPiped reports whether stdin is a pipe or file rather than a
+// terminal. The UI then reads keys from /dev/tty instead.
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// addStreamBlock adds the block a source is read into and returns its ID.
+func (m *model) addStreamBlock(src streamSource) string {
+	block := Block{
+		ID:        m.newBlockID(),
+		Title:     src.name,
+		Type:      BlockTypeOutput,
+		Expanded:  true,
+		IsLoading: true,
+		Timestamp: time.Now(),
+		Metadata:  map[string]string{"streaming": "true"},
+		Viewport:  viewport.New(50, 10),
+	}
+	if src.follow {
+		block.Metadata["following"] = src.path
+	}
+	m.blocks = append(m.blocks, block)
+	m.selectBlock(len(m.blocks) - 1)
+	return block.ID
+}
+
+// readStream sends everything read from src to the program, chunk by
+// chunk as it arrives, until the source ends.
+func readStream(p *tea.Program, blockID string, src streamSource) {
+	var r io.Reader = os.Stdin
+	if src.path != "" {
+		f, err := os.Open(src.path)
+		if err != nil {
+			p.Send(streamMsg{blockID: blockID, done: true, err: err})
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			p.Send(streamMsg{blockID: blockID, data: string(buf[:n])})
+		}
+		if errors.Is(err, io.EOF) && src.follow {
+			if f, ok := r.(*os.File); ok && truncated(f) {
+				// The file was truncated, as log rotation with copytruncate does
+				f.Seek(0, io.SeekStart)
+			}
+			time.Sleep(followInterval)
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			p.Send(streamMsg{blockID: blockID, done: true, err: err})
+			return
+		}
+	}
+}
+
+// truncated reports whether the file shrank below the read offset.
+func truncated(f *os.File) bool {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(f.Name())
+	return err == nil && info.Size() < offset
+}
+
+// appendStream adds data that arrived for a block. It shows on the next
+// tick, unless the source ended: refreshing the block for every chunk
+// would take time in the size of its output each time.
+func (m *model) appendStream(msg streamMsg) {
+	if msg.data != "" {
+		pending := m.streamed[msg.blockID]
+		if pending == nil {
+			pending = new(strings.Builder)
+			m.streamed[msg.blockID] = pending
+		}
+		pending.WriteString(msg.data)
+	}
+	if !msg.done && msg.err == nil {
+		return
+	}
+	m.flushStreams()
+
+	for i := range m.blocks {
+		b := &m.blocks[i]
+		if b.ID != msg.blockID {
+			continue
+		}
+
+		if msg.done {
+			b.IsLoading = false
+			delete(b.Metadata, "streaming")
+			delete(b.Metadata, "following")
+		}
+		if msg.err != nil {
+			b.Type = BlockTypeError
+			b.Error = msg.err.Error()
+		}
+		return
+	}
+}
+
+// flushStreams shows the data that arrived for stream blocks.
+func (m *model) flushStreams() {
+	for id, pending := range m.streamed {
+		if i := m.blockIndex(id); i >= 0 {
+			appendOutput(&m.blocks[i], pending.String())
+		}
+		delete(m.streamed, id)
+	}
+}
+
+// appendOutput adds data to a block's output.
+func appendOutput(b *Block, data string) {
+	if data != "" {
+		setOutput(b, b.Output+data)
+	}
+}
+
+// setOutput replaces a block's output. A block scrolled to its end stays
+// there, so following output shows the newest lines.
+func setOutput(b *Block, output string) {
+	// Highlighting keeps one line per line of output, so the raw text has
+	// the same height and is much cheaper to measure
+	vp := &b.Viewport
+	atEnd := vp.YOffset >= strings.Count(b.Output, "\n")+1-vp.Height
+	b.Output = output
+	vp.SetContent(b.Output)
+	if atEnd {
+		vp.GotoBottom()
+	}
+}
+
+// columnGap splits columns aligned with spaces, as ps, kubectl and docker
+// print them.
+var columnGap = regexp.MustCompile(`\s{2,}`)
+
+// parseTable splits output into rows and columns: tab separated, CSV, or
+// columns aligned with runs of spaces. It returns nil when the output has
+// no columns. Cells are padded so that columns line up.
+func parseTable(text string) [][]string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, "\r"))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	every := func(sep string) bool {
+		for _, line := range lines {
+			if !strings.Contains(line, sep) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var rows [][]string
+	switch {
+	case every("\t"):
+		for _, line := range lines {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	case every(","):
+		r := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil
+		}
+		rows = records
+	default:
+		for _, line := range lines {
+			rows = append(rows, columnGap.Split(strings.TrimSpace(line), -1))
+		}
+	}
+
+	// Pad every row to the same columns and every column to one width
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if cols < 2 {
+		return nil
+	}
+	widths := make([]int, cols)
+	for _, row := range rows {
+		for j, cell := range row {
+			widths[j] = max(widths[j], runewidth.StringWidth(cell))
+		}
+	}
+	for i, row := range rows {
+		padded := make([]string, cols)
+		for j := range padded {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			padded[j] = runewidth.FillRight(cell, widths[j])
+		}
+		rows[i] = padded
+	}
+	return rows
+}
+
+// tableSelected switches the selected block between showing its output as
+// text and as a table.
+func (m *model) tableSelected() tea.Cmd {
+	if m.selectedIdx >= len(m.blocks) {
+		return nil
+	}
+	b := &m.blocks[m.selectedIdx]
+	if b.Metadata["view"] == "table" {
+		delete(b.Metadata, "view")
+		return nil
+	}
+	if parseTable(b.Output) == nil {
+		m.addInfoBlock("The selected block's output has no columns to show as a table")
+		return nil
+	}
+	if b.Metadata == nil {
+		b.Metadata = make(map[string]string)
+	}
+	b.Metadata["view"] = "table"
+	return nil
+}
+
+// streamFlags are the -f FILE, --follow and --alert options.
+type streamFlags struct {
+	files  []string
+	follow bool
+	// alerts are the --alert rules, as given and as read
+	alertFlags []string
+	alerts     []AlertRule
+}
+
+func (f *streamFlags) register(flags *flag.FlagSet) {
+	file := func(path string) error {
+		f.files = append(f.files, path)
+		return nil
+	}
+	flags.Func("f", "read `FILE` into a block; may be repeated", file)
+	flags.Func("file", "read `FILE` into a block; may be repeated", file)
+	flags.BoolVar(&f.follow, "F", false, "keep reading the files as they grow")
+	flags.BoolVar(&f.follow, "follow", false, "keep reading the files as they grow")
+	flags.Func("alert", "mark lines matching `[SEVERITY[,notify]:]REGEX`; may be repeated", func(s string) error {
+		rule, err := parseAlertFlag(s)
+		if err == nil {
+			f.alertFlags = append(f.alertFlags, s)
+			f.alerts = append(f.alerts, rule)
+		}
+		return err
+	})
+}
+
+// sources are the files to read, after piped stdin if there is any.
+func (f *streamFlags) sources() ([]streamSource, error) {
+	if f.follow && len(f.files) == 0 {
+		return nil, errors.New("--follow needs a file given with -f")
+	}
+	var sources []streamSource
+	if stdinIsPiped() {
+		sources = append(sources, streamSource{name: "stdin"})
+	}
+	for _, path := range f.files {
+		sources = append(sources, streamSource{name: filepath.Base(path), path: path, follow: f.follow})
+	}
+	return sources, nil
+}
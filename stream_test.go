@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+)
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want [][]string
+	}{
+		{
+			name: "empty",
+			text: "\n\n",
+			want: nil,
+		},
+		{
+			name: "one column",
+			text: "alpha\nbeta\n",
+			want: nil,
+		},
+		{
+			name: "tabs",
+			text: "NAME\tAGE\nbob\t7\n",
+			want: [][]string{{"NAME", "AGE"}, {"bob ", "7  "}},
+		},
+		{
+			name: "csv with quotes",
+			text: "name,note\nann,\"hi, there\"\n",
+			want: [][]string{{"name", "note     "}, {"ann ", "hi, there"}},
+		},
+		{
+			name: "aligned columns",
+			text: "NAME      READY   STATUS\nweb-1     1/1     Running\ndb        0/1     Pending\n",
+			want: [][]string{{"NAME ", "READY", "STATUS "}, {"web-1", "1/1  ", "Running"}, {"db   ", "0/1  ", "Pending"}},
+		},
+		{
+			name: "ragged rows",
+			text: "a  b  c\nd  e\n",
+			want: [][]string{{"a", "b", "c"}, {"d", "e", " "}},
+		},
+		{
+			name: "wide runes",
+			text: "名前\tx\nab\ty\n",
+			want: [][]string{{"名前", "x"}, {"ab  ", "y"}},
+		},
+		{
+			name: "crlf and blank lines",
+			text: "a\tb\r\n\r\nc\td\r\n",
+			want: [][]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name: "broken csv",
+			text: "a,\"b\nc,d\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTable(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTable(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendStream(t *testing.T) {
+	m := model{
+		blocks:   []Block{{ID: "1", IsLoading: true, Metadata: map[string]string{"streaming": "true"}, Viewport: viewport.New(50, 10)}},
+		streamed: make(map[string]*strings.Builder),
+	}
+
+	// Chunks show once a tick
+	m.appendStream(streamMsg{blockID: "1", data: "one\n"})
+	m.appendStream(streamMsg{blockID: "1", data: "two\n"})
+	if m.blocks[0].Output != "" {
+		t.Errorf("output before the tick: %q", m.blocks[0].Output)
+	}
+	m.flushStreams()
+	m.flushStreams()
+	if m.blocks[0].Output != "one\ntwo\n" {
+		t.Errorf("output after the tick: %q", m.blocks[0].Output)
+	}
+
+	// The end of the source shows at once, with what came before it
+	m.appendStream(streamMsg{blockID: "1", data: "three\n"})
+	m.appendStream(streamMsg{blockID: "1", done: true, err: errors.New("read failed")})
+	b := m.blocks[0]
+	if b.Output != "one\ntwo\nthree\n" || b.IsLoading || b.Metadata["streaming"] != "" || b.Error != "read failed" {
+		t.Errorf("after the end: output %q, loading %v, error %q", b.Output, b.IsLoading, b.Error)
+	}
+
+	// Data for a block that was deleted is dropped
+	m.appendStream(streamMsg{blockID: "7", data: "gone"})
+	m.flushStreams()
+	if len(m.streamed) != 0 {
+		t.Errorf("pending data left: %v", m.streamed)
+	}
+}
+
+func TestSetOutputFollowsEnd(t *testing.T) {
+	lines := func(n int) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+		return b.String()
+	}
+
+	b := Block{Viewport: viewport.New(20, 3)}
+	setOutput(&b, lines(2))
+	if b.Viewport.YOffset != 0 {
+		t.Errorf("short output scrolled to %d", b.Viewport.YOffset)
+	}
+	// Output that fits showed its end, so longer output shows its end too
+	setOutput(&b, lines(10))
+	if !b.Viewport.AtBottom() {
+		t.Errorf("did not follow the end: offset %d", b.Viewport.YOffset)
+	}
+	setOutput(&b, lines(20))
+	if !b.Viewport.AtBottom() {
+		t.Errorf("did not keep following the end: offset %d", b.Viewport.YOffset)
+	}
+
+	// Scrolled up, it stays where it is
+	b.Viewport.SetYOffset(4)
+	setOutput(&b, lines(30))
+	if b.Viewport.YOffset != 4 {
+		t.Errorf("scrolled away from offset 4 to %d", b.Viewport.YOffset)
+	}
+}
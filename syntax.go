@@ -0,0 +1,340 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the highlighting class of a rune in a shell script.
+type tokenKind int
+
+const (
+	tokPlain tokenKind = iota
+	tokCommand
+	tokKeyword
+	tokString
+	tokVariable
+	tokOperator
+	tokComment
+)
+
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "while": true, "until": true, "do": true, "done": true,
+	"case": true, "esac": true, "in": true, "select": true, "function": true,
+	"time": true, "!": true,
+}
+
+// nameKeywords are followed by a name rather than a command.
+var nameKeywords = map[string]bool{
+	"for": true, "select": true, "case": true, "function": true,
+}
+
+// closingKeywords end a compound command; what follows them is not a
+// command name.
+var closingKeywords = map[string]bool{
+	"fi": true, "done": true, "esac": true,
+}
+
+// shellSyntax is the result of scanning a script: a kind per rune, the
+// position of the partner of every bracket and quote, and the positions of
+// brackets and quotes that have no partner.
+type shellSyntax struct {
+	kinds     []tokenKind
+	pairs     map[int]int
+	unmatched map[int]bool
+}
+
+// scanShell highlights a shell script. It is a best-effort lexer for
+// display, not a parser: it only has to be right for the scripts people
+// type, and never fails.
+func scanShell(src []rune) shellSyntax {
+	s := shellSyntax{
+		kinds:     make([]tokenKind, len(src)),
+		pairs:     make(map[int]int),
+		unmatched: make(map[int]bool),
+	}
+
+	var brackets []int    // positions of open brackets
+	var heredocs []string // delimiters whose bodies start on the next line
+	cmdStart := true
+	cases := 0 // open case statements, whose patterns end in a bare )
+
+	mark := func(from, to int, kind tokenKind) {
+		for i := from; i < to && i < len(src); i++ {
+			s.kinds[i] = kind
+		}
+	}
+	pair := func(a, b int) {
+		s.pairs[a] = b
+		s.pairs[b] = a
+	}
+
+	for i := 0; i < len(src); {
+		r := src[i]
+
+		switch {
+		case r == '\n':
+			i++
+			cmdStart = true
+			for _, delim := range heredocs {
+				i = s.scanHeredoc(src, i, delim)
+			}
+			heredocs = nil
+
+		case r == ' ' || r == '\t':
+			i++
+
+		case r == '\\':
+			i += 2
+
+		case r == '#' && (i == 0 || isShellSpace(src[i-1])):
+			end := i
+			for end < len(src) && src[end] != '\n' {
+				end++
+			}
+			mark(i, end, tokComment)
+			i = end
+
+		case r == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != '\'' {
+				end++
+			}
+			if end < len(src) {
+				pair(i, end)
+				end++
+			} else {
+				s.unmatched[i] = true
+			}
+			mark(i, end, tokString)
+			i = end
+			cmdStart = false
+
+		case r == '"':
+			i = s.scanDoubleQuoted(src, i)
+			cmdStart = false
+
+		case r == '`':
+			end := i + 1
+			for end < len(src) && src[end] != '`' {
+				end++
+			}
+			mark(i, i+1, tokOperator)
+			if end < len(src) {
+				pair(i, end)
+				mark(end, end+1, tokOperator)
+				end++
+			} else {
+				s.unmatched[i] = true
+			}
+			i = end
+
+		case r == '$':
+			if i+1 < len(src) && src[i+1] == '(' {
+				mark(i, i+2, tokOperator)
+				brackets = append(brackets, i+1)
+				i += 2
+				cmdStart = true
+				continue
+			}
+			i = s.scanVariable(src, i)
+			cmdStart = false
+
+		case strings.ContainsRune("([{", r):
+			mark(i, i+1, tokOperator)
+			brackets = append(brackets, i)
+			i++
+			cmdStart = r != '['
+
+		case strings.ContainsRune(")]}", r):
+			mark(i, i+1, tokOperator)
+			if n := len(brackets); n > 0 && closes(src[brackets[n-1]], r) {
+				pair(brackets[n-1], i)
+				brackets = brackets[:n-1]
+			} else if cases == 0 || r != ')' {
+				s.unmatched[i] = true
+			}
+			i++
+			cmdStart = cases > 0 && r == ')'
+
+		case strings.ContainsRune("|&;<>", r):
+			end := i
+			for end < len(src) && strings.ContainsRune("|&;<>-", src[end]) && (src[end] != '-' || end > i && src[end-1] == '<') {
+				end++
+			}
+			op := string(src[i:end])
+			mark(i, end, tokOperator)
+			i = end
+
+			if strings.HasPrefix(op, "<<") && !strings.HasPrefix(op, "<<<") {
+				var delim string
+				from := i
+				delim, i = heredocDelimiter(src, i)
+				mark(from, i, tokKeyword)
+				if delim != "" {
+					heredocs = append(heredocs, delim)
+				}
+			}
+			// Redirections take a file name, everything else a new command
+			cmdStart = !strings.ContainsAny(op, "<>")
+
+		default:
+			end := i
+			for end < len(src) && !isShellSpace(src[end]) && !strings.ContainsRune("|&;<>()[]{}'\"`$\\", src[end]) {
+				end++
+			}
+			if end == i {
+				i++
+				continue
+			}
+			word := string(src[i:end])
+
+			switch {
+			case cmdStart && shellKeywords[word]:
+				mark(i, end, tokKeyword)
+				cmdStart = !nameKeywords[word] && !closingKeywords[word]
+				if word == "case" {
+					cases++
+				} else if word == "esac" && cases > 0 {
+					cases--
+				}
+			case cmdStart && isAssignment(word):
+				mark(i, i+strings.IndexRune(word, '='), tokVariable)
+			case cmdStart:
+				mark(i, end, tokCommand)
+				cmdStart = false
+			case word == "in" || word == "do":
+				// for x in ...; select x in ...
+				mark(i, end, tokKeyword)
+			}
+			i = end
+		}
+	}
+
+	for _, open := range brackets {
+		s.unmatched[open] = true
+	}
+	return s
+}
+
+// scanDoubleQuoted marks a "..." string, highlighting the variables inside
+// it, and returns the position after the closing quote.
+func (s *shellSyntax) scanDoubleQuoted(src []rune, start int) int {
+	s.kinds[start] = tokString
+	i := start + 1
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			s.kinds[i] = tokString
+			if i+1 < len(src) {
+				s.kinds[i+1] = tokString
+			}
+			i += 2
+		case '$':
+			i = s.scanVariable(src, i)
+		case '"':
+			s.kinds[i] = tokString
+			s.pairs[start] = i
+			s.pairs[i] = start
+			return i + 1
+		default:
+			s.kinds[i] = tokString
+			i++
+		}
+	}
+	s.unmatched[start] = true
+	return i
+}
+
+// scanVariable marks $name, ${...} and the special parameters, and returns
+// the position after them.
+func (s *shellSyntax) scanVariable(src []rune, start int) int {
+	end := start + 1
+	switch {
+	case end < len(src) && src[end] == '{':
+		for end < len(src) && src[end] != '}' && src[end] != '\n' {
+			end++
+		}
+		if end < len(src) && src[end] == '}' {
+			s.pairs[start+1] = end
+			s.pairs[end] = start + 1
+			end++
+		} else {
+			s.unmatched[start+1] = true
+		}
+	case end < len(src) && strings.ContainsRune("?!#$@*-0123456789", src[end]):
+		end++
+	default:
+		for end < len(src) && (src[end] == '_' || unicode.IsLetter(src[end]) || unicode.IsDigit(src[end])) {
+			end++
+		}
+	}
+
+	for i := start; i < end; i++ {
+		s.kinds[i] = tokVariable
+	}
+	return end
+}
+
+// scanHeredoc marks the body of a here-document starting at start and
+// returns the position after its terminating line.
+func (s *shellSyntax) scanHeredoc(src []rune, start int, delim string) int {
+	i := start
+	for i < len(src) {
+		end := i
+		for end < len(src) && src[end] != '\n' {
+			end++
+		}
+		line := string(src[i:end])
+		kind := tokString
+		if strings.TrimLeft(line, "\t") == delim {
+			kind = tokKeyword
+		}
+		for j := i; j < end; j++ {
+			s.kinds[j] = kind
+		}
+		if end < len(src) {
+			end++
+		}
+		i = end
+		if kind == tokKeyword {
+			break
+		}
+	}
+	return i
+}
+
+// heredocDelimiter reads the word after << and returns it without quotes.
+func heredocDelimiter(src []rune, i int) (string, int) {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	start := i
+	for i < len(src) && !isShellSpace(src[i]) && !strings.ContainsRune("|&;<>()", src[i]) {
+		i++
+	}
+	return strings.Trim(string(src[start:i]), `'"\`), i
+}
+
+func closes(open, close rune) bool {
+	return open == '(' && close == ')' || open == '[' && close == ']' || open == '{' && close == '}'
+}
+
+func isShellSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+// isAssignment reports whether word is NAME=value.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kindString writes one letter per rune: . plain, C command, K keyword,
+// S string, V variable, O operator, # comment.
+func kindString(kinds []tokenKind) string {
+	var b strings.Builder
+	for _, k := range kinds {
+		b.WriteByte(".CKSVO#"[k])
+	}
+	return b.String()
+}
+
+func TestScanShellKinds(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: `echo "hi $USER" 'x'`, want: "CCCC.SSSSVVVVVS.SSS"},
+		{src: `FOO=1 make -j4 build`, want: "VVV...CCCC.........."},
+		{src: `ls | grep -v foo && echo ok; true`, want: "CC.O.CCCC........OO.CCCC...O.CCCC"},
+		{src: `echo $(date +%s) ${HOME}/x $1`, want: "CCCC.OOCCCC....O.VVVVVVV...VV"},
+		// Escaped quotes do not open a string
+		{src: `echo \"not a string\" \'`, want: "CCCC...................."},
+		{src: `echo "a \" b"`, want: "CCCC.SSSSSSSS"},
+		{src: "cat <<EOF > out\nhello $x\nEOF\necho done", want: "CCC.OOKKK.O.....SSSSSSSS.KKK.CCCC....."},
+		{src: "cat <<-'END'\n\tbody\n\tEND\nls", want: "CCC.OOOKKKKK.SSSSS.KKKK.CC"},
+		// A here-string is not a heredoc
+		{src: `cat <<< "word"`, want: "CCC.OOO.SSSSSS"},
+		{src: `if [ -f x ]; then rm x; fi`, want: "KK.O......OO.KKKK.CC..O.KK"},
+		{src: "case $1 in\n a) echo a;;\nesac", want: "KKKK.VV.KK..CO.CCCC..OO.KKKK"},
+		// # starts a comment only at the start of a word
+		{src: `echo a#b # comment`, want: "CCCC.....#########"},
+	}
+
+	for _, tt := range tests {
+		if got := kindString(scanShell([]rune(tt.src)).kinds); got != tt.want {
+			t.Errorf("scanShell(%q)\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestScanShellBrackets(t *testing.T) {
+	tests := []struct {
+		src       string
+		pairs     map[int]int // opening index to closing index
+		unmatched []int
+	}{
+		{src: `echo "hi" 'x'`, pairs: map[int]int{5: 8, 10: 12}},
+		{src: `echo "a \" b"`, pairs: map[int]int{5: 12}},
+		{src: `echo $(date) ${HOME}`, pairs: map[int]int{6: 11, 14: 19}},
+		{src: `x=$((1 + 2))`, pairs: map[int]int{3: 11, 4: 10}},
+		{src: `if [ -f x ]; then :; fi`, pairs: map[int]int{3: 10}},
+		{src: "echo `date`", pairs: map[int]int{5: 10}},
+		// The ) of a case pattern has nothing to match
+		{src: "case $1 in\n a) echo a;;\nesac"},
+
+		{src: `echo "open`, unmatched: []int{5}},
+		{src: `echo 'open`, unmatched: []int{5}},
+		{src: `echo $(ls`, unmatched: []int{6}},
+		{src: `echo ${HOME`, unmatched: []int{6}},
+		{src: "echo `x", unmatched: []int{5}},
+		{src: `echo x)`, unmatched: []int{6}},
+		{src: `echo (a [b) c]`, pairs: map[int]int{8: 13}, unmatched: []int{5, 10}},
+	}
+
+	for _, tt := range tests {
+		s := scanShell([]rune(tt.src))
+		pairs := make(map[int]int)
+		for open, close := range tt.pairs {
+			pairs[open], pairs[close] = close, open
+		}
+		if !reflect.DeepEqual(s.pairs, pairs) {
+			t.Errorf("scanShell(%q) pairs = %v, want %v", tt.src, s.pairs, pairs)
+		}
+		unmatched := make(map[int]bool)
+		for _, i := range tt.unmatched {
+			unmatched[i] = true
+		}
+		if !reflect.DeepEqual(s.unmatched, unmatched) {
+			t.Errorf("scanShell(%q) unmatched = %v, want %v", tt.src, s.unmatched, unmatched)
+		}
+	}
+}
+
+func TestHeredocDelimiter(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		end  int
+	}{
+		{src: "EOF\nbody", want: "EOF", end: 3},
+		{src: "  'END' > out", want: "END", end: 7},
+		{src: `"DONE";`, want: "DONE", end: 6},
+		{src: `\EOF|wc`, want: "EOF", end: 4},
+		{src: "", want: "", end: 0},
+	}
+
+	for _, tt := range tests {
+		got, end := heredocDelimiter([]rune(tt.src), 0)
+		if got != tt.want || end != tt.end {
+			t.Errorf("heredocDelimiter(%q) = %q, %d, want %q, %d", tt.src, got, end, tt.want, tt.end)
+		}
+	}
+}
+
+func TestIsAssignment(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{word: "FOO=1", want: true},
+		{word: "_x2=", want: true},
+		{word: "héllo=world", want: true},
+		{word: "=1"},
+		{word: "2x=1"},
+		{word: "a-b=1"},
+		{word: "--flag=1"},
+		{word: "make"},
+	}
+
+	for _, tt := range tests {
+		if got := isAssignment(tt.word); got != tt.want {
+			t.Errorf("isAssignment(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// Theme is a named color scheme. Colors are anything lipgloss.Color
+// accepts: an ANSI 256 index such as "205" or a hex value such as "#ff7ccb".
+//
+// Theme files live in the themes directory of the config dir, one theme per
+// YAML file. A file only has to list the colors it changes; everything else
+// comes from the preset named in base, or from the dark preset.
+type Theme struct {
+	Name string `yaml:"name"`
+	Base string `yaml:"base,omitempty"`
+
+	// Block frames, by block type. Types without an entry use Border.
+	Border         string               `yaml:"border"`
+	SelectedBorder string               `yaml:"selected_border"`
+	Borders        map[BlockType]string `yaml:"borders"`
+
+	Title             string `yaml:"title"`
+	HeaderBorder      string `yaml:"header_border"`
+	Content           string `yaml:"content"`
+	Muted             string `yaml:"muted"`
+	Command           string `yaml:"command"`
+	Error             string `yaml:"error"`
+	Success           string `yaml:"success"`
+	Accent            string `yaml:"accent"`
+	OverlayBackground string `yaml:"overlay_background"`
+
+	TableHeader             string `yaml:"table_header"`
+	TableCell               string `yaml:"table_cell"`
+	TableBorder             string `yaml:"table_border"`
+	TableSelectedForeground string `yaml:"table_selected_foreground"`
+	TableSelectedBackground string `yaml:"table_selected_background"`
+
+	Highlight HighlightColors `yaml:"highlight"`
+
+	ProgressFrom string `yaml:"progress_from"`
+	ProgressTo   string `yaml:"progress_to"`
+}
+
+// HighlightColors are the colors renderOutput uses for command output.
+type HighlightColors struct {
+	Directory  string `yaml:"directory"`
+	Executable string `yaml:"executable"`
+	File       string `yaml:"file"`
+	Error      string `yaml:"error"`
+	Success    string `yaml:"success"`
+	Number     string `yaml:"number"`
+	Path       string `yaml:"path"`
+	URL        string `yaml:"url"`
+}
+
+// themeAuto picks the dark or light preset from the terminal background.
+const themeAuto = "auto"
+
+var (
+	darkTheme = Theme{
+		Name:           "dark",
+		Border:         "62",
+		SelectedBorder: "39",
+		Borders: map[BlockType]string{
+			BlockTypeCommand: "220",
+			BlockTypeOutput:  "34",
+			BlockTypeSuccess: "34",
+			BlockTypeError:   "196",
+			BlockTypeInfo:    "39",
+		},
+		Title:                   "205",
+		HeaderBorder:            "62",
+		Content:                 "252",
+		Muted:                   "240",
+		Command:                 "220",
+		Error:                   "196",
+		Success:                 "46",
+		Accent:                  "39",
+		OverlayBackground:       "235",
+		TableHeader:             "205",
+		TableCell:               "252",
+		TableBorder:             "240",
+		TableSelectedForeground: "229",
+		TableSelectedBackground: "57",
+		Highlight: HighlightColors{
+			Directory:  "39",
+			Executable: "46",
+			File:       "252",
+			Error:      "196",
+			Success:    "46",
+			Number:     "205",
+			Path:       "220",
+			URL:        "39",
+		},
+		ProgressFrom: "#FF7CCB",
+		ProgressTo:   "#FDFF8C",
+	}
+
+	lightTheme = Theme{
+		Name:           "light",
+		Border:         "60",
+		SelectedBorder: "25",
+		Borders: map[BlockType]string{
+			BlockTypeCommand: "130",
+			BlockTypeOutput:  "28",
+			BlockTypeSuccess: "28",
+			BlockTypeError:   "160",
+			BlockTypeInfo:    "25",
+		},
+		Title:                   "163",
+		HeaderBorder:            "60",
+		Content:                 "235",
+		Muted:                   "245",
+		Command:                 "130",
+		Error:                   "160",
+		Success:                 "28",
+		Accent:                  "25",
+		OverlayBackground:       "254",
+		TableHeader:             "163",
+		TableCell:               "235",
+		TableBorder:             "248",
+		TableSelectedForeground: "231",
+		TableSelectedBackground: "25",
+		Highlight: HighlightColors{
+			Directory:  "25",
+			Executable: "28",
+			File:       "235",
+			Error:      "160",
+			Success:    "28",
+			Number:     "163",
+			Path:       "130",
+			URL:        "25",
+		},
+		ProgressFrom: "#5A56E0",
+		ProgressTo:   "#EE6FF8",
+	}
+
+	solarizedTheme = Theme{
+		Name:           "solarized",
+		Border:         "#6c71c4",
+		SelectedBorder: "#268bd2",
+		Borders: map[BlockType]string{
+			BlockTypeCommand: "#b58900",
+			BlockTypeOutput:  "#859900",
+			BlockTypeSuccess: "#859900",
+			BlockTypeError:   "#dc322f",
+			BlockTypeInfo:    "#2aa198",
+		},
+		Title:                   "#d33682",
+		HeaderBorder:            "#6c71c4",
+		Content:                 "#839496",
+		Muted:                   "#586e75",
+		Command:                 "#b58900",
+		Error:                   "#dc322f",
+		Success:                 "#859900",
+		Accent:                  "#268bd2",
+		OverlayBackground:       "#073642",
+		TableHeader:             "#d33682",
+		TableCell:               "#839496",
+		TableBorder:             "#586e75",
+		TableSelectedForeground: "#fdf6e3",
+		TableSelectedBackground: "#268bd2",
+		Highlight: HighlightColors{
+			Directory:  "#268bd2",
+			Executable: "#859900",
+			File:       "#839496",
+			Error:      "#dc322f",
+			Success:    "#859900",
+			Number:     "#d33682",
+			Path:       "#cb4b16",
+			URL:        "#2aa198",
+		},
+		ProgressFrom: "#268bd2",
+		ProgressTo:   "#2aa198",
+	}
+
+	highContrastTheme = Theme{
+		Name:           "high-contrast",
+		Border:         "15",
+		SelectedBorder: "14",
+		Borders: map[BlockType]string{
+			BlockTypeCommand: "11",
+			BlockTypeOutput:  "10",
+			BlockTypeSuccess: "10",
+			BlockTypeError:   "9",
+			BlockTypeInfo:    "14",
+		},
+		Title:                   "15",
+		HeaderBorder:            "15",
+		Content:                 "15",
+		Muted:                   "250",
+		Command:                 "11",
+		Error:                   "9",
+		Success:                 "10",
+		Accent:                  "14",
+		OverlayBackground:       "0",
+		TableHeader:             "11",
+		TableCell:               "15",
+		TableBorder:             "15",
+		TableSelectedForeground: "0",
+		TableSelectedBackground: "11",
+		Highlight: HighlightColors{
+			Directory:  "14",
+			Executable: "10",
+			File:       "15",
+			Error:      "9",
+			Success:    "10",
+			Number:     "13",
+			Path:       "11",
+			URL:        "14",
+		},
+		ProgressFrom: "#FFFFFF",
+		ProgressTo:   "#FFFF00",
+	}
+
+	// colorblindTheme uses the Okabe-Ito palette, which stays
+	// distinguishable under the common forms of color blindness. Success
+	// and failure differ in blue versus vermillion rather than green versus
+	// red.
+	colorblindTheme = Theme{
+		Name:           "colorblind",
+		Border:         "#999999",
+		SelectedBorder: "#56B4E9",
+		Borders: map[BlockType]string{
+			BlockTypeCommand: "#E69F00",
+			BlockTypeOutput:  "#0072B2",
+			BlockTypeSuccess: "#0072B2",
+			BlockTypeError:   "#D55E00",
+			BlockTypeInfo:    "#56B4E9",
+		},
+		Title:                   "#CC79A7",
+		HeaderBorder:            "#999999",
+		Content:                 "252",
+		Muted:                   "244",
+		Command:                 "#E69F00",
+		Error:                   "#D55E00",
+		Success:                 "#0072B2",
+		Accent:                  "#56B4E9",
+		OverlayBackground:       "235",
+		TableHeader:             "#CC79A7",
+		TableCell:               "252",
+		TableBorder:             "244",
+		TableSelectedForeground: "#000000",
+		TableSelectedBackground: "#F0E442",
+		Highlight: HighlightColors{
+			Directory:  "#56B4E9",
+			Executable: "#009E73",
+			File:       "252",
+			Error:      "#D55E00",
+			Success:    "#0072B2",
+			Number:     "#CC79A7",
+			Path:       "#F0E442",
+			URL:        "#56B4E9",
+		},
+		ProgressFrom: "#0072B2",
+		ProgressTo:   "#F0E442",
+	}
+)
+
+// builtinThemes lists the presets in the order the theme key cycles them.
+func builtinThemes() []Theme {
+	return []Theme{darkTheme, lightTheme, solarizedTheme, highContrastTheme, colorblindTheme}
+}
+
+// clone copies t so that decoding a theme file over it cannot modify the
+// preset's border map.
+func (t Theme) clone() Theme {
+	borders := make(map[BlockType]string, len(t.Borders))
+	for k, v := range t.Borders {
+		borders[k] = v
+	}
+	t.Borders = borders
+	return t
+}
+
+// border returns the frame color for a block type.
+func (t Theme) border(bt BlockType) lipgloss.Color {
+	if c, ok := t.Borders[bt]; ok {
+		return lipgloss.Color(c)
+	}
+	return lipgloss.Color(t.Border)
+}
+
+func themesDir() string {
+	return filepath.Join(configDir(), "themes")
+}
+
+// loadThemes returns the presets followed by the user's theme files, sorted
+// by name. Files that fail to parse are skipped and reported.
+func loadThemes() ([]Theme, []string) {
+	themes := builtinThemes()
+	var warnings []string
+
+	files, err := filepath.Glob(filepath.Join(themesDir(), "*.yaml"))
+	if err != nil {
+		return themes, nil
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		t, err := loadThemeFile(file, themes)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		themes = append(themes, t)
+	}
+
+	return themes, warnings
+}
+
+func loadThemeFile(path string, known []Theme) (Theme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, err
+	}
+
+	// Read base first so the file's own colors land on top of it
+	var header struct {
+		Base string `yaml:"base"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	base := darkTheme
+	if header.Base != "" {
+		found, ok := findTheme(known, header.Base)
+		if !ok {
+			return Theme{}, fmt.Errorf("%s: unknown base theme %q", path, header.Base)
+		}
+		base = found
+	}
+
+	t := base.clone()
+	t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+func findTheme(themes []Theme, name string) (Theme, bool) {
+	for _, t := range themes {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return Theme{}, false
+}
+
+// resolveTheme picks the configured theme, detecting the terminal
+// background when none is configured or the name is "auto".
+func resolveTheme(themes []Theme, name string) (Theme, error) {
+	if name == "" || name == themeAuto {
+		if lipgloss.HasDarkBackground() {
+			return darkTheme, nil
+		}
+		return lightTheme, nil
+	}
+
+	t, ok := findTheme(themes, name)
+	if !ok {
+		return darkTheme, fmt.Errorf("theme: unknown theme %q, using dark", name)
+	}
+	return t, nil
+}
+
+// nextTheme returns the theme after the current one, wrapping around.
+func nextTheme(themes []Theme, current string) Theme {
+	for i, t := range themes {
+		if t.Name == current {
+			return themes[(i+1)%len(themes)]
+		}
+	}
+	return themes[0]
+}
+
+// applyTheme restyles everything that was built from the previous theme.
+func (m *model) applyTheme(t Theme) {
+	m.theme = t
+	m.styles = NewStyles(t)
+	m.spinner.Style = m.styles.Spinner
+	m.progress = newProgress(t, m.progress.Width)
+	m.table.SetStyles(m.styles.tableStyles())
+}
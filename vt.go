@@ -0,0 +1,278 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// vtParser splits terminal output into text, control characters, CSI and
+// OSC sequences. It keeps its state between calls, so a sequence may be
+// split across reads.
+type vtParser struct {
+	state  vtState
+	buf    []byte // the sequence read so far, or an incomplete rune
+	handle vtHandler
+}
+
+type vtState int
+
+const (
+	vtText vtState = iota
+	vtEscape
+	vtCSI
+	vtOSC
+	vtOSCEscape
+	vtCharset
+)
+
+// vtHandler receives what the parser finds.
+type vtHandler interface {
+	print(r rune)
+	control(b byte)
+	csi(final byte, private bool, params []int)
+	osc(data string)
+}
+
+func (p *vtParser) feed(data []byte) {
+	for _, c := range data {
+		switch p.state {
+		case vtText:
+			switch {
+			case len(p.buf) == 0 && c == 0x1b:
+				p.state = vtEscape
+			case len(p.buf) == 0 && (c < 0x20 || c == 0x7f):
+				p.handle.control(c)
+			case len(p.buf) == 0 && c < utf8.RuneSelf:
+				p.handle.print(rune(c))
+			default:
+				p.buf = append(p.buf, c)
+				if !utf8.FullRune(p.buf) {
+					continue
+				}
+				r, size := utf8.DecodeRune(p.buf)
+				rest := append([]byte(nil), p.buf[size:]...)
+				p.buf = p.buf[:0]
+				p.handle.print(r)
+				// An invalid sequence, as in Latin-1 text, only stands for
+				// its first byte; the bytes after it may be text or
+				// controls of their own
+				p.feed(rest)
+			}
+
+		case vtEscape:
+			p.buf = p.buf[:0]
+			switch c {
+			case '[':
+				p.state = vtCSI
+			case ']':
+				p.state = vtOSC
+			case '(', ')', '*', '+', '#':
+				p.state = vtCharset
+			default:
+				// Two-byte sequences such as keypad modes are ignored
+				p.state = vtText
+			}
+
+		case vtCharset:
+			p.state = vtText
+
+		case vtCSI:
+			if c >= 0x40 && c <= 0x7e {
+				p.csi(c)
+				p.buf = p.buf[:0]
+				p.state = vtText
+			} else {
+				p.buf = append(p.buf, c)
+			}
+
+		case vtOSC:
+			switch c {
+			case 0x07:
+				p.handle.osc(string(p.buf))
+				p.buf = p.buf[:0]
+				p.state = vtText
+			case 0x1b:
+				p.state = vtOSCEscape
+			default:
+				p.buf = append(p.buf, c)
+			}
+
+		case vtOSCEscape:
+			// ESC \ ends the sequence
+			p.handle.osc(string(p.buf))
+			p.buf = p.buf[:0]
+			p.state = vtText
+			if c != '\\' {
+				p.state = vtEscape
+			}
+		}
+	}
+}
+
+func (p *vtParser) csi(final byte) {
+	raw := string(p.buf)
+	private := strings.HasPrefix(raw, "?") || strings.HasPrefix(raw, ">") || strings.HasPrefix(raw, "=")
+	raw = strings.TrimLeft(raw, "?>=")
+	var params []int
+	if raw != "" {
+		for _, field := range strings.Split(raw, ";") {
+			n, _ := strconv.Atoi(field)
+			params = append(params, n)
+		}
+	}
+	p.handle.csi(final, private, params)
+}
+
+// vtScreen keeps the text a terminal would show, without colors. It knows
+// enough cursor movement for line editors and progress bars; full screen
+// programs are beyond it.
+type vtScreen struct {
+	lines    [][]rune
+	row, col int
+	width    int
+}
+
+func newVTScreen(width int) *vtScreen {
+	return &vtScreen{lines: [][]rune{nil}, width: max(width, 20)}
+}
+
+func (s *vtScreen) reset() {
+	s.lines = [][]rune{nil}
+	s.row, s.col = 0, 0
+}
+
+func (s *vtScreen) line() []rune {
+	for len(s.lines) <= s.row {
+		s.lines = append(s.lines, nil)
+	}
+	return s.lines[s.row]
+}
+
+func (s *vtScreen) print(r rune) {
+	if s.col >= s.width {
+		s.row++
+		s.col = 0
+	}
+	line := s.line()
+	for len(line) <= s.col {
+		line = append(line, ' ')
+	}
+	line[s.col] = r
+	s.lines[s.row] = line
+	s.col++
+}
+
+func (s *vtScreen) control(b byte) {
+	switch b {
+	case '\n':
+		s.row++
+		s.line()
+	case '\r':
+		s.col = 0
+	case '\b':
+		s.col = max(s.col-1, 0)
+	case '\t':
+		s.col = min((s.col/8+1)*8, s.width-1)
+	}
+}
+
+func (s *vtScreen) csi(final byte, private bool, params []int) {
+	if private {
+		return
+	}
+	n := 1
+	if len(params) > 0 && params[0] > 0 {
+		n = params[0]
+	}
+	mode := 0
+	if len(params) > 0 {
+		mode = params[0]
+	}
+
+	line := s.line()
+	switch final {
+	case 'C':
+		s.col = min(s.col+n, s.width-1)
+	case 'D':
+		s.col = max(s.col-n, 0)
+	case 'A':
+		s.row = max(s.row-n, 0)
+	case 'B':
+		s.row += n
+		s.line()
+	case 'G':
+		s.col = min(n-1, s.width-1)
+	case 'K':
+		switch mode {
+		case 0:
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+		case 1:
+			for i := 0; i <= s.col && i < len(line); i++ {
+				line[i] = ' '
+			}
+		case 2:
+			s.lines[s.row] = nil
+		}
+	case 'J':
+		if mode == 2 || mode == 3 {
+			s.reset()
+		} else if mode == 0 {
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+			s.lines = s.lines[:s.row+1]
+		}
+	case 'P':
+		if s.col < len(line) {
+			end := min(s.col+n, len(line))
+			s.lines[s.row] = append(line[:s.col], line[end:]...)
+		}
+	case '@':
+		if s.col < len(line) {
+			blanks := []rune(strings.Repeat(" ", n))
+			s.lines[s.row] = append(line[:s.col], append(blanks, line[s.col:]...)...)
+		}
+	case 'X':
+		for i := s.col; i < s.col+n && i < len(line); i++ {
+			line[i] = ' '
+		}
+	case 'H', 'f':
+		// Absolute positions only make sense on a full screen; keep the
+		// row and honor the column
+		if len(params) > 1 && params[1] > 0 {
+			s.col = min(params[1]-1, s.width-1)
+		} else {
+			s.col = 0
+		}
+	}
+}
+
+func (s *vtScreen) osc(string) {}
+
+// text is everything on the screen, trailing blanks removed.
+func (s *vtScreen) text() string {
+	lines := make([]string, len(s.lines))
+	for i, l := range s.lines {
+		lines[i] = strings.TrimRight(string(l), " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// textFrom is the text after the given position.
+func (s *vtScreen) textFrom(row, col int) string {
+	if row >= len(s.lines) {
+		return ""
+	}
+	first := s.lines[row]
+	if col > len(first) {
+		col = len(first)
+	}
+	lines := []string{string(first[col:])}
+	for _, l := range s.lines[row+1:] {
+		lines = append(lines, string(l))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
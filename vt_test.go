@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// vtRecorder writes down what the parser finds, one event per entry.
+type vtRecorder struct {
+	events []string
+	text   strings.Builder
+}
+
+func (r *vtRecorder) flush() {
+	if r.text.Len() > 0 {
+		r.events = append(r.events, "text "+r.text.String())
+		r.text.Reset()
+	}
+}
+
+func (r *vtRecorder) print(c rune) { r.text.WriteRune(c) }
+
+func (r *vtRecorder) control(b byte) {
+	r.flush()
+	r.events = append(r.events, fmt.Sprintf("control %#x", b))
+}
+
+func (r *vtRecorder) csi(final byte, private bool, params []int) {
+	r.flush()
+	r.events = append(r.events, fmt.Sprintf("csi %c %v %v", final, private, params))
+}
+
+func (r *vtRecorder) osc(data string) {
+	r.flush()
+	r.events = append(r.events, "osc "+data)
+}
+
+func TestVTParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "text and controls",
+			chunks: []string{"ab\r\ncd\t"},
+			want:   []string{"text ab", "control 0xd", "control 0xa", "text cd", "control 0x9"},
+		},
+		{
+			name:   "utf-8 split across reads",
+			chunks: []string{"caf\xc3", "\xa9 \xe6\x97", "\xa5\n"},
+			want:   []string{"text café 日", "control 0xa"},
+		},
+		{
+			name:   "latin-1 keeps the newline",
+			chunks: []string{"caf\xe9\nnext\n"},
+			want:   []string{"text caf�", "control 0xa", "text next", "control 0xa"},
+		},
+		{
+			name:   "invalid byte before an escape",
+			chunks: []string{"a\xe6\x97\x1b[1mb"},
+			want:   []string{"text a��", "csi m false [1]", "text b"},
+		},
+		{
+			name:   "invalid bytes before text",
+			chunks: []string{"\xff\xfeok"},
+			want:   []string{"text ��ok"},
+		},
+		{
+			name:   "csi",
+			chunks: []string{"\x1b[2K\x1b[?25l\x1b[1;", "5H"},
+			want:   []string{"csi K false [2]", "csi l true [25]", "csi H false [1 5]"},
+		},
+		{
+			name:   "osc ended by bel and by st",
+			chunks: []string{"\x1b]133;A\x07x\x1b]133;", "D;0\x1b\\y"},
+			want:   []string{"osc 133;A", "text x", "osc 133;D;0", "text y"},
+		},
+		{
+			name:   "charset and two-byte escapes are dropped",
+			chunks: []string{"\x1b(Ba\x1b=b"},
+			want:   []string{"text ab"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &vtRecorder{}
+			p := &vtParser{handle: rec}
+			for _, chunk := range tt.chunks {
+				p.feed([]byte(chunk))
+			}
+			rec.flush()
+			if !reflect.DeepEqual(rec.events, tt.want) {
+				t.Errorf("events = %q, want %q", rec.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestVTScreen(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "lines", input: "one\r\ntwo\n", want: "one\ntwo"},
+		{name: "carriage return overwrites", input: "50%\r100%", want: "100%"},
+		{name: "backspace", input: "abc\b\bX", want: "aXc"},
+		{name: "erase line", input: "old text\r\x1b[2Knew", want: "new"},
+		{name: "erase to end", input: "abcdef\x1b[3D\x1b[K", want: "abc"},
+		{name: "cursor up", input: "a\r\nb\x1b[A\rc", want: "c\nb"},
+		{name: "delete chars", input: "abcdef\r\x1b[2P", want: "cdef"},
+		{name: "clear screen", input: "gone\r\n\x1b[2Jkept", want: "kept"},
+		{name: "wrap", input: strings.Repeat("x", 25), want: strings.Repeat("x", 20) + "\n" + strings.Repeat("x", 5)},
+		{name: "latin-1", input: "caf\xe9\r\nbar", want: "caf�\nbar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newVTScreen(20)
+			p := &vtParser{handle: s}
+			p.feed([]byte(tt.input))
+			if got := s.text(); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
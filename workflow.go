@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow is a named command template. Placeholders are written
+// {{name}} and are replaced verbatim, so quote them in the command where
+// the shell needs it.
+//
+// Workflow files are YAML, either one workflow per file or a list of them,
+// in the workflows directory of the config dir and in any directory listed
+// under workflows.dirs in config.yaml.
+type Workflow struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description"`
+	Command     string          `yaml:"command"`
+	Tags        []string        `yaml:"tags"`
+	Params      []WorkflowParam `yaml:"params"`
+
+	// file is where the workflow was read from, for error messages.
+	file string
+}
+
+// WorkflowParam describes a placeholder. Placeholders without an entry get
+// one with no description that must be filled in.
+type WorkflowParam struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Default     string `yaml:"default"`
+	// Pattern is a regular expression the whole value has to match.
+	Pattern string `yaml:"pattern"`
+	// Options restricts the value to a fixed set.
+	Options []string `yaml:"options"`
+	// Optional allows an empty value when there is no default.
+	Optional bool `yaml:"optional"`
+
+	pattern *regexp.Regexp
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// workflowForm is the state of the parameter prompt for a workflow.
+type workflowForm struct {
+	active   bool
+	workflow Workflow
+	values   []string
+	param    int
+	input    textinput.Model
+	err      string
+}
+
+func workflowsDir() string {
+	return filepath.Join(configDir(), "workflows")
+}
+
+// loadWorkflows reads every workflow file, sorted by name. Files and
+// workflows that are invalid are skipped and reported.
+func loadWorkflows(cfg WorkflowsConfig) ([]Workflow, []string) {
+	var workflows []Workflow
+	var warnings []string
+
+	dirs := append([]string{workflowsDir()}, cfg.Dirs...)
+	for _, dir := range dirs {
+		var files []string
+		for _, ext := range []string{"*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(expandHome(dir), ext))
+			files = append(files, matches...)
+		}
+		if len(files) == 0 && dir != workflowsDir() {
+			if _, err := os.Stat(expandHome(dir)); errors.Is(err, fs.ErrNotExist) {
+				warnings = append(warnings, fmt.Sprintf("workflows: directory %s does not exist", dir))
+			}
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			loaded, err := loadWorkflowFile(file)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			for _, wf := range loaded {
+				if err := wf.prepare(); err != nil {
+					warnings = append(warnings, err.Error())
+					continue
+				}
+				workflows = append(workflows, wf)
+			}
+		}
+	}
+
+	sort.SliceStable(workflows, func(i, j int) bool {
+		return strings.ToLower(workflows[i].Name) < strings.ToLower(workflows[j].Name)
+	})
+	return workflows, warnings
+}
+
+func loadWorkflowFile(path string) ([]Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(node.Content) == 0 {
+		return nil, nil
+	}
+
+	var workflows []Workflow
+	if node.Content[0].Kind == yaml.SequenceNode {
+		err = node.Content[0].Decode(&workflows)
+	} else {
+		var wf Workflow
+		err = node.Content[0].Decode(&wf)
+		workflows = []Workflow{wf}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range workflows {
+		workflows[i].file = path
+		if workflows[i].Name == "" {
+			workflows[i].Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+	}
+	return workflows, nil
+}
+
+// prepare checks the workflow, compiles parameter patterns and adds a
+// parameter for every placeholder that has no entry, in order of
+// appearance.
+func (wf *Workflow) prepare() error {
+	if strings.TrimSpace(wf.Command) == "" {
+		return fmt.Errorf("%s: workflow %q has no command", wf.file, wf.Name)
+	}
+
+	declared := make(map[string]bool)
+	for i := range wf.Params {
+		p := &wf.Params[i]
+		if p.Name == "" {
+			return fmt.Errorf("%s: workflow %q has a parameter without a name", wf.file, wf.Name)
+		}
+		declared[p.Name] = true
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("%s: workflow %q, parameter %s: %w", wf.file, wf.Name, p.Name, err)
+			}
+			p.pattern = re
+		}
+	}
+
+	for _, m := range placeholderPattern.FindAllStringSubmatch(wf.Command, -1) {
+		if !declared[m[1]] {
+			declared[m[1]] = true
+			wf.Params = append(wf.Params, WorkflowParam{Name: m[1]})
+		}
+	}
+	return nil
+}
+
+// validate checks a value for the parameter, after defaults are applied.
+func (p WorkflowParam) validate(value string) error {
+	if value == "" {
+		if p.Optional {
+			return nil
+		}
+		return errors.New("a value is required")
+	}
+	if len(p.Options) > 0 {
+		for _, o := range p.Options {
+			if o == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(p.Options, ", "))
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return fmt.Errorf("must match %s", p.Pattern)
+	}
+	return nil
+}
+
+// expand fills the placeholders with values, which are in Params order.
+func (wf Workflow) expand(values []string) string {
+	byName := make(map[string]string, len(values))
+	for i, p := range wf.Params {
+		if i < len(values) {
+			byName[p.Name] = values[i]
+		}
+	}
+	return placeholderPattern.ReplaceAllStringFunc(wf.Command, func(s string) string {
+		return byName[placeholderPattern.FindStringSubmatch(s)[1]]
+	})
+}
+
+func newWorkflowInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "= "
+	ti.CharLimit = 0
+	return ti
+}
+
+// startWorkflow prompts for the workflow's parameters, or runs it straight
+// away when it has none.
+func (m *model) startWorkflow(wf Workflow) tea.Cmd {
+	if len(wf.Params) == 0 {
+		m.runWorkflow(wf, nil)
+		return nil
+	}
+
+	m.workflow.active = true
+	m.workflow.workflow = wf
+	m.workflow.values = make([]string, len(wf.Params))
+	for i, p := range wf.Params {
+		m.workflow.values[i] = p.Default
+	}
+	m.workflow.err = ""
+	m.showParam(0)
+	return m.workflow.input.Focus()
+}
+
+func (m *model) showParam(i int) {
+	f := &m.workflow
+	f.param = i
+	p := f.workflow.Params[i]
+	f.input.SetValue(f.values[i])
+	f.input.CursorEnd()
+	f.input.Placeholder = p.Default
+	if len(p.Options) > 0 {
+		f.input.Placeholder = strings.Join(p.Options, " | ")
+	}
+}
+
+func (m *model) closeWorkflow() {
+	m.workflow.active = false
+	m.workflow.input.Blur()
+}
+
+// runWorkflow runs the expanded command like typed input, so it gets a
+// command block and a history entry.
+func (m *model) runWorkflow(wf Workflow, values []string) {
+	// A failure to save history adds a block after the command block
+	idx := len(m.blocks)
+	m.submitInput("!" + wf.expand(values))
+	m.blocks[idx].Title = wf.Name
+	m.blocks[idx].Metadata["workflow"] = wf.Name
+}
+
+// updateWorkflow handles keys while the parameter prompt is open. Tab
+// cycles through the allowed values.
+func (m *model) updateWorkflow(msg tea.KeyMsg) tea.Cmd {
+	f := &m.workflow
+	p := f.workflow.Params[f.param]
+
+	switch {
+	case key.Matches(msg, m.keys.Cancel):
+		m.closeWorkflow()
+
+	case key.Matches(msg, m.keys.Submit):
+		value := f.input.Value()
+		if value == "" {
+			value = p.Default
+		}
+		if err := p.validate(value); err != nil {
+			f.err = err.Error()
+			return nil
+		}
+		f.values[f.param] = value
+		f.err = ""
+
+		if f.param+1 < len(f.workflow.Params) {
+			m.showParam(f.param + 1)
+			return nil
+		}
+		m.closeWorkflow()
+		m.runWorkflow(f.workflow, f.values)
+
+	case key.Matches(msg, m.keys.CompletePrev):
+		if f.param > 0 {
+			f.values[f.param] = f.input.Value()
+			f.err = ""
+			m.showParam(f.param - 1)
+		}
+
+	case key.Matches(msg, m.keys.Complete) && len(p.Options) > 0:
+		next := p.Options[0]
+		for i, o := range p.Options {
+			if o == f.input.Value() {
+				next = p.Options[(i+1)%len(p.Options)]
+			}
+		}
+		f.input.SetValue(next)
+		f.input.CursorEnd()
+
+	default:
+		var cmd tea.Cmd
+		f.input, cmd = f.input.Update(msg)
+		f.err = ""
+		return cmd
+	}
+
+	return nil
+}
+
+// renderWorkflow draws the parameter prompt: the command with the values
+// filled in so far, then the current parameter.
+func (m model) renderWorkflow() string {
+	f := m.workflow
+	wf := f.workflow
+	p := wf.Params[f.param]
+
+	values := append([]string(nil), f.values...)
+	values[f.param] = f.input.Value()
+	for i, v := range values {
+		if v == "" {
+			values[i] = "{{" + wf.Params[i].Name + "}}"
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(m.styles.BlockTitle.Copy().MarginBottom(0).Render("Workflow: " + wf.Name))
+	if wf.Description != "" {
+		b.WriteString("\n" + m.styles.Muted.Render(wf.Description))
+	}
+	b.WriteString("\n" + m.styles.CommandLine.Render("$ "+wf.expand(values)))
+	b.WriteString(fmt.Sprintf("\n\n%s (%d/%d)", p.Name, f.param+1, len(wf.Params)))
+	if p.Description != "" {
+		b.WriteString(m.styles.Muted.Render("  " + p.Description))
+	}
+	b.WriteString("\n" + f.input.View())
+	if f.err != "" {
+		b.WriteString("\n" + m.styles.ErrorText.Render("✗ "+f.err))
+	}
+
+	next := "next"
+	if f.param == len(wf.Params)-1 {
+		next = "run"
+	}
+	hint := fmt.Sprintf("%s: %s | %s: back | %s: cancel",
+		m.keys.Submit.Help().Key, next, m.keys.CompletePrev.Help().Key, m.keys.Cancel.Help().Key)
+	if len(p.Options) > 0 {
+		hint = m.keys.Complete.Help().Key + ": next option | " + hint
+	}
+	b.WriteString("\n" + m.styles.Muted.Render(hint))
+
+	return m.styles.HelpOverlay.Copy().
+		Padding(0, 1).
+		Width(m.width - 4).
+		Render(b.String())
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
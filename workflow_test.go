@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkflowPrepare(t *testing.T) {
+	tests := []struct {
+		name    string
+		wf      Workflow
+		params  []string
+		wantErr string
+	}{
+		{
+			name:   "placeholders become params in order",
+			wf:     Workflow{Name: "ssh", Command: "ssh {{user}}@{{ host }} -p {{port}} # {{user}}"},
+			params: []string{"user", "host", "port"},
+		},
+		{
+			name: "declared params come first",
+			wf: Workflow{Name: "logs", Command: "kubectl logs {{pod}} -n {{namespace}}", Params: []WorkflowParam{
+				{Name: "namespace", Default: "default"},
+			}},
+			params: []string{"namespace", "pod"},
+		},
+		{
+			name: "declared without placeholder",
+			wf: Workflow{Name: "echo", Command: "echo hi", Params: []WorkflowParam{
+				{Name: "unused"},
+			}},
+			params: []string{"unused"},
+		},
+		{name: "no command", wf: Workflow{Name: "empty", Command: "  "}, wantErr: `workflow "empty" has no command`},
+		{
+			name:    "param without a name",
+			wf:      Workflow{Name: "bad", Command: "ls", Params: []WorkflowParam{{Default: "x"}}},
+			wantErr: "parameter without a name",
+		},
+		{
+			name:    "bad pattern",
+			wf:      Workflow{Name: "bad", Command: "ls {{x}}", Params: []WorkflowParam{{Name: "x", Pattern: "("}}},
+			wantErr: "parameter x: error parsing regexp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := tt.wf
+			err := wf.prepare()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range wf.Params {
+				names = append(names, p.Name)
+			}
+			if strings.Join(names, " ") != strings.Join(tt.params, " ") {
+				t.Errorf("params = %q, want %q", names, tt.params)
+			}
+		})
+	}
+}
+
+func TestWorkflowParamValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   WorkflowParam
+		value   string
+		wantErr string
+	}{
+		{name: "required", param: WorkflowParam{Name: "x"}, value: "", wantErr: "a value is required"},
+		{name: "optional empty", param: WorkflowParam{Name: "x", Optional: true}, value: ""},
+		{name: "optional checked when set", param: WorkflowParam{Name: "x", Optional: true, Pattern: `\d+`}, value: "a", wantErr: `must match \d+`},
+		{name: "pattern", param: WorkflowParam{Name: "port", Pattern: `\d+`}, value: "8080"},
+		// The whole value has to match
+		{name: "pattern anchored at the end", param: WorkflowParam{Name: "port", Pattern: `\d+`}, value: "80a", wantErr: "must match"},
+		{name: "pattern anchored at the start", param: WorkflowParam{Name: "port", Pattern: `\d+`}, value: "a80", wantErr: "must match"},
+		{name: "alternatives anchored together", param: WorkflowParam{Name: "env", Pattern: `dev|prod`}, value: "devprod", wantErr: "must match"},
+		{name: "option", param: WorkflowParam{Name: "env", Options: []string{"dev", "prod"}}, value: "prod"},
+		{name: "not an option", param: WorkflowParam{Name: "env", Options: []string{"dev", "prod"}}, value: "staging", wantErr: "must be one of dev, prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := Workflow{Name: "w", Command: "run {{" + tt.param.Name + "}}", Params: []WorkflowParam{tt.param}}
+			if err := wf.prepare(); err != nil {
+				t.Fatal(err)
+			}
+			err := wf.Params[0].validate(tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate(%q) = %v", tt.value, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate(%q) = %v, want %q", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkflowExpand(t *testing.T) {
+	wf := Workflow{Name: "scp", Command: "scp {{file}} {{host}}:{{ dir }}/{{file}}"}
+	if err := wf.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{values: []string{"a b.txt", "web", "/tmp"}, want: "scp a b.txt web:/tmp/a b.txt"},
+		// Values are used verbatim, not expanded again
+		{values: []string{"{{host}}", "web", "$HOME"}, want: "scp {{host}} web:$HOME/{{host}}"},
+		{values: []string{"f"}, want: "scp f :/f"},
+	}
+	for _, tt := range tests {
+		if got := wf.expand(tt.values); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestLoadWorkflowFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		text    string
+		want    []string // names
+		wantErr string
+	}{
+		{
+			name: "one workflow",
+			file: "deploy.yaml",
+			text: "name: Deploy\ncommand: make deploy ENV={{env}}\n",
+			want: []string{"Deploy"},
+		},
+		{
+			name: "named after the file",
+			file: "restart-web.yml",
+			text: "command: systemctl restart web\n",
+			want: []string{"restart-web"},
+		},
+		{
+			name: "a list",
+			file: "git.yaml",
+			text: "- name: Amend\n  command: git commit --amend\n- command: git push\n",
+			want: []string{"Amend", "git"},
+		},
+		{name: "empty", file: "empty.yaml", text: ""},
+		{name: "not yaml", file: "bad.yaml", text: "name: [\n", wantErr: "bad.yaml:"},
+		{name: "wrong shape", file: "shape.yaml", text: "- just a string\n", wantErr: "shape.yaml:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			workflows, err := loadWorkflowFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, wf := range workflows {
+				names = append(names, wf.Name)
+				if wf.file != path {
+					t.Errorf("%s: file = %q", wf.Name, wf.file)
+				}
+			}
+			if strings.Join(names, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("names = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWorkflowsReportsBadOnes(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml": "- name: zeta\n  command: echo z\n- name: Alpha\n  command: echo a\n",
+		"b.yaml": "name: broken\ncommand: ''\n",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workflows, warnings := loadWorkflows(WorkflowsConfig{Dirs: []string{dir, filepath.Join(dir, "missing")}})
+	if len(workflows) != 2 || workflows[0].Name != "Alpha" || workflows[1].Name != "zeta" {
+		t.Errorf("workflows = %+v", workflows)
+	}
+	if got := strings.Join(warnings, "\n"); !strings.Contains(got, `"broken" has no command`) || !strings.Contains(got, "missing does not exist") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}